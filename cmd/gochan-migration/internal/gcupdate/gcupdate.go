@@ -13,7 +13,7 @@ import (
 
 const (
 	// if the database version is less than this, it is assumed to be out of date, and the schema needs to be adjusted
-	latestDatabaseVersion = 3
+	latestDatabaseVersion = 4
 )
 
 type GCDatabaseUpdater struct {
@@ -109,5 +109,101 @@ func updateSqliteDB(db *gcsql.GCDB, tx *sql.Tx, criticalCfg *config.SystemCritic
 		}
 	}
 
+	// add fingerprint column to DBPREFIXfiles
+	dataType, err = common.ColumnType(db, tx, "fingerprint", "DBPREFIXfiles", criticalCfg)
+	if err != nil {
+		return err
+	}
+	if dataType == "" {
+		query = `ALTER TABLE DBPREFIXfiles ADD COLUMN fingerprint VARCHAR(64) NOT NULL DEFAULT ''`
+		if _, err = db.ExecTxSQL(tx, query); err != nil {
+			return err
+		}
+	}
+
+	// add DBPREFIXpost_commands table for storing the results of post commands (dice rolls, etc)
+	query = `CREATE TABLE IF NOT EXISTS DBPREFIXpost_commands(
+		post_id BIGINT NOT NULL,
+		command_order INT NOT NULL,
+		command VARCHAR(32) NOT NULL,
+		args VARCHAR(100) NOT NULL DEFAULT '',
+		result VARCHAR(255) NOT NULL,
+		CONSTRAINT post_commands_post_id_fk
+			FOREIGN KEY(post_id) REFERENCES DBPREFIXposts(id) ON DELETE CASCADE,
+		CONSTRAINT post_commands_pk PRIMARY KEY (post_id,command_order)
+	)`
+	if _, err = db.ExecTxSQL(tx, query); err != nil {
+		return err
+	}
+
+	// add DBPREFIXr9k_hashes and DBPREFIXr9k_mutes tables for boards in R9K mode
+	query = `CREATE TABLE IF NOT EXISTS DBPREFIXr9k_hashes(
+		board_id BIGINT NOT NULL,
+		hash CHAR(64) NOT NULL,
+		CONSTRAINT r9k_hashes_board_id_fk
+			FOREIGN KEY(board_id) REFERENCES DBPREFIXboards(id) ON DELETE CASCADE,
+		CONSTRAINT r9k_hashes_pk PRIMARY KEY (board_id,hash)
+	)`
+	if _, err = db.ExecTxSQL(tx, query); err != nil {
+		return err
+	}
+	query = `CREATE TABLE IF NOT EXISTS DBPREFIXr9k_mutes(
+		board_id BIGINT NOT NULL,
+		ip VARCHAR(45) NOT NULL,
+		mute_count INT NOT NULL DEFAULT 0,
+		expires_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		CONSTRAINT r9k_mutes_board_id_fk
+			FOREIGN KEY(board_id) REFERENCES DBPREFIXboards(id) ON DELETE CASCADE,
+		CONSTRAINT r9k_mutes_pk PRIMARY KEY (board_id,ip)
+	)`
+	if _, err = db.ExecTxSQL(tx, query); err != nil {
+		return err
+	}
+
+	// add wordfilter action and hit counter columns
+	for _, column := range []struct{ name, definition string }{
+		{"action", "VARCHAR(10) NOT NULL DEFAULT 'replace'"},
+		{"ban_duration", "VARCHAR(32) NOT NULL DEFAULT ''"},
+		{"hits", "INT NOT NULL DEFAULT 0"},
+		{"last_hit_at", "TIMESTAMP NULL"},
+	} {
+		if dataType, err = common.ColumnType(db, tx, column.name, "DBPREFIXwordfilters", criticalCfg); err != nil {
+			return err
+		}
+		if dataType == "" {
+			query = "ALTER TABLE DBPREFIXwordfilters ADD COLUMN " + column.name + " " + column.definition
+			if _, err = db.ExecTxSQL(tx, query); err != nil {
+				return err
+			}
+		}
+	}
+
+	// add DBPREFIXpending_posts table for posts held for moderator approval
+	query = `CREATE TABLE IF NOT EXISTS DBPREFIXpending_posts(
+		post_id BIGINT NOT NULL,
+		reason VARCHAR(255) NOT NULL,
+		bump_thread BOOL NOT NULL,
+		CONSTRAINT pending_posts_post_id_fk
+			FOREIGN KEY(post_id) REFERENCES DBPREFIXposts(id) ON DELETE CASCADE,
+		CONSTRAINT pending_posts_pk PRIMARY KEY (post_id)
+	)`
+	if _, err = db.ExecTxSQL(tx, query); err != nil {
+		return err
+	}
+
+	// add DBPREFIXrate_limits table for rate limits shared between gochan instances
+	query = `CREATE TABLE IF NOT EXISTS DBPREFIXrate_limits(
+		bucket_key VARCHAR(128) NOT NULL,
+		tokens BIGINT NOT NULL,
+		updated_ms BIGINT NOT NULL,
+		CONSTRAINT rate_limits_pk PRIMARY KEY (bucket_key)
+	)`
+	if _, err = db.ExecTxSQL(tx, query); err != nil {
+		return err
+	}
+
+	// SQLite doesn't enforce VARCHAR lengths, so the tripcode column doesn't need to be widened like it does in
+	// MySQL and PostgreSQL
+
 	return nil
 }
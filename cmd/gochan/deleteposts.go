@@ -22,15 +22,16 @@ import (
 )
 
 type delPost struct {
-	postID   int
-	opID     int
-	isOP     bool
-	filename string
-	boardDir string
+	postID    int
+	opID      int
+	isOP      bool
+	filename  string
+	fileOrder int
+	boardDir  string
 }
 
 func (u *delPost) filePath() string {
-	if u.filename == "" || u.filename == "deleted" {
+	if u.filename == "" || u.filename == "deleted" || uploads.IsEmbed(u.filename) {
 		return ""
 	}
 	return path.Join(config.GetSystemCriticalConfig().DocumentRoot, u.boardDir, "src", u.filename)
@@ -55,14 +56,16 @@ func coalesceErrors(errs ...error) error {
 }
 
 // deleteFile asynchronously deletes the post's file and thumb (if it has one, it returns nil if not) and
-// thread HTML file if it is an OP and "File only" is unchecked, returning an error if one occcured for any file
+// thread HTML file if it is an OP and "File only" is unchecked, returning an error if one occcured for any file.
+// A post has a row for each of its files, so the catalog thumbnail and thread pages are only deleted with the
+// first file
 func (u *delPost) deleteFile(delThread bool) error {
 	var errCatalog, errThumb, errFile, errThread, errJSON error
 	var wg sync.WaitGroup
 	wg.Add(2)
 	file := u.filePath()
 	thumb, catalogThumb := u.thumbnailPaths()
-	if u.isOP {
+	if u.isOP && u.fileOrder == 0 {
 		wg.Add(1)
 		go func() {
 			if catalogThumb != "" {
@@ -70,7 +73,7 @@ func (u *delPost) deleteFile(delThread bool) error {
 			}
 			wg.Done()
 		}()
-		if delThread && u.isOP {
+		if delThread {
 			wg.Add(2)
 			threadBase := path.Join(config.GetSystemCriticalConfig().DocumentRoot,
 				u.boardDir, "res", strconv.Itoa(u.postID))
@@ -115,7 +118,7 @@ func getAllPostsToDelete(postIDs []any, fileOnly bool) ([]delPost, []any, error)
 	query := `SELECT p.id AS postid, (
 		SELECT op.id AS opid FROM DBPREFIXposts op
 		WHERE op.thread_id = p.thread_id AND is_top_post LIMIT 1
-	) as opid, is_top_post, COALESCE(filename, "") AS filename, dir
+	) as opid, is_top_post, COALESCE(filename, "") AS filename, COALESCE(file_order, 0) AS file_order, dir
 	FROM DBPREFIXboards b
 	LEFT JOIN DBPREFIXthreads t ON t.board_id = b.id
 	LEFT JOIN DBPREFIXposts p ON p.thread_id = t.id
@@ -139,7 +142,7 @@ func getAllPostsToDelete(postIDs []any, fileOnly bool) ([]delPost, []any, error)
 	var postIDsAny []any
 	for rows.Next() {
 		var post delPost
-		if err = rows.Scan(&post.postID, &post.opID, &post.isOP, &post.filename, &post.boardDir); err != nil {
+		if err = rows.Scan(&post.postID, &post.opID, &post.isOP, &post.filename, &post.fileOrder, &post.boardDir); err != nil {
 			rows.Close()
 			return nil, nil, err
 		}
@@ -190,9 +193,23 @@ func deletePosts(checkedPosts []int, writer http.ResponseWriter, request *http.R
 	gcutil.LogBool("fileOnly", fileOnly, infoEv, errEv)
 	gcutil.LogInt("affectedPosts", len(posts), infoEv, errEv)
 
-	if staff.Rank > 0 {
+	delPosts, affectedPostIDs, err := getAllPostsToDelete(posts, fileOnly)
+	if err != nil {
+		serveError(writer, "Unable to get post info for one or more checked posts",
+			http.StatusInternalServerError, wantsJSON, errEv.Err(err).Caller())
+		return
+	}
+
+	staffCanDelete, err := canModeratePosts(staff, delPosts)
+	if err != nil {
+		serveError(writer, "Unable to get staff board assignments",
+			http.StatusInternalServerError, wantsJSON, errEv.Err(err).Caller())
+		return
+	}
+	if staffCanDelete {
 		gcutil.LogStr("staff", staff.Username, infoEv, errEv)
 	} else {
+		// not staff, or a board moderator deleting posts outside of their boards
 		sumsMatch, err := validatePostPasswords(posts, passwordMD5)
 		if err != nil {
 			serveError(writer, "Unable to validate post password checksums",
@@ -205,13 +222,6 @@ func deletePosts(checkedPosts []int, writer http.ResponseWriter, request *http.R
 		}
 	}
 
-	delPosts, affectedPostIDs, err := getAllPostsToDelete(posts, fileOnly)
-	if err != nil {
-		serveError(writer, "Unable to get post info for one or more checked posts",
-			http.StatusInternalServerError, wantsJSON, errEv.Err(err).Caller())
-		return
-	}
-
 	boardid, err := strconv.Atoi(request.FormValue("boardid"))
 	if err != nil {
 		serveError(writer, "Invalid boardid value", http.StatusBadRequest, wantsJSON, errEv.Err(err).Caller().
@@ -249,6 +259,29 @@ func deletePosts(checkedPosts []int, writer http.ResponseWriter, request *http.R
 	http.Redirect(writer, request, config.WebPath(board), http.StatusFound)
 }
 
+// canModeratePosts returns true if the staff member is allowed to moderate every board that the posts are on
+func canModeratePosts(staff *gcsql.Staff, posts []delPost) (bool, error) {
+	if staff.Rank < 1 {
+		return false, nil
+	}
+	checked := map[string]bool{}
+	for _, post := range posts {
+		if checked[post.boardDir] {
+			continue
+		}
+		boardID, err := gcsql.GetBoardIDFromDir(post.boardDir)
+		if err != nil {
+			return false, err
+		}
+		canModerate, err := staff.CanModerateBoard(boardID)
+		if err != nil || !canModerate {
+			return false, err
+		}
+		checked[post.boardDir] = true
+	}
+	return true, nil
+}
+
 // should return true if all posts have the same password checksum
 func validatePostPasswords(posts []any, passwordMD5 string) (bool, error) {
 	var count int
@@ -330,7 +363,8 @@ func deletePostFiles(posts []delPost, deleteIDs []any, permDelete bool, request
 	var err error
 	var tmpErr error
 	for _, post := range posts {
-		if tmpErr = post.deleteFile(permDelete); tmpErr != nil {
+		tmpErr = post.deleteFile(permDelete)
+		if tmpErr != nil {
 			errArr.Int(post.postID).Err(err)
 			if err == nil {
 				err = tmpErr
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteMultipleFileOP(t *testing.T) {
+	config.SetVersion("4.0.0")
+	documentRoot := t.TempDir()
+	config.SetTestDocumentRoot(documentRoot)
+	for _, dir := range []string{"src", "thumb", "res"} {
+		if err := os.MkdirAll(path.Join(documentRoot, "test", dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := []string{
+		"src/1.jpg", "thumb/1t.jpg", "thumb/1c.jpg",
+		"src/2.jpg", "thumb/2t.jpg",
+		"res/1.html", "res/1.json",
+	}
+	for _, file := range files {
+		if err := os.WriteFile(path.Join(documentRoot, "test", file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// each of the OP's files has its own row, only the first has a catalog thumbnail
+	posts := []delPost{
+		{postID: 1, opID: 1, isOP: true, filename: "2.jpg", fileOrder: 1, boardDir: "test"},
+		{postID: 1, opID: 1, isOP: true, filename: "1.jpg", fileOrder: 0, boardDir: "test"},
+	}
+	for _, post := range posts {
+		assert.NoError(t, post.deleteFile(true))
+	}
+	for _, file := range files {
+		assert.NoFileExists(t, path.Join(documentRoot, "test", file))
+	}
+}
@@ -141,7 +141,7 @@ func editPost(checkedPosts []int, editBtn string, doEdit string, writer http.Res
 		}
 
 		if doEdit == "upload" {
-			oldUpload, err := post.GetUpload()
+			oldUploads, err := post.GetUploads()
 			if err != nil {
 				errEv.Err(err).Caller().Send()
 				server.ServeError(writer, err.Error(), wantsJSON, nil)
@@ -159,20 +159,15 @@ func editPost(checkedPosts []int, editBtn string, doEdit string, writer http.Res
 			}
 			documentRoot := config.GetSystemCriticalConfig().DocumentRoot
 			var filePath, thumbPath, catalogThumbPath string
-			if oldUpload != nil {
-				filePath = path.Join(documentRoot, board.Dir, "src", oldUpload.Filename)
-				thumbPath, catalogThumbPath = uploads.GetThumbnailFilenames(
-					path.Join(documentRoot, board.Dir, "thumb", oldUpload.Filename))
+			if len(oldUploads) > 0 {
 				if err = post.UnlinkUploads(false); err != nil {
 					errEv.Err(err).Caller().Send()
 					server.ServeError(writer, "Error unlinking old upload from post: "+err.Error(), wantsJSON, nil)
 					return
 				}
-				if oldUpload.Filename != "deleted" {
-					os.Remove(filePath)
-					os.Remove(thumbPath)
-					if post.IsTopPost {
-						os.Remove(catalogThumbPath)
+				for _, oldUpload := range oldUploads {
+					if oldUpload.Filename != "deleted" {
+						uploads.RemoveUploadFiles(board.Dir, &oldUpload)
 					}
 				}
 			}
@@ -213,10 +208,20 @@ func editPost(checkedPosts []int, editBtn string, doEdit string, writer http.Res
 				})
 				return
 			}
+			commandResults, err := post.GetCommandResults()
+			if err != nil {
+				errEv.Err(err).Caller().
+					Int("postid", post.ID).
+					Msg("Unable to get post command results")
+				server.ServeError(writer, "Unable to edit post: "+err.Error(), wantsJSON, map[string]interface{}{
+					"postid": post.ID,
+				})
+				return
+			}
 			if err = post.UpdateContents(
 				request.FormValue("editemail"),
 				request.FormValue("editsubject"),
-				posting.FormatMessage(request.FormValue("editmsg"), board.Dir),
+				posting.FormatMessage(request.FormValue("editmsg"), board.Dir, commandResults...),
 				request.FormValue("editmsg"),
 			); err != nil {
 				errEv.Err(err).Caller().
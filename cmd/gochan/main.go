@@ -86,6 +86,7 @@ func main() {
 		gcutil.LogFatal().Err(err).Msg("Unable to initialize GeoIP")
 	}
 	posting.InitCaptcha()
+	posting.InitBlocklists()
 
 	if err = gctemplates.InitTemplates(); err != nil {
 		fmt.Println("Failed initializing templates:", err.Error())
@@ -28,39 +28,49 @@ func initServer() {
 	listenAddr := net.JoinHostPort(systemCritical.ListenIP, strconv.Itoa(systemCritical.Port))
 
 	router := server.GetRouter()
-	router.GET(config.WebPath("/captcha"), bunrouter.HTTPHandlerFunc(posting.ServeCaptcha))
-	router.POST(config.WebPath("/captcha"), bunrouter.HTTPHandlerFunc(posting.ServeCaptcha))
-	router.GET(config.WebPath("/manage"), bunrouter.HTTPHandlerFunc(manage.CallManageFunction))
-	router.GET(config.WebPath("/manage/:action"), bunrouter.HTTPHandlerFunc(manage.CallManageFunction))
-	router.POST(config.WebPath("/manage/:action"), bunrouter.HTTPHandlerFunc(manage.CallManageFunction))
+	captchaRoutes := router.WithMiddleware(server.RateLimitMiddleware("captcha"))
+	captchaRoutes.GET(config.WebPath("/captcha"), bunrouter.HTTPHandlerFunc(posting.ServeCaptcha))
+	captchaRoutes.POST(config.WebPath("/captcha"), bunrouter.HTTPHandlerFunc(posting.ServeCaptcha))
+	manageRoutes := router.WithMiddleware(server.RateLimitMiddleware("manage"))
+	manageRoutes.GET(config.WebPath("/manage"), bunrouter.HTTPHandlerFunc(manage.CallManageFunction))
+	manageRoutes.GET(config.WebPath("/manage/:action"), bunrouter.HTTPHandlerFunc(manage.CallManageFunction))
+	manageRoutes.POST(config.WebPath("/manage/:action"), bunrouter.HTTPHandlerFunc(manage.CallManageFunction))
 	router.GET(config.WebPath("/post"), bunrouter.HTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, config.WebPath("/"), http.StatusFound)
 	}))
-	router.POST(config.WebPath("/post"), bunrouter.HTTPHandlerFunc(posting.MakePost))
-	router.GET(config.WebPath("/util"), bunrouter.HTTPHandlerFunc(utilHandler))
-	router.POST(config.WebPath("/util"), bunrouter.HTTPHandlerFunc(utilHandler))
+	router.WithMiddleware(server.RateLimitMiddleware("post")).
+		POST(config.WebPath("/post"), bunrouter.HTTPHandlerFunc(posting.MakePost))
+	utilRoutes := router.WithMiddleware(server.RateLimitMiddleware("util"))
+	utilRoutes.GET(config.WebPath("/util"), bunrouter.HTTPHandlerFunc(utilHandler))
+	utilRoutes.POST(config.WebPath("/util"), bunrouter.HTTPHandlerFunc(utilHandler))
 	router.GET(config.WebPath("/util/banner"), bunrouter.HTTPHandlerFunc(randomBanner))
 	// Eventually plugins might be able to register new namespaces or they might be restricted to something
 	// like /plugin
 
-	if systemCritical.UseFastCGI {
-		listener, err = net.Listen("tcp", listenAddr)
-		if err != nil {
-			if !systemCritical.Verbose {
-				fmt.Printf("Failed listening on %s:%d: %s", systemCritical.ListenIP, systemCritical.Port, err.Error())
-			}
-			gcutil.LogFatal().Err(err).Caller().
-				Str("ListenIP", systemCritical.ListenIP).
-				Int("Port", systemCritical.Port).Send()
+	listener, err = net.Listen("tcp", listenAddr)
+	if err != nil {
+		if !systemCritical.Verbose {
+			fmt.Printf("Failed listening on %s:%d: %s", systemCritical.ListenIP, systemCritical.Port, err.Error())
 		}
+		gcutil.LogFatal().Err(err).Caller().
+			Str("ListenIP", systemCritical.ListenIP).
+			Int("Port", systemCritical.Port).Send()
+	}
+	if systemCritical.ProxyProtocol {
+		listener = &server.ProxyProtocolListener{
+			Listener: listener,
+			Trusted:  gcutil.IsTrustedProxyAddr,
+		}
+	}
+
+	if systemCritical.UseFastCGI {
 		err = fcgi.Serve(listener, router)
 	} else {
 		httpServer := &http.Server{
-			Addr:              listenAddr,
 			Handler:           router,
 			ReadHeaderTimeout: 5 * time.Second,
 		}
-		err = httpServer.ListenAndServe()
+		err = httpServer.Serve(listener)
 	}
 
 	if err != nil {
@@ -60,7 +60,34 @@ export function createPostElement(post: ThreadPost, boardDir: string, elementCla
 	if(post.sub !== "")
 		$postInfo.prepend($("<span/>").prop({class:"subject"}).text(post.sub), " ");
 
-	if(post.filename !== "" && post.filename !== "deleted") {
+	if(post.embed) {
+		$post.append(
+			$("<div/>").prop({class: "file-info"})
+				.append(
+					"Embed: ",
+					$("<a/>").prop({
+						class: "file-orig",
+						href: post.embed_link,
+						target: "_blank"
+					}).text(post.embed_link)
+				),
+			$("<a/>").prop({class: "upload-container embed", href: post.embed_link})
+				.attr({
+					"data-embed": post.embed,
+					"data-width": post.w,
+					"data-height": post.h
+				}).append(
+					$("<img/>")
+						.prop({
+							class: "upload",
+							src: webroot + boardDir + "/thumb/" + post.tim.replace(/\.[^.]+$/, "t.jpg"),
+							alt: post.embed_link,
+							width: post.tn_w,
+							height: post.tn_h
+						})
+				)
+		);
+	} else if(post.filename !== "" && post.filename !== "deleted") {
 		const thumbFile = getThumbFilename(post.tim);
 		$post.append(
 			$("<div/>").prop({class: "file-info"})
@@ -90,6 +117,36 @@ export function createPostElement(post: ThreadPost, boardDir: string, elementCla
 						})
 				)
 		);
+		for(const file of post.extra_files ?? []) {
+			$post.append(
+				$("<div/>").prop({class: "file-info"})
+					.append(
+						"File: ",
+						$("<a/>").prop({
+							href: webroot + boardDir + "/src/" + file.tim,
+							target: "_blank"
+						}).text(file.tim),
+						` - (${formatFileSize(file.fsize)} , ${file.w}x${file.h}, `,
+						$("<a/>").prop({
+							class: "file-orig",
+							href: webroot + boardDir + "/src/" + file.tim,
+							download: file.filename,
+						}).text(file.filename),
+						")"
+					),
+				$("<a/>").prop({class: "upload-container", href: webroot + boardDir + "/src/" + file.tim})
+					.append(
+						$("<img/>")
+							.prop({
+								class: "upload",
+								src: webroot + boardDir + "/thumb/" + getThumbFilename(file.tim),
+								alt: webroot + boardDir + "/src/" + file.tim,
+								width: file.tn_w,
+								height: file.tn_h
+							})
+					)
+			);
+		}
 		shrinkOriginalFilenames($post);
 	}
 	$post.append(
@@ -97,6 +154,17 @@ export function createPostElement(post: ThreadPost, boardDir: string, elementCla
 			class: "post-text"
 		}).html(post.com)
 	);
+	if(post.replies?.length > 0) {
+		const threadPath = webroot + boardDir + "/res/" + ((post.resto > 0)?post.resto:post.no) + ".html";
+		const $replies = $("<div/>").prop({class: "post-replies"}).append("Replies:");
+		for(const replyID of post.replies) {
+			$replies.append(" ", $("<a/>").prop({
+				class: "postref",
+				href: `${threadPath}#${replyID}`
+			}).text(`>>${replyID}`));
+		}
+		$post.append($replies);
+	}
 	return $post;
 }
 
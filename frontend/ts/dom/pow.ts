@@ -0,0 +1,84 @@
+import $ from "jquery";
+
+import { alertLightbox } from "./lightbox";
+
+interface PowChallengeJSON {
+	challenge?: string;
+	difficulty?: number;
+	error?: string;
+}
+
+function leadingZeroBits(hash: Uint8Array) {
+	let zeroes = 0;
+	for(const b of hash) {
+		if(b !== 0) {
+			return zeroes + Math.clz32(b) - 24;
+		}
+		zeroes += 8;
+	}
+	return zeroes;
+}
+
+/**
+ * Gets a proof-of-work challenge for the board from the server and finds a solution for it
+ * @param boardID the ID of the board being posted on
+ * @returns the challenge and its solution, to be submitted with the post
+ */
+export async function solveProofOfWork(boardID: string): Promise<[string, string]> {
+	const data: PowChallengeJSON = await $.ajax({
+		url: `${webroot}captcha`,
+		data: {pow: 1, boardid: boardID},
+		dataType: "json",
+		cache: false
+	});
+	if(data.error)
+		throw new Error(data.error);
+	const encoder = new TextEncoder();
+	for(let counter = 0; ; counter++) {
+		const solution = counter.toString();
+		const hash = await crypto.subtle.digest("SHA-256", encoder.encode(`${data.challenge}:${solution}`));
+		if(leadingZeroBits(new Uint8Array(hash)) >= data.difficulty)
+			return [data.challenge, solution];
+	}
+}
+
+/**
+ * Adds the proof-of-work challenge and solution to the form, if the site uses a proof-of-work CAPTCHA
+ */
+export async function addProofOfWork($form: JQuery<HTMLElement>) {
+	if($("form#postform input[name=powchallenge]").length === 0)
+		return;
+	const boardID = $form.find("input[name=boardid]").val() as string;
+	const [challenge, solution] = await solveProofOfWork(boardID);
+	$form.find("input[name=powchallenge],input[name=powsolution]").remove();
+	$form.append(
+		$("<input/>").prop({type: "hidden", name: "powchallenge"}).val(challenge),
+		$("<input/>").prop({type: "hidden", name: "powsolution"}).val(solution)
+	);
+}
+
+export function showPowError(err: any) {
+	alertLightbox(err?.responseJSON?.error ?? err?.message ?? "Unable to get proof-of-work challenge", "Error");
+}
+
+export function initProofOfWork() {
+	const $postform = $<HTMLFormElement>("form#postform");
+	if($postform.find("input[name=powchallenge]").length === 0)
+		return;
+	let solving = false;
+	$postform.on("submit", function(e) {
+		e.preventDefault();
+		if(solving) return false;
+		solving = true;
+		const $submit = $postform.find("input[type=submit]");
+		const submitText = $submit.val();
+		$submit.val("Working...").prop("disabled", true);
+		addProofOfWork($postform).then(() => {
+			this.submit();
+		}).catch(showPowError).finally(() => {
+			solving = false;
+			$submit.val(submitText).prop("disabled", false);
+		});
+		return false;
+	});
+}
@@ -17,6 +17,7 @@ import { getReplyCooldown, getThreadCooldown } from "../api/cooldowns";
 import { getUploadFilename, updateUploadImage } from "./uploaddata";
 import { alertLightbox } from "./lightbox";
 import { addPostDropdown } from "./postdropdown";
+import { addProofOfWork, showPowError } from "./pow";
 
 export let $qr: JQuery<HTMLElement> = null;
 let threadCooldown = 0;
@@ -200,13 +201,21 @@ export function initQR() {
 		}
 	});
 	openQR();
+	if($oldForm.find("input[name=imagefile]").prop("multiple"))
+		$qrbuttons.find("input#imagefile").prop("multiple", true);
 	updateUploadImage($qrbuttons.find("input#imagefile"), qrUploadChange);
 	resetSubmitButtonText();
 
-	$postform.on("submit", function(e) {
+	$postform.on("submit", async function(e) {
 		const $form = $<HTMLFormElement>(this);
 		e.preventDefault();
 		copyCaptchaResponse($form);
+		try {
+			await addProofOfWork($form);
+		} catch(err) {
+			showPowError(err);
+			return false;
+		}
 		const data = new FormData(this);
 
 		$.ajax({
@@ -240,6 +249,10 @@ export function initQR() {
 			},
 			error: (_jqXHR, _status, error) => {
 				alertLightbox(error, "Error");
+			},
+			complete: () => {
+				// image CAPTCHAs can only be attempted once
+				resetImageCaptcha();
 			}
 		});
 		return false;
@@ -257,14 +270,34 @@ function updateThreadSuccess(data: any) {
 	});
 }
 
+// form fields that hCaptcha, reCAPTCHA, and Turnstile put their response tokens in
+const captchaResponseFields = ["h-captcha-response", "g-recaptcha-response", "cf-turnstile-response"];
+
 function copyCaptchaResponse($copyToForm: JQuery<HTMLElement>) {
-	const $captchaResp = $("textarea[name=h-captcha-response]");
-	if($captchaResp.length > 0) {
+	for(const field of captchaResponseFields) {
+		const $captchaResp = $(`form#postform [name=${field}]`);
+		if($captchaResp.length === 0) continue;
+		$copyToForm.find(`[name=${field}]`).remove();
 		$("<textarea/>").prop({
-			"name": "h-captcha-response"
-		}).val($("textarea[name=h-captcha-response]").val()).css("display", "none")
+			"name": field
+		}).val($captchaResp.val()).css("display", "none")
 			.appendTo($copyToForm);
 	}
+	const $captchaAnswer = $("form#postform input[name=captchaanswer]");
+	if($captchaAnswer.length > 0) {
+		$copyToForm.find("input[name=captchaanswer]").remove();
+		$("<input/>").prop({
+			"type": "hidden",
+			"name": "captchaanswer"
+		}).val($captchaAnswer.val()).appendTo($copyToForm);
+	}
+}
+
+function resetImageCaptcha() {
+	$("form#postform input[name=captchaanswer]").val("");
+	$<HTMLImageElement>("img.image-captcha").each((_i, el) => {
+		el.src = el.src.split("?")[0] + "?image&t=" + Date.now();
+	});
 }
 
 function clearQR() {
@@ -12,6 +12,7 @@ import { prepareThumbnails, initPostPreviews } from "./postutil";
 import { addPostDropdown } from "./dom/postdropdown";
 import { initFlags } from "./dom/flags";
 import { initQR } from "./dom/qr";
+import { initProofOfWork } from "./dom/pow";
 import { getBooleanStorageVal } from "./storage";
 
 export function toTop() {
@@ -40,6 +41,7 @@ $(() => {
 	setPageBanner();
 	if(pageThread.board !== "") {
 		prepareThumbnails();
+		initProofOfWork();
 		if(getBooleanStorageVal("useqr", true))
 			initQR();
 		initPostPreviews();
@@ -9,6 +9,8 @@ import "./viewlog";
 import { isThreadLocked } from "../api/management";
 
 const reportsTextRE = /^Reports( \(\d+\))?/;
+// capcodes selectable in the postbox, indexed by staff rank - 1
+const capcodes = ["Janitor", "Moderator", "Admin"];
 
 export let staffActions: StaffAction[] = [];
 let staffInfo: StaffInfo = null;
@@ -87,6 +89,24 @@ function setupManagementEvents() {
 	});
 }
 
+/**
+ * Adds a dropdown to the postbox so that staff can post with the capcode of their rank (or a lower one)
+ */
+function addCapcodeSelect() {
+	const $postbox = $("table#postbox-static");
+	if($postbox.length === 0 || $postbox.find("select[name=capcode]").length > 0) return;
+	const $select = $("<select/>").attr("name", "capcode").append(
+		$("<option/>").val("").text("None")
+	);
+	for(let r = 1; r <= staffInfo.rank && r <= capcodes.length; r++) {
+		$select.append($("<option/>").val(r).text(capcodes[r - 1]));
+	}
+	$("<tr/>").append(
+		$("<th/>").addClass("postblock").text("Capcode"),
+		$("<td/>").append($select)
+	).insertAfter($postbox.find("input[name=postemail]").parents("tr"));
+}
+
 interface BanFileJSON {
 	bantype: string;
 	board?: string;
@@ -172,8 +192,10 @@ export async function initStaff() {
 			console.error("Error getting actions list:", e);
 		}
 	}).then(() => {
-		if(staffInfo.rank > 0)
+		if(staffInfo.rank > 0) {
 			setupManagementEvents();
+			addCapcodeSelect();
+		}
 		return staffInfo;
 	});
 }
@@ -159,6 +159,11 @@ export function prepareThumbnails($parent: JQuery<HTMLElement> = null) {
 	const $container = $parent === null ? $("a.upload-container") : $parent.find("a");
 	$container.on("click", function(e) {
 		const $a = $(this);
+		if($a.hasClass("embed")) {
+			e.preventDefault();
+			expandEmbed($a);
+			return false;
+		}
 		const uploadHref = $a.siblings("div.file-info").children("a.file-orig").attr("href");
 		if(imageTestRE.exec(uploadHref) === null && videoTestRE.exec(uploadHref) === null)
 			return true; // not an image or a video
@@ -207,6 +212,35 @@ export function prepareThumbnails($parent: JQuery<HTMLElement> = null) {
 	});
 }
 
+/**
+ * Replaces an embed's thumbnail with the external site's player, and adds a link to close it
+ * @param $a the embed's a.upload-container element
+ */
+function expandEmbed($a: JQuery<HTMLElement>) {
+	const $fileInfo = $a.prevAll(".file-info:first");
+	$a.hide();
+	const $iframe = $("<iframe />")
+		.prop({
+			src: $a.attr("data-embed"),
+			width: $a.attr("data-width"),
+			height: $a.attr("data-height"),
+			allowFullscreen: true,
+			class: "upload embed"
+		}).attr({
+			frameborder: 0,
+			allow: "autoplay; fullscreen"
+		}).insertAfter($fileInfo);
+
+	$fileInfo.append($("<a />")
+		.prop("href", "javascript:;").on("click", function() {
+			$iframe.remove();
+			$a.show();
+			this.remove();
+		}).css({
+			"padding-left": "8px"
+		}).html("[Close]<br />"));
+}
+
 function selectedText() {
 	if(!window.getSelection) return "";
 	return window.getSelection().toString();
@@ -42,6 +42,14 @@ declare global {
 		images: number;
 	}
 
+	// mode is "never", "threads", "always", "newips", or "flood"
+	interface BoardCaptchaPolicy {
+		mode: string;
+		min_approved_posts?: number;
+		flood_posts?: number;
+		flood_seconds?: number;
+	}
+
 	interface BoardJSON {
 		pages: number;
 		board: string;
@@ -55,6 +63,7 @@ declare global {
 		max_comment_chars: number;
 		ws_board: boolean;
 		cooldowns: BoardCooldowns
+		captcha: BoardCaptchaPolicy;
 		per_page: number;
 	}
 
@@ -71,6 +80,10 @@ declare global {
 		omitted_images: number;
 		sticky: number;
 		locked: number;
+		anchored: number;
+		cyclical: number;
+		bumplimit: number;
+		imagelimit: number;
 	}
 
 	// /boarddir/res/#.json
@@ -96,10 +109,27 @@ declare global {
 		tn_w: number;
 		tn_h: number;
 		capcode: string;
+		id?: string;
+		embed?: string;
+		embed_link?: string;
+		extra_files?: ThreadPostFile[];
+		replies?: number[];
 		time: string;
 		last_modified: string;
 	}
 
+	interface ThreadPostFile {
+		tim: string;
+		filename: string;
+		md5: string;
+		extension: string;
+		fsize: number;
+		w: number;
+		h: number;
+		tn_w: number;
+		tn_h: number;
+	}
+
 	interface PostSubmitResponse {
 		error?: string;
 		id: number;
@@ -14,6 +14,7 @@ import (
 	"github.com/gochan-org/gochan/pkg/gcutil"
 	"github.com/gochan-org/gochan/pkg/posting/uploads"
 	"github.com/gochan-org/gochan/pkg/server/serverutil"
+	"github.com/rs/zerolog"
 )
 
 const (
@@ -39,6 +40,28 @@ type boardJSON struct {
 	MinCommentChars int    `json:"min_comment_chars"`
 
 	Cooldowns config.BoardCooldowns `json:"cooldowns"`
+	Captcha   boardCaptchaJSON      `json:"captcha"`
+}
+
+// boardCaptchaJSON describes when posters on the board need to solve a CAPTCHA
+type boardCaptchaJSON struct {
+	Mode             string `json:"mode"`
+	MinApprovedPosts int    `json:"min_approved_posts,omitempty"`
+	FloodPosts       int    `json:"flood_posts,omitempty"`
+	FloodSeconds     int    `json:"flood_seconds,omitempty"`
+}
+
+func newBoardCaptchaJSON(boardConfig *config.BoardConfig) boardCaptchaJSON {
+	captchaCfg := config.GetSiteConfig().Captcha
+	policy := boardCaptchaJSON{Mode: boardConfig.CaptchaPolicy.GetMode(&captchaCfg)}
+	switch policy.Mode {
+	case config.CaptchaPolicyNewIPs:
+		policy.MinApprovedPosts = boardConfig.CaptchaPolicy.MinApprovedPosts
+	case config.CaptchaPolicyFlood:
+		policy.FloodPosts = boardConfig.CaptchaPolicy.FloodPosts
+		policy.FloodSeconds = boardConfig.CaptchaPolicy.FloodSeconds
+	}
+	return policy
 }
 
 func boolToInt(b bool) int {
@@ -86,12 +109,14 @@ func BuildBoardPages(board *gcsql.Board) error {
 			Post:     opMap[thread.ID],
 			Locked:   boolToInt(thread.Locked),
 			Stickied: boolToInt(thread.Stickied),
+			Anchored: boolToInt(thread.Anchored),
+			Cyclical: boolToInt(thread.Cyclical),
 		}
 		errEv.Int("threadID", thread.ID)
-		if catalogThread.Images, err = thread.GetReplyFileCount(); err != nil {
+		if err = catalogThread.setThreadLimits(board, &thread); err != nil {
 			errEv.Err(err).Caller().
-				Msg("Failed getting file count")
-			return err
+				Msg("Failed getting reply and file count")
+			return errors.New("Error getting reply and file count: " + err.Error())
 		}
 
 		var maxRepliesOnBoardPage int
@@ -103,12 +128,6 @@ func BuildBoardPages(board *gcsql.Board) error {
 			// Otherwise, limit the replies to the configured value for normal threads.
 			maxRepliesOnBoardPage = postCfg.RepliesOnBoardPage
 		}
-		catalogThread.Replies, err = thread.GetReplyCount()
-		if err != nil {
-			errEv.Err(err).Caller().Msg("Failed getting reply count")
-			return errors.New("Error getting reply count: " + err.Error())
-		}
-
 		catalogThread.Posts, err = getThreadPosts(&thread)
 		if err != nil {
 			errEv.Err(err).Caller().Msg("Failed getting replies")
@@ -171,17 +190,20 @@ func BuildBoardPages(board *gcsql.Board) error {
 		}
 		// Render board page template to the file,
 		// packaging the board/section list, threads, and board info
-		captchaCfg := config.GetSiteConfig().Captcha
+		siteCfg := config.GetSiteConfig()
+		captchaCfg := siteCfg.Captcha
 		if err = serverutil.MinifyTemplate(gctemplates.BoardPage, map[string]interface{}{
-			"boards":      gcsql.AllBoards,
-			"sections":    gcsql.AllSections,
-			"threads":     threads,
-			"numPages":    1,
-			"currentPage": 1,
-			"board":       board,
-			"boardConfig": boardConfig,
-			"useCaptcha":  captchaCfg.UseCaptcha(),
-			"captcha":     captchaCfg,
+			"boards":           gcsql.AllBoards,
+			"sections":         gcsql.AllSections,
+			"threads":          threads,
+			"numPages":         1,
+			"currentPage":      1,
+			"board":            board,
+			"boardConfig":      boardConfig,
+			"useCaptcha":       boardConfig.ShowCaptchaOnPage(siteCfg, false),
+			"blocklistCaptcha": !boardConfig.CaptchaPolicy.ShowOnPage(&captchaCfg, false),
+			"captchaMode":      boardConfig.CaptchaPolicy.GetMode(&captchaCfg),
+			"captcha":          captchaCfg,
 		}, boardPageFile, "text/html"); err != nil {
 			errEv.Err(err).Caller().
 				Str("page", "board.html").
@@ -231,22 +253,25 @@ func BuildBoardPages(board *gcsql.Board) error {
 		}
 
 		// Render the boardpage template
-		captchaCfg := config.GetSiteConfig().Captcha
+		siteCfg := config.GetSiteConfig()
+		captchaCfg := siteCfg.Captcha
 		numThreads := len(threads)
 		numPages := numThreads / boardConfig.ThreadsPerPage
 		if (numThreads % boardConfig.ThreadsPerPage) > 0 {
 			numPages++
 		}
 		data := map[string]interface{}{
-			"boards":      gcsql.AllBoards,
-			"sections":    gcsql.AllSections,
-			"threads":     page.Threads,
-			"numPages":    numPages,
-			"currentPage": catalog.currentPage,
-			"board":       board,
-			"boardConfig": boardConfig,
-			"useCaptcha":  captchaCfg.UseCaptcha(),
-			"captcha":     captchaCfg,
+			"boards":           gcsql.AllBoards,
+			"sections":         gcsql.AllSections,
+			"threads":          page.Threads,
+			"numPages":         numPages,
+			"currentPage":      catalog.currentPage,
+			"board":            board,
+			"boardConfig":      boardConfig,
+			"useCaptcha":       boardConfig.ShowCaptchaOnPage(siteCfg, false),
+			"blocklistCaptcha": !boardConfig.CaptchaPolicy.ShowOnPage(&captchaCfg, false),
+			"captchaMode":      boardConfig.CaptchaPolicy.GetMode(&captchaCfg),
+			"captcha":          captchaCfg,
 		}
 		if catalog.currentPage > 1 {
 			data["prevPage"] = catalog.currentPage - 1
@@ -314,6 +339,92 @@ func BuildBoards(verbose bool, which ...int) error {
 	return nil
 }
 
+// deletePostFiles removes the upload and thumbnails (if the post has any) of a post that has been deleted, as well
+// as the thread page if it is a top post
+func deletePostFiles(board *gcsql.Board, postID int, errEv *zerolog.Event) error {
+	boardDir := board.AbsolutePath()
+	post, err := gcsql.GetPostFromID(postID, false)
+	if err != nil {
+		errEv.Err(err).Caller().
+			Int("postID", postID).
+			Msg("Unable to get post")
+		return err
+	}
+	postUploads, err := post.GetUploads()
+	if err != nil {
+		errEv.Err(err).Caller().
+			Int("postID", postID).
+			Msg("Unable to get post uploads")
+		return err
+	}
+	var filePath string
+	for _, upload := range postUploads {
+		if !uploads.IsEmbed(upload.Filename) {
+			// embeds don't have a file in src/, only thumbnails
+			filePath = path.Join(boardDir, "src", upload.Filename)
+			if err = os.Remove(filePath); err != nil {
+				errEv.Err(err).Caller().
+					Int("postID", postID).
+					Str("upload", filePath).Send()
+				return err
+			}
+		}
+		thumbPath, catalogThumbPath := uploads.GetThumbnailFilenames(
+			path.Join(boardDir, "thumb", upload.Filename))
+		if err = os.Remove(thumbPath); err != nil {
+			errEv.Err(err).Caller().
+				Int("postID", postID).
+				Str("thumbnail", thumbPath).Send()
+			return err
+		}
+		// only the first file in a thread gets a catalog thumbnail
+		if post.IsTopPost && board.EnableCatalog && upload.FileOrder == 0 {
+			if err = os.Remove(catalogThumbPath); err != nil {
+				errEv.Err(err).Caller().
+					Int("postID", postID).
+					Str("catalogThumbPath", catalogThumbPath).Send()
+				return err
+			}
+		}
+	}
+
+	if err = post.UnlinkUploads(false); err != nil {
+		errEv.Err(err).Caller().
+			Int("postID", postID).Send()
+		return err
+	}
+	if post.IsTopPost {
+		filePath = path.Join(boardDir, "res", strconv.Itoa(post.ID)+".html")
+		if err = os.Remove(filePath); err != nil {
+			errEv.Err(err).Caller().
+				Int("postID", postID).
+				Str("threadFile", filePath).Send()
+			return err
+		}
+	}
+	return nil
+}
+
+// TrimCyclicalThread deletes the oldest replies (and their uploads) of a cyclical thread once it has more replies
+// than the board's reply limit (AutosageAfter). It does nothing if the thread is not cyclical
+func TrimCyclicalThread(board *gcsql.Board, thread *gcsql.Thread) error {
+	errEv := gcutil.LogError(nil).
+		Str("boardDir", board.Dir).
+		Int("threadID", thread.ID)
+	defer errEv.Discard()
+	oldPosts, err := thread.DeleteOldCyclicalReplies(board.AutosageAfter)
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to delete old cyclical thread replies")
+		return err
+	}
+	for _, postID := range oldPosts {
+		if err = deletePostFiles(board, postID, errEv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Build builds the board and its thread files
 // if force is true, it doesn't fail if the directories exist but does fail if it is a file
 func buildBoard(board *gcsql.Board, force bool) error {
@@ -336,63 +447,10 @@ func buildBoard(board *gcsql.Board, force bool) error {
 		errEv.Err(err).Caller().Msg("Unable to delete old threads")
 		return err
 	}
-	boardDir := path.Join(config.GetSystemCriticalConfig().DocumentRoot, board.Dir)
 	for _, postID := range oldPosts {
-		post, err := gcsql.GetPostFromID(postID, false)
-		if err != nil {
-			errEv.Err(err).Caller().
-				Int("postID", postID).
-				Msg("Unable to get post")
+		if err = deletePostFiles(board, postID, errEv); err != nil {
 			return err
 		}
-		upload, err := post.GetUpload()
-		if err != nil {
-			errEv.Err(err).Caller().
-				Int("postID", postID).
-				Msg("Unable to get post uploads")
-			return err
-		}
-		var filePath string
-		if upload != nil {
-			filePath = path.Join(boardDir, "src", upload.Filename)
-			if err = os.Remove(filePath); err != nil {
-				errEv.Err(err).Caller().
-					Int("postID", postID).
-					Str("upload", filePath).Send()
-				return err
-			}
-			thumbPath, catalogThumbPath := uploads.GetThumbnailFilenames(
-				path.Join(boardDir, "thumb", upload.Filename))
-			if err = os.Remove(thumbPath); err != nil {
-				errEv.Err(err).Caller().
-					Int("postID", postID).
-					Str("thumbnail", thumbPath).Send()
-				return err
-			}
-			if post.IsTopPost && board.EnableCatalog {
-				if err = os.Remove(catalogThumbPath); err != nil {
-					errEv.Err(err).Caller().
-						Int("postID", postID).
-						Str("catalogThumbPath", catalogThumbPath).Send()
-					return err
-				}
-			}
-		}
-
-		if err = post.UnlinkUploads(false); err != nil {
-			errEv.Err(err).Caller().
-				Int("postID", postID).Send()
-			return err
-		}
-		if post.IsTopPost {
-			filePath = path.Join(boardDir, "res", strconv.Itoa(post.ID)+".html")
-			if err = os.Remove(filePath); err != nil {
-				errEv.Err(err).Caller().
-					Int("postID", postID).
-					Str("threadFile", filePath).Send()
-				return err
-			}
-		}
 	}
 
 	dirPath := board.AbsolutePath()
@@ -542,6 +600,7 @@ func BuildBoardListJSON() error {
 		"boards": {},
 	}
 	for _, board := range gcsql.AllBoards {
+		boardConfig := config.GetBoardConfig(board.Dir)
 		boardsMap["boards"] = append(boardsMap["boards"], boardJSON{
 			Dir:             board.Dir,
 			Title:           board.Title,
@@ -552,7 +611,8 @@ func BuildBoardListJSON() error {
 			ImageLimit:      board.NoImagesAfter,
 			MaxCommentChars: board.MaxMessageLength,
 			MinCommentChars: board.MinMessageLength,
-			Cooldowns:       config.GetBoardConfig(board.Dir).Cooldowns,
+			Cooldowns:       boardConfig.Cooldowns,
+			Captcha:         newBoardCaptchaJSON(boardConfig),
 		})
 	}
 
@@ -38,7 +38,8 @@ func getRecentPosts() ([]recentPost, error) {
 	COALESCE(f.filename, ''), op.id
 	FROM DBPREFIXposts
 	LEFT JOIN (SELECT id, board_id FROM DBPREFIXthreads) t ON t.id = DBPREFIXposts.thread_id
-	LEFT JOIN (SELECT post_id, filename FROM DBPREFIXfiles) f on f.post_id = DBPREFIXposts.id
+	LEFT JOIN (SELECT post_id, filename, file_order FROM DBPREFIXfiles) f on f.post_id = DBPREFIXposts.id
+		AND f.file_order = (SELECT MIN(file_order) FROM DBPREFIXfiles WHERE post_id = DBPREFIXposts.id)
 	INNER JOIN (SELECT id, thread_id FROM DBPREFIXposts WHERE is_top_post) op ON op.thread_id = DBPREFIXposts.thread_id
 	WHERE DBPREFIXposts.is_deleted = FALSE`
 	if !siteCfg.RecentPostsWithNoFile {
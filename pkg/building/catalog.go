@@ -20,10 +20,28 @@ type catalogThreadData struct {
 	OmittedImages int     `json:"omitted_images"` // uploads in the thread but not shown on the board page
 	Stickied      int     `json:"sticky"`
 	Locked        int     `json:"closed"`
+	Anchored      int     `json:"anchored"`   // 1 if replies do not bump the thread
+	Cyclical      int     `json:"cyclical"`   // 1 if the oldest replies are deleted once the thread reaches the bump limit
+	BumpLimit     int     `json:"bumplimit"`  // 1 if the thread has reached the board's bump limit
+	ImageLimit    int     `json:"imagelimit"` // 1 if the thread has reached the board's image limit
 	Posts         []*Post `json:"-"`
 	uploads       []gcsql.Upload
 }
 
+// setThreadLimits sets the reply and upload counts of the thread, and whether they have reached the board's
+// bump and image limits
+func (ct *catalogThreadData) setThreadLimits(board *gcsql.Board, thread *gcsql.Thread) (err error) {
+	if ct.Replies, err = thread.GetReplyCount(); err != nil {
+		return err
+	}
+	if ct.Images, err = thread.GetReplyFileCount(); err != nil {
+		return err
+	}
+	ct.BumpLimit = boolToInt(board.BumpLimitReached(ct.Replies))
+	ct.ImageLimit = boolToInt(board.ImageLimitReached(ct.Images))
+	return nil
+}
+
 type catalogPage struct {
 	PageNum int                 `json:"page"`
 	Threads []catalogThreadData `json:"threads"`
@@ -108,6 +126,21 @@ func BuildCatalog(boardID int) error {
 		errEv.Err(err).Caller().Send()
 		return fmt.Errorf("failed building catalog for /%s/", board.Dir)
 	}
+	threads := make([]catalogThreadData, len(threadOPs))
+	for t, op := range threadOPs {
+		threads[t] = catalogThreadData{
+			Post:     op,
+			Locked:   boolToInt(op.thread.Locked),
+			Stickied: boolToInt(op.thread.Stickied),
+			Anchored: boolToInt(op.thread.Anchored),
+			Cyclical: boolToInt(op.thread.Cyclical),
+		}
+		if err = threads[t].setThreadLimits(board, &op.thread); err != nil {
+			errEv.Err(err).Caller().
+				Int("threadID", op.thread.ID).Send()
+			return fmt.Errorf("failed building catalog for /%s/", board.Dir)
+		}
+	}
 	boardConfig := config.GetBoardConfig(board.Dir)
 
 	if err = serverutil.MinifyTemplate(gctemplates.Catalog, map[string]interface{}{
@@ -115,7 +148,7 @@ func BuildCatalog(boardID int) error {
 		"board":       board,
 		"boardConfig": boardConfig,
 		"sections":    gcsql.AllSections,
-		"threads":     threadOPs,
+		"threads":     threads,
 	}, catalogFile, "text/html"); err != nil {
 		errEv.Err(err).Caller().Send()
 		return fmt.Errorf("failed building catalog for /%s/", board.Dir)
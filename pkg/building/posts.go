@@ -5,7 +5,9 @@ import (
 	"html/template"
 	"net"
 	"path"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gochan-org/gochan/pkg/config"
@@ -15,10 +17,11 @@ import (
 )
 
 const (
-	postQueryBase = `SELECT DBPREFIXposts.id, DBPREFIXposts.thread_id, ip, name, tripcode, email, subject, created_on, created_on as last_modified,
+	postQueryBase = `SELECT DBPREFIXposts.id, DBPREFIXposts.thread_id, ip, name, tripcode, is_role_signature, email, subject, created_on, created_on as last_modified,
 	p.id AS parent_id, t.last_bump as last_bump,
 	message, message_raw,
 	(SELECT dir FROM DBPREFIXboards WHERE id = t.board_id LIMIT 1) AS dir,
+	(SELECT anonymous_name FROM DBPREFIXboards WHERE id = t.board_id LIMIT 1) AS anonymous_name,
 	coalesce(DBPREFIXfiles.original_filename,'') as original_filename,
 	coalesce(DBPREFIXfiles.filename,'') AS filename,
 	coalesce(DBPREFIXfiles.checksum,'') AS checksum,
@@ -29,11 +32,14 @@ const (
 	coalesce(DBPREFIXfiles.height,0) AS height,
 	t.locked as locked,
 	t.stickied as stickied,
+	t.anchored as anchored,
+	t.cyclical as cyclical,
 	flag, country
 	FROM DBPREFIXposts
 	LEFT JOIN DBPREFIXfiles ON DBPREFIXfiles.post_id = DBPREFIXposts.id AND is_deleted = FALSE
+		AND DBPREFIXfiles.file_order = (SELECT MIN(file_order) FROM DBPREFIXfiles WHERE post_id = DBPREFIXposts.id)
 	LEFT JOIN (
-		SELECT id, board_id, last_bump, locked, stickied FROM DBPREFIXthreads
+		SELECT id, board_id, last_bump, locked, stickied, anchored, cyclical FROM DBPREFIXthreads
 	) t ON t.id = DBPREFIXposts.thread_id
 	INNER JOIN (
 		SELECT id, thread_id FROM DBPREFIXposts WHERE is_top_post
@@ -41,6 +47,11 @@ const (
 	WHERE is_deleted = FALSE `
 )
 
+var (
+	// postRefRE matches the post ID in the links created by posting.FormatMessage
+	postRefRE = regexp.MustCompile(`#(\d+)" class="postref"`)
+)
+
 func truncateString(msg string, limit int, ellipsis bool) string {
 	if len(msg) > limit {
 		if ellipsis {
@@ -74,12 +85,40 @@ type Post struct {
 	ThumbnailWidth   int           `json:"tn_w"`
 	ThumbnailHeight  int           `json:"tn_h"`
 	Capcode          string        `json:"capcode"`
+	PosterID         string        `json:"id,omitempty"`
+	EmbedURL         string        `json:"embed,omitempty"`
+	EmbedMediaURL    string        `json:"embed_link,omitempty"`
 	Timestamp        time.Time     `json:"time"`
 	LastModified     string        `json:"last_modified"`
+	ExtraFiles       []*PostFile   `json:"extra_files,omitempty"`
+	Replies          []int         `json:"replies,omitempty"`
 	Country          geoip.Country `json:"-"`
 	thread           gcsql.Thread
 }
 
+// PostFile is a file attached to a post after the first one, which is stored in the Post's file fields
+type PostFile struct {
+	Filename         string `json:"tim"`
+	OriginalFilename string `json:"filename"`
+	Checksum         string `json:"md5"`
+	Extension        string `json:"extension"`
+	Filesize         int    `json:"fsize"`
+	UploadWidth      int    `json:"w"`
+	UploadHeight     int    `json:"h"`
+	ThumbnailWidth   int    `json:"tn_w"`
+	ThumbnailHeight  int    `json:"tn_h"`
+	boardDir         string
+}
+
+func (f *PostFile) ThumbnailPath() string {
+	thumbnail, _ := uploads.GetThumbnailFilenames(f.Filename)
+	return config.WebPath(f.boardDir, "thumb", thumbnail)
+}
+
+func (f *PostFile) UploadPath() string {
+	return config.WebPath(f.boardDir, "src", f.Filename)
+}
+
 func (p *Post) TitleText() string {
 	title := "/" + p.BoardDir + "/ - "
 	if p.Subject != "" {
@@ -127,6 +166,38 @@ func (p *Post) Stickied() bool {
 	return p.thread.Stickied
 }
 
+func (p *Post) Anchored() bool {
+	return p.thread.Anchored
+}
+
+func (p *Post) Cyclical() bool {
+	return p.thread.Cyclical
+}
+
+// setPosterID sets the post's per-thread poster ID if the board has ShowPosterID enabled. It is computed from the
+// post's IP every time the post is built, so changing RandomSeed changes the ID of every post when it is rebuilt
+func (p *Post) setPosterID() {
+	if config.GetBoardConfig(p.BoardDir).ShowPosterID {
+		p.PosterID = gcsql.GetPosterID(p.IP.String(), p.thread.ID)
+	}
+}
+
+// setEmbed sets the URLs of the external site's player and media page if the post has an embed
+func (p *Post) setEmbed() {
+	if provider := uploads.GetEmbedProvider(p.Filename); provider != nil {
+		p.EmbedURL = provider.EmbedURL(p.OriginalFilename)
+		p.EmbedMediaURL = provider.MediaURL(p.OriginalFilename)
+	}
+}
+
+// setCapcode moves the staff role from the tripcode to the capcode if the post was made with a role signature
+func (p *Post) setCapcode(isRoleSignature bool) {
+	if isRoleSignature {
+		p.Capcode = p.Tripcode
+		p.Tripcode = ""
+	}
+}
+
 func QueryPosts(query string, params []any, cb func(*Post) error) error {
 	rows, err := gcsql.QuerySQL(query, params...)
 	if err != nil {
@@ -135,6 +206,9 @@ func QueryPosts(query string, params []any, cb func(*Post) error) error {
 	defer rows.Close()
 	dbType := config.GetSystemCriticalConfig().DBtype
 
+	// extra files are fetched after all of the posts have been read so that only one query is needed
+	var posts []*Post
+	var postIDsWithFiles []int
 	for rows.Next() {
 		var post Post
 		dest := []any{&post.ID, &post.thread.ID}
@@ -145,12 +219,14 @@ func QueryPosts(query string, params []any, cb func(*Post) error) error {
 			dest = append(dest, &ip)
 		}
 		var lastBump time.Time
+		var anonymousName string
+		var isRoleSignature bool
 		dest = append(dest,
-			&post.Name, &post.Tripcode, &post.Email, &post.Subject, &post.Timestamp,
-			&post.LastModified, &post.ParentID, &lastBump, &post.Message, &post.MessageRaw, &post.BoardDir,
+			&post.Name, &post.Tripcode, &isRoleSignature, &post.Email, &post.Subject, &post.Timestamp,
+			&post.LastModified, &post.ParentID, &lastBump, &post.Message, &post.MessageRaw, &post.BoardDir, &anonymousName,
 			&post.OriginalFilename, &post.Filename, &post.Checksum, &post.Filesize,
 			&post.ThumbnailWidth, &post.ThumbnailHeight, &post.UploadWidth, &post.UploadHeight,
-			&post.thread.Locked, &post.thread.Stickied, &post.Country.Flag, &post.Country.Name)
+			&post.thread.Locked, &post.thread.Stickied, &post.thread.Anchored, &post.thread.Cyclical, &post.Country.Flag, &post.Country.Name)
 
 		if err = rows.Scan(dest...); err != nil {
 			return err
@@ -165,11 +241,62 @@ func QueryPosts(query string, params []any, cb func(*Post) error) error {
 		if post.Filename != "" {
 			post.Extension = path.Ext(post.Filename)
 		}
-		if err = cb(&post); err != nil {
+		post.setPosterID()
+		post.setEmbed()
+		if post.Name == "" {
+			post.Name = anonymousName
+		}
+		post.setCapcode(isRoleSignature)
+		posts = append(posts, &post)
+		if post.Filename != "" && post.Filename != "deleted" {
+			postIDsWithFiles = append(postIDsWithFiles, post.ID)
+		}
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+	if err = setExtraFiles(posts, postIDsWithFiles); err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if err = cb(post); err != nil {
 			return err
 		}
 	}
-	return rows.Close()
+	return nil
+}
+
+// setExtraFiles gets the uploads of the posts with the given IDs and sets each post's ExtraFiles to the uploads
+// after the first one
+func setExtraFiles(posts []*Post, postIDs []int) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+	postUploads, err := gcsql.GetUploadsByPostIDs(postIDs...)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		uploadsList := postUploads[post.ID]
+		if len(uploadsList) < 2 {
+			continue
+		}
+		for _, upload := range uploadsList[1:] {
+			post.ExtraFiles = append(post.ExtraFiles, &PostFile{
+				Filename:         upload.Filename,
+				OriginalFilename: upload.OriginalFilename,
+				Checksum:         upload.Checksum,
+				Extension:        path.Ext(upload.Filename),
+				Filesize:         upload.FileSize,
+				UploadWidth:      upload.Width,
+				UploadHeight:     upload.Height,
+				ThumbnailWidth:   upload.ThumbnailWidth,
+				ThumbnailHeight:  upload.ThumbnailHeight,
+				boardDir:         post.BoardDir,
+			})
+		}
+	}
+	return nil
 }
 
 func GetBuildablePost(id int, _ int) (*Post, error) {
@@ -177,6 +304,8 @@ func GetBuildablePost(id int, _ int) (*Post, error) {
 
 	var post Post
 	var lastBump time.Time
+	var anonymousName string
+	var isRoleSignature bool
 	var ip string
 	out := []any{&post.ID, &post.thread.ID}
 	dbType := config.GetSystemCriticalConfig().DBtype
@@ -185,11 +314,11 @@ func GetBuildablePost(id int, _ int) (*Post, error) {
 	} else {
 		out = append(out, &ip)
 	}
-	out = append(out, &post.Name, &post.Tripcode, &post.Email, &post.Subject, &post.Timestamp,
-		&post.LastModified, &post.ParentID, lastBump, &post.Message, &post.MessageRaw, &post.BoardID, &post.BoardDir,
+	out = append(out, &post.Name, &post.Tripcode, &isRoleSignature, &post.Email, &post.Subject, &post.Timestamp,
+		&post.LastModified, &post.ParentID, lastBump, &post.Message, &post.MessageRaw, &post.BoardID, &post.BoardDir, &anonymousName,
 		&post.OriginalFilename, &post.Filename, &post.Checksum, &post.Filesize,
 		&post.ThumbnailWidth, &post.ThumbnailHeight, &post.UploadWidth, &post.UploadHeight,
-		&post.thread.Locked, &post.thread.Stickied, &post.Country.Flag, &post.Country.Name)
+		&post.thread.Locked, &post.thread.Stickied, &post.thread.Anchored, &post.thread.Cyclical, &post.Country.Flag, &post.Country.Name)
 
 	err := gcsql.QueryRowSQL(query, []any{id}, out)
 	if err != nil {
@@ -203,6 +332,12 @@ func GetBuildablePost(id int, _ int) (*Post, error) {
 	}
 	post.IsTopPost = post.ParentID == 0
 	post.Extension = path.Ext(post.Filename)
+	post.setPosterID()
+	post.setEmbed()
+	if post.Name == "" {
+		post.Name = anonymousName
+	}
+	post.setCapcode(isRoleSignature)
 	return &post, nil
 }
 
@@ -220,6 +355,29 @@ func GetBuildablePostsByIP(ip string, limit int) ([]*Post, error) {
 	return posts, err
 }
 
+// GetBuildablePostsByPosterID returns the posts in the thread with the given OP post that have the given poster ID.
+// If the thread isn't on the board with the given ID, gcsql.ErrThreadDoesNotExist is returned
+func GetBuildablePostsByPosterID(boardID int, opID int, posterID string) ([]*Post, error) {
+	threadID, err := gcsql.GetTopPostThreadID(opID)
+	if err != nil {
+		return nil, err
+	}
+	const query = postQueryBase + " AND DBPREFIXposts.thread_id = ? AND t.board_id = ? ORDER BY DBPREFIXposts.id DESC"
+	var posts []*Post
+	var found bool
+	err = QueryPosts(query, []any{threadID, boardID}, func(p *Post) error {
+		found = true
+		if gcsql.GetPosterID(p.IP.String(), threadID) == posterID {
+			posts = append(posts, p)
+		}
+		return nil
+	})
+	if err == nil && !found {
+		err = gcsql.ErrThreadDoesNotExist
+	}
+	return posts, err
+}
+
 func getThreadPosts(thread *gcsql.Thread) ([]*Post, error) {
 	const query = postQueryBase + " AND DBPREFIXposts.thread_id = ? ORDER BY DBPREFIXposts.id ASC"
 	var posts []*Post
@@ -227,26 +385,52 @@ func getThreadPosts(thread *gcsql.Thread) ([]*Post, error) {
 		posts = append(posts, p)
 		return nil
 	})
-	return posts, err
+	if err != nil {
+		return nil, err
+	}
+	setReplies(posts)
+	return posts, nil
+}
+
+// setReplies sets the Replies field of each post to the IDs of the posts in the list that link to it. It uses
+// the already formatted messages, so no queries are needed
+func setReplies(posts []*Post) {
+	postsByID := make(map[int]*Post, len(posts))
+	for _, post := range posts {
+		postsByID[post.ID] = post
+	}
+	for _, post := range posts {
+		seen := make(map[int]bool)
+		for _, match := range postRefRE.FindAllStringSubmatch(string(post.Message), -1) {
+			quotedID, err := strconv.Atoi(match[1])
+			if err != nil || quotedID == post.ID || seen[quotedID] {
+				continue
+			}
+			seen[quotedID] = true
+			if quoted, ok := postsByID[quotedID]; ok {
+				quoted.Replies = append(quoted.Replies, post.ID)
+			}
+		}
+	}
 }
 
-func GetRecentPosts(boardid int, limit int) ([]*Post, error) {
+// GetRecentPosts returns the most recent posts, limited to the given board IDs if any are set
+func GetRecentPosts(limit int, boardIDs ...int) ([]*Post, error) {
 	query := postQueryBase
 	var args []any
 
-	if boardid > 0 {
-		query += " WHERE t.board_id = ?"
-		args = append(args, boardid)
+	if len(boardIDs) > 0 {
+		query += " AND t.board_id IN (" + strings.Repeat("?,", len(boardIDs)-1) + "?)"
+		for _, boardID := range boardIDs {
+			args = append(args, boardID)
+		}
 	}
 
 	query += " ORDER BY DBPREFIXposts.id DESC LIMIT " + strconv.Itoa(limit)
 
 	var posts []*Post
 	err := QueryPosts(query, args, func(post *Post) error {
-		if boardid == 0 || post.BoardID == boardid {
-			post.Extension = path.Ext(post.Filename)
-			posts = append(posts, post)
-		}
+		posts = append(posts, post)
 		return nil
 	})
 	return posts, err
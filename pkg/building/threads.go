@@ -76,6 +76,11 @@ func BuildThreadPages(op *gcsql.Post) error {
 		errEv.Err(err).Caller().Send()
 		return errors.New("failed getting thread posts")
 	}
+	imageCount, err := thread.GetReplyFileCount()
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to get thread upload count")
+		return errors.New("unable to get thread upload count")
+	}
 	criticalCfg := config.GetSystemCriticalConfig()
 	os.Remove(path.Join(criticalCfg.DocumentRoot, board.Dir, "res", strconv.Itoa(op.ID)+".html"))
 	os.Remove(path.Join(criticalCfg.DocumentRoot, board.Dir, "res", strconv.Itoa(op.ID)+".json"))
@@ -94,17 +99,23 @@ func BuildThreadPages(op *gcsql.Post) error {
 	errEv.Int("op", posts[0].ID)
 
 	// render thread page
-	captchaCfg := config.GetSiteConfig().Captcha
+	siteCfg := config.GetSiteConfig()
+	captchaCfg := siteCfg.Captcha
+	boardConfig := config.GetBoardConfig(board.Dir)
 	if err = serverutil.MinifyTemplate(gctemplates.ThreadPage, map[string]interface{}{
-		"boards":      gcsql.AllBoards,
-		"board":       board,
-		"boardConfig": config.GetBoardConfig(board.Dir),
-		"sections":    gcsql.AllSections,
-		"posts":       posts[1:],
-		"op":          posts[0],
-		"thread":      thread,
-		"useCaptcha":  captchaCfg.UseCaptcha() && !captchaCfg.OnlyNeededForThreads,
-		"captcha":     captchaCfg,
+		"boards":           gcsql.AllBoards,
+		"board":            board,
+		"boardConfig":      boardConfig,
+		"sections":         gcsql.AllSections,
+		"posts":            posts[1:],
+		"op":               posts[0],
+		"thread":           thread,
+		"bumpLimit":        board.BumpLimitReached(len(posts) - 1),
+		"imageLimit":       board.ImageLimitReached(imageCount),
+		"useCaptcha":       boardConfig.ShowCaptchaOnPage(siteCfg, true),
+		"blocklistCaptcha": !boardConfig.CaptchaPolicy.ShowOnPage(&captchaCfg, true),
+		"captchaMode":      boardConfig.CaptchaPolicy.GetMode(&captchaCfg),
+		"captcha":          captchaCfg,
 	}, threadPageFile, "text/html"); err != nil {
 		errEv.Err(err).Caller().Send()
 		return fmt.Errorf("failed building /%s/res/%d threadpage: %s", board.Dir, posts[0].ID, err.Error())
@@ -26,6 +26,8 @@ var (
 
 	boardConfigs    = map[string]BoardConfig{}
 	acceptedDrivers = []string{"mysql", "postgres", "sqlite3"}
+	// rateLimitRoutes are the routes that can be set in RateLimits.Routes
+	rateLimitRoutes = []string{"post", "util", "manage", "captcha"}
 )
 
 type GochanConfig struct {
@@ -95,6 +97,73 @@ func (gcfg *GochanConfig) ValidateValues() error {
 		}
 	}
 
+	boardChanged, err := gcfg.BoardConfig.validateValues()
+	if err != nil {
+		return err
+	}
+	changed = changed || boardChanged
+
+	if gcfg.Blocklists.DNSTimeoutSeconds < 1 {
+		gcfg.Blocklists.DNSTimeoutSeconds = defaultGochanConfig.Blocklists.DNSTimeoutSeconds
+		changed = true
+	}
+	if gcfg.Blocklists.CacheMinutes < 1 {
+		gcfg.Blocklists.CacheMinutes = defaultGochanConfig.Blocklists.CacheMinutes
+		changed = true
+	}
+	if gcfg.Blocklists.ReloadMinutes < 0 {
+		return &InvalidValueError{
+			Field:   "Blocklists.ReloadMinutes",
+			Value:   gcfg.Blocklists.ReloadMinutes,
+			Details: "must be 0 or greater",
+		}
+	}
+
+	for route, limit := range gcfg.RateLimits.Routes {
+		found = false
+		for _, validRoute := range rateLimitRoutes {
+			if route == validRoute {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &InvalidValueError{
+				Field:   "RateLimits.Routes",
+				Value:   route,
+				Details: "valid routes are " + strings.Join(rateLimitRoutes, ", "),
+			}
+		}
+		if limit.Requests < 0 || limit.PerSeconds < 0 {
+			return &InvalidValueError{
+				Field:   "RateLimits.Routes." + route,
+				Value:   limit,
+				Details: "Requests and PerSeconds must be 0 or greater",
+			}
+		}
+	}
+	if gcfg.Captcha.Type == "recaptchav3" && gcfg.Captcha.MinScore <= 0 {
+		gcfg.Captcha.MinScore = defaultGochanConfig.Captcha.MinScore
+		changed = true
+	}
+
+	if gcfg.Captcha.Type == "image" {
+		defaultCaptcha := defaultGochanConfig.Captcha
+		if gcfg.Captcha.ImageLength < 1 {
+			gcfg.Captcha.ImageLength = defaultCaptcha.ImageLength
+			changed = true
+		}
+		if gcfg.Captcha.ImageWidth < 1 || gcfg.Captcha.ImageHeight < 1 {
+			gcfg.Captcha.ImageWidth = defaultCaptcha.ImageWidth
+			gcfg.Captcha.ImageHeight = defaultCaptcha.ImageHeight
+			changed = true
+		}
+		if gcfg.Captcha.ImageExpireMinutes < 1 {
+			gcfg.Captcha.ImageExpireMinutes = defaultCaptcha.ImageExpireMinutes
+			changed = true
+		}
+	}
+
 	if !changed {
 		return nil
 	}
@@ -127,6 +196,12 @@ type SystemCriticalConfig struct {
 	LogDir         string
 	Plugins        []string
 	PluginSettings map[string]any
+	// TrustedProxies are the IPs and CIDR ranges of reverse proxies that are trusted to set the X-Forwarded-For
+	// header and send PROXY protocol headers
+	TrustedProxies []string
+	// ProxyProtocol accepts PROXY protocol (v1 or v2) headers from trusted proxies, which must send one at the
+	// start of every connection
+	ProxyProtocol bool
 
 	SiteHeaderURL string
 	WebRoot       string
@@ -139,7 +214,9 @@ type SystemCriticalConfig struct {
 	DBpassword string
 	DBprefix   string
 
-	Verbose    bool `json:"DebugMode"`
+	Verbose bool `json:"DebugMode"`
+	// RandomSeed is the key used for secure tripcodes and poster IDs, so changing it changes all of them. If it
+	// isn't set, a new one is generated and saved to the config file
 	RandomSeed string
 	Version    *GochanVersion `json:"-"`
 	TimeZone   int            `json:"-"`
@@ -167,20 +244,162 @@ type SiteConfig struct {
 	GeoIPType    string
 	GeoIPOptions map[string]any
 	Captcha      CaptchaConfig
+	Blocklists   BlocklistConfig
+	RateLimits   RateLimitConfig
 
 	FingerprintVideoThumbnails bool
 	FingerprintHashLength      int
 }
 
 type CaptchaConfig struct {
+	// Type is the ID of the CAPTCHA provider to use. The built in providers are "hcaptcha", "recaptcha"
+	// (reCAPTCHA v2), "recaptchav3", "turnstile" (Cloudflare Turnstile), "image" (a self-hosted distorted text
+	// image that doesn't need an account or network access), and "pow" (a proof-of-work puzzle solved by the
+	// poster's browser). Plugins can register others
 	Type                 string
 	OnlyNeededForThreads bool
 	SiteKey              string
 	AccountSecret        string
+	// VerifyURL overrides the URL that hCaptcha, reCAPTCHA, and Turnstile responses are sent to to be checked
+	VerifyURL string
+	// MinScore is the lowest reCAPTCHA v3 score (from 0.0 to 1.0) that is accepted
+	MinScore float64
+
+	// ImageLength is the number of characters in an image CAPTCHA
+	ImageLength int
+	// ImageWidth and ImageHeight set the size of an image CAPTCHA in pixels
+	ImageWidth  int
+	ImageHeight int
+	// ImageExpireMinutes is the number of minutes an image CAPTCHA can be solved in after it is generated
+	ImageExpireMinutes int
 }
 
+// UseCaptcha returns true if the CAPTCHA is configured and posters should be required to solve it
 func (cc *CaptchaConfig) UseCaptcha() bool {
-	return cc.SiteKey != "" && cc.AccountSecret != ""
+	switch cc.Type {
+	case "":
+		return false
+	case "hcaptcha", "recaptcha", "recaptchav3", "turnstile":
+		return cc.SiteKey != "" && cc.AccountSecret != ""
+	}
+	return true
+}
+
+// BlocklistConfig sets the DNS blocklists and local IP lists that posters' IPs are checked against. What happens
+// to posts from listed IPs is set per board with BlocklistAction
+type BlocklistConfig struct {
+	// DNSBLZones are the DNSBL zones to look up IPs in, e.g. "dnsbl.dronebl.org"
+	DNSBLZones []string
+	// DNSResolver is the address (host:port) of the DNS server to send DNSBL lookups to. If it is empty, the
+	// system's resolver is used
+	DNSResolver string
+	// DNSTimeoutSeconds is how long to wait for a DNSBL lookup before allowing the post
+	DNSTimeoutSeconds int
+	// CacheMinutes is how long the result of an IP's DNSBL lookups is cached
+	CacheMinutes int
+	// LocalLists are paths to files with one IP address or CIDR range per line, such as Tor exit node lists.
+	// Blank lines and lines starting with # are ignored
+	LocalLists []string
+	// ReloadMinutes is how often the local lists are reloaded. If it is 0, they are only loaded at startup
+	ReloadMinutes int
+}
+
+// UseBlocklists returns true if any DNSBL zones or local lists are configured
+func (bc *BlocklistConfig) UseBlocklists() bool {
+	return len(bc.DNSBLZones) > 0 || len(bc.LocalLists) > 0
+}
+
+// RateLimit sets how many requests an IP can make in a period of time. Up to Requests requests can be made at
+// once, after which they are allowed at a rate of Requests every PerSeconds seconds. If either value is 0, there
+// is no limit
+type RateLimit struct {
+	Requests   int
+	PerSeconds int
+}
+
+// Enabled returns true if requests should be limited
+func (rl *RateLimit) Enabled() bool {
+	return rl.Requests > 0 && rl.PerSeconds > 0
+}
+
+// RefillRate returns the number of requests per second that are allowed after the limit has been reached
+func (rl *RateLimit) RefillRate() float64 {
+	if !rl.Enabled() {
+		return 0
+	}
+	return float64(rl.Requests) / float64(rl.PerSeconds)
+}
+
+// RateLimitConfig sets the limits on requests to the post, util, manage, and captcha routes. Limits on posts to a
+// specific board are set with the board's PostRateLimit
+type RateLimitConfig struct {
+	// Routes maps "post", "util", "manage", and "captcha" to the rate limit for that route. Routes without a limit
+	// (all of them by default) aren't limited. Limits are per IP, so if gochan is behind a reverse proxy, it has to
+	// be in TrustedProxies or every request will count against the proxy's IP
+	Routes map[string]RateLimit
+	// SharedInDB stores the limits in the database instead of in memory, so that they are shared by every gochan
+	// instance using it
+	SharedInDB bool
+}
+
+const (
+	// CaptchaPolicyNever never requires a CAPTCHA on the board
+	CaptchaPolicyNever = "never"
+	// CaptchaPolicyThreads only requires a CAPTCHA for new threads
+	CaptchaPolicyThreads = "threads"
+	// CaptchaPolicyAlways requires a CAPTCHA for all posts
+	CaptchaPolicyAlways = "always"
+	// CaptchaPolicyNewIPs requires a CAPTCHA from IPs with fewer than MinApprovedPosts approved posts on the board
+	CaptchaPolicyNewIPs = "newips"
+	// CaptchaPolicyFlood requires a CAPTCHA while the board is being flooded
+	CaptchaPolicyFlood = "flood"
+)
+
+// CaptchaPolicy sets when posters on a board have to solve the site's CAPTCHA
+type CaptchaPolicy struct {
+	// Mode is "never", "threads", "always", "newips", or "flood". If it is empty, the site's
+	// Captcha.OnlyNeededForThreads setting is used to choose between "threads" and "always"
+	Mode string
+	// MinApprovedPosts is the number of approved posts an IP needs on the board to post without a CAPTCHA in
+	// "newips" mode
+	MinApprovedPosts int
+	// FloodPosts and FloodSeconds set when the board is considered flooded in "flood" mode: if more than
+	// FloodPosts posts have been made in the last FloodSeconds seconds
+	FloodPosts   int
+	FloodSeconds int
+}
+
+// GetMode returns the mode to use, taking the site's CAPTCHA configuration into account. It returns "never" if
+// the site doesn't use a CAPTCHA
+func (cp *CaptchaPolicy) GetMode(captchaCfg *CaptchaConfig) string {
+	if !captchaCfg.UseCaptcha() {
+		return CaptchaPolicyNever
+	}
+	switch cp.Mode {
+	case "":
+		if captchaCfg.OnlyNeededForThreads {
+			return CaptchaPolicyThreads
+		}
+		return CaptchaPolicyAlways
+	case CaptchaPolicyNever, CaptchaPolicyThreads, CaptchaPolicyNewIPs, CaptchaPolicyFlood:
+		return cp.Mode
+	default:
+		return CaptchaPolicyAlways
+	}
+}
+
+// ShowOnPage returns true if the CAPTCHA should be added to the post form on a board page (if threadPage is false)
+// or thread page. In "newips" and "flood" mode it is shown because it may be required, depending on the poster
+// and how busy the board is
+func (cp *CaptchaPolicy) ShowOnPage(captchaCfg *CaptchaConfig, threadPage bool) bool {
+	switch cp.GetMode(captchaCfg) {
+	case CaptchaPolicyNever:
+		return false
+	case CaptchaPolicyThreads:
+		return !threadPage
+	default:
+		return true
+	}
 }
 
 type BoardCooldowns struct {
@@ -213,6 +432,8 @@ type BoardConfig struct {
 	Worksafe               bool
 	ThreadPage             int
 	Cooldowns              BoardCooldowns
+	CaptchaPolicy          CaptchaPolicy
+	PostRateLimit          RateLimit
 	RenderURLsAsLinks      bool
 	ThreadsPerPage         int
 	EnableGeoIP            bool
@@ -221,6 +442,83 @@ type BoardConfig struct {
 	isGlobal               bool
 }
 
+// validateValues checks the settings that can also be set in a board's board.json, replacing unusable values
+// with the defaults where possible. It returns true if any values were changed
+func (bc *BoardConfig) validateValues() (bool, error) {
+	changed := false
+	switch bc.MessageFormat {
+	case "", "bbcode", "markdown", "plain":
+	default:
+		return false, &InvalidValueError{
+			Field:   "MessageFormat",
+			Value:   bc.MessageFormat,
+			Details: `valid values are "bbcode", "markdown", or "plain"`,
+		}
+	}
+
+	if bc.R9KMuteSeconds < 1 {
+		bc.R9KMuteSeconds = defaultGochanConfig.R9KMuteSeconds
+		changed = true
+	}
+
+	if bc.PowDifficulty < 0 || bc.PowDifficulty > 32 {
+		return false, &InvalidValueError{
+			Field:   "PowDifficulty",
+			Value:   bc.PowDifficulty,
+			Details: "must be between 0 and 32",
+		}
+	}
+
+	switch bc.BlocklistAction {
+	case "", "reject", "captcha", "hold", "none":
+	default:
+		return false, &InvalidValueError{
+			Field:   "BlocklistAction",
+			Value:   bc.BlocklistAction,
+			Details: `valid values are "reject", "captcha", "hold", or "none"`,
+		}
+	}
+
+	if bc.PostRateLimit.Requests < 0 || bc.PostRateLimit.PerSeconds < 0 {
+		return false, &InvalidValueError{
+			Field:   "PostRateLimit",
+			Value:   bc.PostRateLimit,
+			Details: "Requests and PerSeconds must be 0 or greater",
+		}
+	}
+
+	switch bc.CaptchaPolicy.Mode {
+	case "", CaptchaPolicyNever, CaptchaPolicyThreads, CaptchaPolicyAlways, CaptchaPolicyNewIPs, CaptchaPolicyFlood:
+	default:
+		return false, &InvalidValueError{
+			Field:   "CaptchaPolicy.Mode",
+			Value:   bc.CaptchaPolicy.Mode,
+			Details: `valid values are "never", "threads", "always", "newips", or "flood"`,
+		}
+	}
+	if bc.CaptchaPolicy.MinApprovedPosts < 1 {
+		bc.CaptchaPolicy.MinApprovedPosts = defaultGochanConfig.CaptchaPolicy.MinApprovedPosts
+		changed = true
+	}
+	if bc.CaptchaPolicy.FloodPosts < 1 || bc.CaptchaPolicy.FloodSeconds < 1 {
+		bc.CaptchaPolicy.FloodPosts = defaultGochanConfig.CaptchaPolicy.FloodPosts
+		bc.CaptchaPolicy.FloodSeconds = defaultGochanConfig.CaptchaPolicy.FloodSeconds
+		changed = true
+	}
+	return changed, nil
+}
+
+// ShowCaptchaOnPage returns true if the CAPTCHA should be added to the board's post form on a board page (if
+// threadPage is false) or thread page, either because of the board's CAPTCHA policy or because posters on a
+// blocklist have to solve it (see BlocklistAction). Pages are the same for every poster, so in the second case
+// it is shown to everyone
+func (bc *BoardConfig) ShowCaptchaOnPage(siteCfg *SiteConfig, threadPage bool) bool {
+	if bc.CaptchaPolicy.ShowOnPage(&siteCfg.Captcha, threadPage) {
+		return true
+	}
+	return bc.BlocklistAction == "captcha" && siteCfg.Captcha.UseCaptcha() && siteCfg.Blocklists.UseBlocklists()
+}
+
 // CheckCustomFlag returns true if the given flag and name are configured for
 // the board (or are globally set)
 func (bc *BoardConfig) CheckCustomFlag(flag string) (string, bool) {
@@ -246,12 +544,20 @@ type Style struct {
 
 type UploadConfig struct {
 	RejectDuplicateImages bool
-	ThumbWidth            int
-	ThumbHeight           int
-	ThumbWidthReply       int
-	ThumbHeightReply      int
-	ThumbWidthCatalog     int
-	ThumbHeightCatalog    int
+	// Sets how uploads are matched if RejectDuplicateImages is true. Valid values are "checksum" (the default, only
+	// identical files are rejected) and "fingerprint" (visually similar images are rejected, using the same perceptual
+	// hash as fingerprint bans)
+	DuplicateImageMode string
+	// The maximum number of files that can be attached to a single post. If it is less than 1, only one file
+	// is allowed
+	MaxFilesPerPost int
+
+	ThumbWidth         int
+	ThumbHeight        int
+	ThumbWidthReply    int
+	ThumbHeightReply   int
+	ThumbWidthCatalog  int
+	ThumbHeightCatalog int
 
 	AllowOtherExtensions map[string]string
 
@@ -305,7 +611,49 @@ type PostConfig struct {
 	EnableEmbeds     bool
 	ImagesOpenNewTab bool
 	NewTabOnOutlinks bool
-	DisableBBcode    bool
+	// Deprecated: set MessageFormat to "plain" instead
+	DisableBBcode bool
+	// MessageFormat sets the markup used to format post messages. Valid values are "bbcode" (the default),
+	// "markdown", and "plain"
+	MessageFormat string
+
+	// R9KMode rejects posts whose text (ignoring case, punctuation, and whitespace) or uploaded files have
+	// already been posted on the board. Each rejection mutes the poster on the board for R9KMuteSeconds, doubled
+	// for every previous mute
+	R9KMode        bool
+	R9KMuteSeconds int
+
+	// PremoderateNewThreads, PremoderateNewIPs, and PremoderateLinks hold new threads, posts from IPs that
+	// haven't had a post approved on the board yet, and posts containing links (respectively) until they are
+	// approved by a janitor. Posts made by logged in staff are never held
+	PremoderateNewThreads bool
+	PremoderateNewIPs     bool
+	PremoderateLinks      bool
+
+	// PowDifficulty is the number of leading zero bits required in the solution to a proof-of-work CAPTCHA
+	// for posts on the board. It is increased for posters who have posted recently
+	PowDifficulty int
+
+	// BlocklistAction is what happens to posts from IPs on one of the site's blocklists. Valid values are
+	// "reject" (the default), "captcha" (require the CAPTCHA regardless of the board's CAPTCHA policy), "hold"
+	// (hold the post for approval), and "none"
+	BlocklistAction string
+}
+
+// GetMessageFormat returns the markup used to format post messages, taking the deprecated DisableBBcode
+// setting into account
+func (pc *PostConfig) GetMessageFormat() string {
+	switch pc.MessageFormat {
+	case "":
+		if pc.DisableBBcode {
+			return "plain"
+		}
+		return "bbcode"
+	case "bbcode", "markdown", "plain":
+		return pc.MessageFormat
+	default:
+		return "bbcode"
+	}
 }
 
 func WriteConfig() error {
@@ -349,6 +697,9 @@ func UpdateBoardConfig(dir string) error {
 	if err = json.Unmarshal(ba, &boardcfg); err != nil {
 		return err
 	}
+	if _, err = boardcfg.validateValues(); err != nil {
+		return err
+	}
 	boardcfg.isGlobal = false
 	boardConfigs[dir] = boardcfg
 	return nil
@@ -389,6 +740,15 @@ func SetTestTemplateDir(dir string) {
 	cfg.TemplateDir = dir
 }
 
+// SetTestDocumentRoot sets the document root, used only in testing. If it is not run via `go test`, it will panic.
+func SetTestDocumentRoot(dir string) {
+	testutil.PanicIfNotTest()
+	if cfg == nil {
+		cfg = defaultGochanConfig
+	}
+	cfg.DocumentRoot = dir
+}
+
 // SetTestDBConfig sets up the database configuration for a testing environment. If it is not run via `go test`, it will panic
 func SetTestDBConfig(dbType string, dbHost string, dbName string, dbUsername string, dbPassword string, dbPrefix string) {
 	testutil.PanicIfNotTest()
@@ -406,5 +766,8 @@ func SetTestDBConfig(dbType string, dbHost string, dbName string, dbUsername str
 // SetRandomSeed is usd to set a deterministic seed to make testing easier. If it is not run via `go test`, it will panic
 func SetRandomSeed(seed string) {
 	testutil.PanicIfNotTest()
+	if cfg == nil {
+		cfg = defaultGochanConfig
+	}
 	cfg.RandomSeed = seed
 }
@@ -2,6 +2,8 @@ package config
 
 import (
 	"encoding/json"
+	"os"
+	"path"
 	"strings"
 	"testing"
 
@@ -19,3 +21,91 @@ func TestValidJSON(t *testing.T) {
 	err := json.NewDecoder(strings.NewReader(validCfgJSON)).Decode(&c)
 	assert.Nil(t, err)
 }
+
+func TestCaptchaPolicyMode(t *testing.T) {
+	captchaCfg := &CaptchaConfig{Type: "image"}
+	var policy CaptchaPolicy
+	assert.Equal(t, CaptchaPolicyAlways, policy.GetMode(captchaCfg))
+	assert.True(t, policy.ShowOnPage(captchaCfg, true))
+
+	captchaCfg.OnlyNeededForThreads = true
+	assert.Equal(t, CaptchaPolicyThreads, policy.GetMode(captchaCfg),
+		"OnlyNeededForThreads should be used if the board doesn't set a mode")
+	assert.True(t, policy.ShowOnPage(captchaCfg, false))
+	assert.False(t, policy.ShowOnPage(captchaCfg, true))
+
+	policy.Mode = CaptchaPolicyNewIPs
+	assert.Equal(t, CaptchaPolicyNewIPs, policy.GetMode(captchaCfg))
+	assert.True(t, policy.ShowOnPage(captchaCfg, true))
+
+	policy.Mode = CaptchaPolicyNever
+	assert.False(t, policy.ShowOnPage(captchaCfg, false))
+
+	captchaCfg.Type = ""
+	policy.Mode = CaptchaPolicyAlways
+	assert.Equal(t, CaptchaPolicyNever, policy.GetMode(captchaCfg), "mode should be never if the site has no CAPTCHA")
+}
+
+func TestDeprecatedDisableBBcode(t *testing.T) {
+	postCfg := defaultGochanConfig.PostConfig
+	assert.NoError(t, json.Unmarshal([]byte(`{"DisableBBcode": true}`), &postCfg))
+	assert.Equal(t, "plain", postCfg.GetMessageFormat(),
+		"DisableBBcode should still disable bbcode if MessageFormat isn't set")
+
+	postCfg.MessageFormat = "markdown"
+	assert.Equal(t, "markdown", postCfg.GetMessageFormat())
+}
+
+func TestUpdateBoardConfigValidation(t *testing.T) {
+	SetVersion("4.0.0")
+	oldDocumentRoot := cfg.DocumentRoot
+	SetTestDocumentRoot(t.TempDir())
+	defer SetTestDocumentRoot(oldDocumentRoot)
+	defer DeleteBoardConfig("test")
+
+	boardDir := path.Join(cfg.DocumentRoot, "test")
+	if !assert.NoError(t, os.Mkdir(boardDir, 0755)) {
+		return
+	}
+	writeBoardJSON := func(boardJSON string) {
+		if err := os.WriteFile(path.Join(boardDir, "board.json"), []byte(boardJSON), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeBoardJSON(`{"R9KMuteSeconds": -5, "CaptchaPolicy": {"Mode": "flood", "FloodPosts": 0}}`)
+	if !assert.NoError(t, UpdateBoardConfig("test")) {
+		return
+	}
+	boardCfg := GetBoardConfig("test")
+	assert.Equal(t, defaultGochanConfig.R9KMuteSeconds, boardCfg.R9KMuteSeconds,
+		"invalid values with a default should be replaced")
+	assert.Equal(t, defaultGochanConfig.CaptchaPolicy.FloodPosts, boardCfg.CaptchaPolicy.FloodPosts)
+
+	for _, boardJSON := range []string{
+		`{"PowDifficulty": 64}`,
+		`{"PostRateLimit": {"Requests": -1, "PerSeconds": 10}}`,
+		`{"CaptchaPolicy": {"Mode": "sometimes"}}`,
+		`{"MessageFormat": "html"}`,
+	} {
+		writeBoardJSON(boardJSON)
+		var invalidErr *InvalidValueError
+		assert.ErrorAs(t, UpdateBoardConfig("test"), &invalidErr, boardJSON)
+	}
+}
+
+func TestShowCaptchaOnPage(t *testing.T) {
+	siteCfg := &SiteConfig{Captcha: CaptchaConfig{Type: "image"}}
+	boardCfg := &BoardConfig{CaptchaPolicy: CaptchaPolicy{Mode: CaptchaPolicyNever}}
+	assert.False(t, boardCfg.ShowCaptchaOnPage(siteCfg, false))
+
+	boardCfg.BlocklistAction = "captcha"
+	assert.False(t, boardCfg.ShowCaptchaOnPage(siteCfg, false), "the CAPTCHA shouldn't be shown without any blocklists")
+	siteCfg.Blocklists.DNSBLZones = []string{"dnsbl.example.com"}
+	assert.True(t, boardCfg.ShowCaptchaOnPage(siteCfg, false),
+		"the CAPTCHA should be shown if posters on a blocklist have to solve it")
+	assert.True(t, boardCfg.ShowCaptchaOnPage(siteCfg, true))
+
+	siteCfg.Captcha.Type = ""
+	assert.False(t, boardCfg.ShowCaptchaOnPage(siteCfg, false))
+}
@@ -3,7 +3,8 @@ package config
 var (
 	defaultGochanConfig = &GochanConfig{
 		SystemCriticalConfig: SystemCriticalConfig{
-			WebRoot: "/",
+			WebRoot:        "/",
+			TrustedProxies: []string{"127.0.0.0/8", "::1"},
 		},
 		SiteConfig: SiteConfig{
 			FirstPage:       []string{"index.html", "firstrun.html", "1.html"},
@@ -14,6 +15,18 @@ var (
 			MinifyJS:        true,
 			MaxRecentPosts:  15,
 			EnableAppeals:   true,
+			Captcha: CaptchaConfig{
+				ImageLength:        6,
+				ImageWidth:         240,
+				ImageHeight:        80,
+				ImageExpireMinutes: 15,
+				MinScore:           0.5,
+			},
+			Blocklists: BlocklistConfig{
+				DNSTimeoutSeconds: 2,
+				CacheMinutes:      10,
+				ReloadMinutes:     60,
+			},
 		},
 		BoardConfig: BoardConfig{
 			isGlobal:       true,
@@ -46,8 +59,11 @@ var (
 				EmbedHeight:              164,
 				ImagesOpenNewTab:         true,
 				NewTabOnOutlinks:         true,
+				R9KMuteSeconds:           2,
+				PowDifficulty:            16,
 			},
 			UploadConfig: UploadConfig{
+				MaxFilesPerPost:    1,
 				ThumbWidth:         200,
 				ThumbHeight:        200,
 				ThumbWidthReply:    125,
@@ -61,6 +77,11 @@ var (
 				Reply:      7,
 				ImageReply: 7,
 			},
+			CaptchaPolicy: CaptchaPolicy{
+				MinApprovedPosts: 1,
+				FloodPosts:       30,
+				FloodSeconds:     60,
+			},
 			RenderURLsAsLinks: true,
 		},
 	}
@@ -124,6 +124,10 @@ func InitConfig(versionStr string) {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
+	if err = gcutil.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		fmt.Println("Invalid TrustedProxies value:", err.Error())
+		os.Exit(1)
+	}
 
 	if runtime.GOOS != "windows" {
 		var gcUser *user.User
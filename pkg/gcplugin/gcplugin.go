@@ -14,6 +14,7 @@ import (
 	"github.com/gochan-org/gochan/pkg/gctemplates"
 	"github.com/gochan-org/gochan/pkg/gcutil"
 	"github.com/gochan-org/gochan/pkg/manage"
+	"github.com/gochan-org/gochan/pkg/posting"
 	"github.com/gochan-org/gochan/pkg/posting/geoip"
 	"github.com/gochan-org/gochan/pkg/posting/uploads"
 	"github.com/gochan-org/gochan/pkg/server/serverutil"
@@ -104,6 +105,7 @@ func preloadLua() {
 	lState.PreloadModule("gctemplates", gctemplates.PreloadModule)
 	lState.PreloadModule("geoip", geoip.PreloadModule)
 	lState.PreloadModule("manage", manage.PreloadModule)
+	lState.PreloadModule("posting", posting.PreloadModule)
 	lState.PreloadModule("uploads", uploads.PreloadModule)
 	lState.PreloadModule("serverutil", serverutil.PreloadModule)
 
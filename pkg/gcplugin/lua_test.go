@@ -5,6 +5,7 @@ import (
 
 	"github.com/gochan-org/gochan/pkg/config"
 	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/gochan-org/gochan/pkg/posting"
 	"github.com/stretchr/testify/assert"
 	lua "github.com/yuin/gopher-lua"
 	luar "layeh.com/gopher-luar"
@@ -34,6 +35,15 @@ local system_critical_cfg = config.system_critical_config()
 local site_cfg = config.site_config()
 local board_cfg = config.board_config()
 return { ListenIP = system_critical_cfg.ListenIP, SiteSlogan = site_cfg.SiteSlogan, DefaultStyle = board_cfg.DefaultStyle }`
+
+	postCommandTestingStr = `local posting = require("posting")
+local err = posting.register_command("shout", function(args)
+	if args == "" then
+		return "", "nothing to shout"
+	end
+	return string.upper(args), nil
+end)
+return err, posting.register_command("dice", function(args) return "rigged", nil end)`
 )
 
 func initPluginTests() {
@@ -82,3 +92,12 @@ func TestConfigModule(t *testing.T) {
 	assert.Equal(t, "Gochan testing", returnTable.RawGetString("SiteSlogan").(lua.LString).String())
 	assert.Equal(t, "pipes.css", returnTable.RawGetString("DefaultStyle").(lua.LString).String())
 }
+
+func TestPostingModule(t *testing.T) {
+	initPluginTests()
+	err := lState.DoString(postCommandTestingStr)
+	assert.NoError(t, err)
+	defer posting.UnregisterPostCommand("shout")
+	assert.Equal(t, lua.LNil, lState.Get(-2), "registering a new command should succeed")
+	assert.NotEqual(t, lua.LNil, lState.Get(-1), "registering a command with an existing name should fail")
+}
@@ -401,6 +401,18 @@ func (board *Board) GetThreads(onlyNotDeleted bool, orderLastByBump bool, sticki
 	return threads, nil
 }
 
+// BumpLimitReached returns true if the board has a bump limit (AutosageAfter) and a thread with the given
+// number of replies has reached it
+func (board *Board) BumpLimitReached(replies int) bool {
+	return board.AutosageAfter > 0 && replies >= board.AutosageAfter
+}
+
+// ImageLimitReached returns true if the board has an image limit (NoImagesAfter) and a thread with the given
+// number of uploads has reached it
+func (board *Board) ImageLimitReached(images int) bool {
+	return board.NoImagesAfter > 0 && images >= board.NoImagesAfter
+}
+
 // IsHidden returns true if the board is in a section that is hidden, otherwise false. If it is in a section
 // that is not in the AllSections array, it returns defValueIfMissingSection
 func (board *Board) IsHidden(defValueIfMissingSection bool) bool {
@@ -474,3 +486,28 @@ func (board *Board) WebPath(fileName, fileType string) string {
 	}
 	return filePath
 }
+
+// GetExistingBoardDirs takes a variable number of board directories and returns the ones that belong to a board
+func GetExistingBoardDirs(dirs ...string) ([]string, error) {
+	if len(dirs) == 0 {
+		return nil, nil
+	}
+	params := make([]any, len(dirs))
+	for i, dir := range dirs {
+		params[i] = dir
+	}
+	rows, err := QuerySQL(`SELECT dir FROM DBPREFIXboards WHERE dir IN `+createArrayPlaceholder(params), params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var existing []string
+	for rows.Next() {
+		var dir string
+		if err = rows.Scan(&dir); err != nil {
+			return nil, err
+		}
+		existing = append(existing, dir)
+	}
+	return existing, rows.Close()
+}
@@ -0,0 +1,47 @@
+package gcsql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoardThreadLimits(t *testing.T) {
+	testCases := []struct {
+		desc              string
+		board             Board
+		count             int
+		expectBumpLimit   bool
+		expectImagesLimit bool
+	}{
+		{
+			desc:  "limits disabled",
+			board: Board{AutosageAfter: 0, NoImagesAfter: -1},
+			count: 1000,
+		},
+		{
+			desc:  "below limits",
+			board: Board{AutosageAfter: 500, NoImagesAfter: 150},
+			count: 100,
+		},
+		{
+			desc:              "at limits",
+			board:             Board{AutosageAfter: 150, NoImagesAfter: 150},
+			count:             150,
+			expectBumpLimit:   true,
+			expectImagesLimit: true,
+		},
+		{
+			desc:              "past image limit only",
+			board:             Board{AutosageAfter: 500, NoImagesAfter: 150},
+			count:             200,
+			expectImagesLimit: true,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expectBumpLimit, tC.board.BumpLimitReached(tC.count))
+			assert.Equal(t, tC.expectImagesLimit, tC.board.ImageLimitReached(tC.count))
+		})
+	}
+}
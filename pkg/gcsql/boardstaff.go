@@ -0,0 +1,85 @@
+package gcsql
+
+// GetBoardStaff returns all of the staff board assignments
+func GetBoardStaff() ([]BoardStaff, error) {
+	const query = `SELECT board_id, staff_id FROM DBPREFIXboard_staff ORDER BY staff_id, board_id`
+	rows, err := QuerySQL(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var assignments []BoardStaff
+	for rows.Next() {
+		var bs BoardStaff
+		if err = rows.Scan(&bs.BoardID, &bs.StaffID); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, bs)
+	}
+	return assignments, rows.Close()
+}
+
+// GetBoardIDs returns the IDs of the boards that the staff member has been assigned to. If there are none, the
+// staff member's rank applies to every board
+func (s *Staff) GetBoardIDs() ([]int, error) {
+	const query = `SELECT board_id FROM DBPREFIXboard_staff WHERE staff_id = ? ORDER BY board_id`
+	rows, err := QuerySQL(query, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var boardIDs []int
+	for rows.Next() {
+		var boardID int
+		if err = rows.Scan(&boardID); err != nil {
+			return nil, err
+		}
+		boardIDs = append(boardIDs, boardID)
+	}
+	return boardIDs, rows.Close()
+}
+
+// SetBoards replaces the staff member's board assignments with the given board IDs. If no board IDs are given,
+// the staff member will be able to moderate every board
+func (s *Staff) SetBoards(boardIDs ...int) error {
+	const deleteSQL = `DELETE FROM DBPREFIXboard_staff WHERE staff_id = ?`
+	const insertSQL = `INSERT INTO DBPREFIXboard_staff (board_id, staff_id) VALUES(?,?)`
+	tx, err := BeginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = ExecTxSQL(tx, deleteSQL, s.ID); err != nil {
+		return err
+	}
+	for _, boardID := range boardIDs {
+		if _, err = ExecTxSQL(tx, insertSQL, boardID, s.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CanModerateBoard returns true if the staff member is an administrator, hasn't been assigned to any specific
+// boards, or has been assigned to the board with the given ID
+func (s *Staff) CanModerateBoard(boardID int) (bool, error) {
+	if s.Rank < 1 {
+		return false, nil
+	}
+	if s.Rank == 3 {
+		return true, nil
+	}
+	boardIDs, err := s.GetBoardIDs()
+	if err != nil {
+		return false, err
+	}
+	if len(boardIDs) == 0 {
+		return true, nil
+	}
+	for _, id := range boardIDs {
+		if id == boardID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
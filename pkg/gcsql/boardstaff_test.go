@@ -0,0 +1,88 @@
+package gcsql
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanModerateBoard(t *testing.T) {
+	testCases := []struct {
+		desc           string
+		staff          Staff
+		boardID        int
+		assignedBoards []int
+		expectQuery    bool
+		expectResult   bool
+	}{
+		{
+			desc:    "not staff",
+			staff:   Staff{ID: 1, Rank: 0},
+			boardID: 1,
+		},
+		{
+			desc:         "admin",
+			staff:        Staff{ID: 1, Rank: 3},
+			boardID:      1,
+			expectResult: true,
+		},
+		{
+			desc:         "moderator without assigned boards",
+			staff:        Staff{ID: 2, Rank: 2},
+			boardID:      1,
+			expectQuery:  true,
+			expectResult: true,
+		},
+		{
+			desc:           "moderator assigned to board",
+			staff:          Staff{ID: 2, Rank: 2},
+			boardID:        2,
+			assignedBoards: []int{1, 2},
+			expectQuery:    true,
+			expectResult:   true,
+		},
+		{
+			desc:           "janitor not assigned to board",
+			staff:          Staff{ID: 3, Rank: 1},
+			boardID:        3,
+			assignedBoards: []int{1, 2},
+			expectQuery:    true,
+		},
+	}
+	for _, tC := range testCases {
+		for _, driver := range testingDBDrivers {
+			t.Run(fmt.Sprintf("%s (%s)", tC.desc, driver), func(t *testing.T) {
+				config.SetTestDBConfig(driver, "localhost", "gochan", "gochan", "gochan", "")
+				db, mock, err := sqlmock.New()
+				if !assert.NoError(t, err) {
+					return
+				}
+				if !assert.NoError(t, SetTestingDB(driver, "gochan", "", db)) {
+					return
+				}
+				if tC.expectQuery {
+					query := `SELECT board_id FROM board_staff WHERE staff_id = `
+					if driver == "mysql" {
+						query += `\?`
+					} else {
+						query += `\$1`
+					}
+					rows := sqlmock.NewRows([]string{"board_id"})
+					for _, boardID := range tC.assignedBoards {
+						rows.AddRow(boardID)
+					}
+					mock.ExpectPrepare(query).ExpectQuery().
+						WithArgs(tC.staff.ID).WillReturnRows(rows)
+				}
+				canModerate, err := tC.staff.CanModerateBoard(tC.boardID)
+				assert.NoError(t, err)
+				assert.Equal(t, tC.expectResult, canModerate)
+				assert.NoError(t, mock.ExpectationsWereMet())
+				closeMock(t, mock)
+			})
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package gcsql
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var (
+	ErrPostNotPending = errors.New("post is not awaiting approval")
+)
+
+// InsertPending inserts the post like Insert, but hidden from the board (along with its thread, if it is a new
+// thread) until it is approved by a moderator. The post is inserted and hidden in the same transaction so that it
+// is never visible before it is approved. If bumpThread is true, the thread is bumped when the post is approved
+func (p *Post) InsertPending(reason string, bumpThread bool, boardID int, locked bool, stickied bool, anchored bool, cyclical bool) error {
+	const hidePostSQL = `UPDATE DBPREFIXposts SET is_deleted = TRUE WHERE id = ?`
+	const hideThreadSQL = `UPDATE DBPREFIXthreads SET is_deleted = TRUE WHERE id = ?`
+	const insertSQL = `INSERT INTO DBPREFIXpending_posts (post_id, reason, bump_thread) VALUES(?,?,?)`
+	tx, err := BeginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// held posts don't bump the thread until they are approved
+	if err = p.insert(tx, false, boardID, locked, stickied, anchored, cyclical); err != nil {
+		return err
+	}
+	if _, err = ExecTxSQL(tx, hidePostSQL, p.ID); err != nil {
+		return err
+	}
+	if p.IsTopPost {
+		if _, err = ExecTxSQL(tx, hideThreadSQL, p.ThreadID); err != nil {
+			return err
+		}
+	}
+	if _, err = ExecTxSQL(tx, insertSQL, p.ID, reason, bumpThread); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	p.IsDeleted = true
+	return nil
+}
+
+// GetPendingPosts returns the posts awaiting approval on the board with the given ID, or on all boards if
+// boardID is 0
+func GetPendingPosts(boardID int) ([]PendingPost, error) {
+	query := `SELECT p.id, p.thread_id, p.is_top_post, IP_NTOA, p.created_on, p.name, p.tripcode, p.email,
+	p.subject, p.message, p.message_raw, pp.reason, pp.bump_thread, b.id, b.dir
+	FROM DBPREFIXpending_posts pp
+	JOIN DBPREFIXposts p ON p.id = pp.post_id
+	JOIN DBPREFIXthreads t ON t.id = p.thread_id
+	JOIN DBPREFIXboards b ON b.id = t.board_id
+	WHERE (p.is_top_post = TRUE OR t.is_deleted = FALSE)`
+	var params []any
+	if boardID > 0 {
+		query += " AND t.board_id = ?"
+		params = append(params, boardID)
+	}
+	query += " ORDER BY p.id"
+	rows, err := QuerySQL(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pending []PendingPost
+	for rows.Next() {
+		var pp PendingPost
+		if err = rows.Scan(
+			&pp.ID, &pp.ThreadID, &pp.IsTopPost, &pp.IP, &pp.CreatedOn, &pp.Name, &pp.Tripcode, &pp.Email,
+			&pp.Subject, &pp.Message, &pp.MessageRaw, &pp.Reason, &pp.BumpThread, &pp.BoardID, &pp.BoardDir,
+		); err != nil {
+			return nil, err
+		}
+		pp.IsDeleted = true
+		pending = append(pending, pp)
+	}
+	return pending, rows.Close()
+}
+
+// ApprovePending makes a post that was held for approval visible, bumping its thread if it was going to be
+// bumped when the post was made, unless the thread has since been anchored or reached the bump limit. Replies to
+// threads that have since been deleted can't be approved
+func (p *Post) ApprovePending() error {
+	const bumpSQL = `SELECT pp.bump_thread, t.is_deleted, t.board_id FROM DBPREFIXpending_posts pp
+	JOIN DBPREFIXposts p ON p.id = pp.post_id
+	JOIN DBPREFIXthreads t ON t.id = p.thread_id
+	WHERE pp.post_id = ?`
+	const showPostSQL = `UPDATE DBPREFIXposts SET is_deleted = FALSE WHERE id = ?`
+	const showThreadSQL = `UPDATE DBPREFIXthreads SET is_deleted = FALSE, last_bump = CURRENT_TIMESTAMP WHERE id = ?`
+	const bumpThreadSQL = `UPDATE DBPREFIXthreads SET last_bump = CURRENT_TIMESTAMP WHERE id = ?`
+	const deleteSQL = `DELETE FROM DBPREFIXpending_posts WHERE post_id = ?`
+	tx, err := BeginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var bumpThread, threadDeleted bool
+	var boardID int
+	err = QueryRowTxSQL(tx, bumpSQL, interfaceSlice(p.ID), interfaceSlice(&bumpThread, &threadDeleted, &boardID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPostNotPending
+	} else if err != nil {
+		return err
+	}
+	if threadDeleted && !p.IsTopPost {
+		// the thread was deleted (or pruned) while the reply was waiting, so it stays deleted
+		if _, err = ExecTxSQL(tx, deleteSQL, p.ID); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		return ErrPostNotPending
+	}
+	if bumpThread && !p.IsTopPost {
+		// checked before the post is shown so that it isn't counted towards the bump limit, like in Insert
+		if bumpThread, err = replyBumpsThread(tx, boardID, p.ThreadID); err != nil {
+			return err
+		}
+	}
+	if _, err = ExecTxSQL(tx, showPostSQL, p.ID); err != nil {
+		return err
+	}
+	if p.IsTopPost {
+		_, err = ExecTxSQL(tx, showThreadSQL, p.ThreadID)
+	} else if bumpThread {
+		_, err = ExecTxSQL(tx, bumpThreadSQL, p.ThreadID)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = ExecTxSQL(tx, deleteSQL, p.ID); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	p.IsDeleted = false
+	return nil
+}
+
+// RejectPending removes the post from the approval queue, leaving it deleted
+func (p *Post) RejectPending() error {
+	const deleteSQL = `DELETE FROM DBPREFIXpending_posts WHERE post_id = ?`
+	result, err := ExecSQL(deleteSQL, p.ID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return ErrPostNotPending
+	}
+	return nil
+}
+
+// IPHasApprovedPosts returns true if the IP has any posts on the board that haven't been deleted or held for
+// approval
+func IPHasApprovedPosts(ip string, boardID int) (bool, error) {
+	count, err := CountApprovedIPPosts(ip, boardID)
+	return count > 0, err
+}
+
+// CountApprovedIPPosts returns the number of posts the IP has on the board that haven't been deleted or held
+// for approval
+func CountApprovedIPPosts(ip string, boardID int) (int, error) {
+	const query = `SELECT COUNT(*) FROM DBPREFIXposts p
+	JOIN DBPREFIXthreads t ON t.id = p.thread_id
+	WHERE p.ip = PARAM_ATON AND t.board_id = ? AND p.is_deleted = FALSE`
+	var count int
+	err := QueryRowSQL(query, interfaceSlice(ip, boardID), interfaceSlice(&count))
+	return count, err
+}
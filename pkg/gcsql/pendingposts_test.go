@@ -0,0 +1,151 @@
+package gcsql
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRejectPending(t *testing.T) {
+	for _, driver := range testingDBDrivers {
+		t.Run(driver, func(t *testing.T) {
+			config.SetTestDBConfig(driver, "localhost", "gochan", "gochan", "gochan", "")
+			db, mock, err := sqlmock.New()
+			if !assert.NoError(t, err) {
+				return
+			}
+			if !assert.NoError(t, SetTestingDB(driver, "gochan", "", db)) {
+				return
+			}
+
+			query := `DELETE FROM pending_posts WHERE post_id = \?`
+			if driver != "mysql" {
+				query = `DELETE FROM pending_posts WHERE post_id = \$1`
+			}
+			mock.ExpectPrepare(query).ExpectExec().WithArgs(2).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectPrepare(query).ExpectExec().WithArgs(3).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+
+			post := &Post{ID: 2}
+			assert.NoError(t, post.RejectPending())
+			post.ID = 3
+			assert.ErrorIs(t, post.RejectPending(), ErrPostNotPending)
+			assert.NoError(t, mock.ExpectationsWereMet())
+			closeMock(t, mock)
+		})
+	}
+}
+
+func TestIPHasApprovedPosts(t *testing.T) {
+	for _, driver := range testingDBDrivers {
+		t.Run(driver, func(t *testing.T) {
+			config.SetTestDBConfig(driver, "localhost", "gochan", "gochan", "gochan", "")
+			db, mock, err := sqlmock.New()
+			if !assert.NoError(t, err) {
+				return
+			}
+			if !assert.NoError(t, SetTestingDB(driver, "gochan", "", db)) {
+				return
+			}
+
+			query := `SELECT COUNT\(\*\) FROM posts p\s+JOIN threads t ON t.id = p.thread_id\s+` +
+				`WHERE p.ip = INET6_ATON\(\?\) AND t.board_id = \? AND p.is_deleted = FALSE`
+			if driver != "mysql" {
+				query = `SELECT COUNT\(\*\) FROM posts p\s+JOIN threads t ON t.id = p.thread_id\s+` +
+					`WHERE p.ip = \$1 AND t.board_id = \$2 AND p.is_deleted = FALSE`
+			}
+			mock.ExpectPrepare(query).ExpectQuery().WithArgs("192.168.56.1", 1).
+				WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(0))
+			hasPosts, err := IPHasApprovedPosts("192.168.56.1", 1)
+			assert.NoError(t, err)
+			assert.False(t, hasPosts)
+			assert.NoError(t, mock.ExpectationsWereMet())
+			closeMock(t, mock)
+		})
+	}
+}
+
+func TestApprovePendingDeletedThread(t *testing.T) {
+	for _, driver := range testingDBDrivers {
+		t.Run(driver, func(t *testing.T) {
+			config.SetTestDBConfig(driver, "localhost", "gochan", "gochan", "gochan", "")
+			db, mock, err := sqlmock.New()
+			if !assert.NoError(t, err) {
+				return
+			}
+			if !assert.NoError(t, SetTestingDB(driver, "gochan", "", db)) {
+				return
+			}
+
+			selectQuery := `SELECT pp.bump_thread, t.is_deleted, t.board_id FROM pending_posts pp\s+` +
+				`JOIN posts p ON p.id = pp.post_id\s+JOIN threads t ON t.id = p.thread_id\s+WHERE pp.post_id = \?`
+			deleteQuery := `DELETE FROM pending_posts WHERE post_id = \?`
+			if driver != "mysql" {
+				selectQuery = `SELECT pp.bump_thread, t.is_deleted, t.board_id FROM pending_posts pp\s+` +
+					`JOIN posts p ON p.id = pp.post_id\s+JOIN threads t ON t.id = p.thread_id\s+WHERE pp.post_id = \$1`
+				deleteQuery = `DELETE FROM pending_posts WHERE post_id = \$1`
+			}
+			mock.ExpectBegin()
+			mock.ExpectPrepare(selectQuery).ExpectQuery().WithArgs(5).
+				WillReturnRows(sqlmock.NewRows([]string{"bump_thread", "is_deleted", "board_id"}).AddRow(true, true, 1))
+			mock.ExpectPrepare(deleteQuery).ExpectExec().WithArgs(5).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			post := &Post{ID: 5, ThreadID: 2, IsDeleted: true}
+			assert.ErrorIs(t, post.ApprovePending(), ErrPostNotPending,
+				"replies in deleted threads shouldn't be approved")
+			assert.True(t, post.IsDeleted)
+			assert.NoError(t, mock.ExpectationsWereMet())
+			closeMock(t, mock)
+		})
+	}
+}
+
+func TestApprovePendingAnchoredThread(t *testing.T) {
+	for _, driver := range testingDBDrivers {
+		t.Run(driver, func(t *testing.T) {
+			config.SetTestDBConfig(driver, "localhost", "gochan", "gochan", "gochan", "")
+			db, mock, err := sqlmock.New()
+			if !assert.NoError(t, err) {
+				return
+			}
+			if !assert.NoError(t, SetTestingDB(driver, "gochan", "", db)) {
+				return
+			}
+
+			selectQuery := `SELECT pp.bump_thread, t.is_deleted, t.board_id FROM pending_posts pp\s+` +
+				`JOIN posts p ON p.id = pp.post_id\s+JOIN threads t ON t.id = p.thread_id\s+WHERE pp.post_id = \?`
+			threadQuery := `SELECT anchored, cyclical FROM threads WHERE id = \?`
+			showQuery := `UPDATE posts SET is_deleted = FALSE WHERE id = \?`
+			deleteQuery := `DELETE FROM pending_posts WHERE post_id = \?`
+			if driver != "mysql" {
+				selectQuery = `SELECT pp.bump_thread, t.is_deleted, t.board_id FROM pending_posts pp\s+` +
+					`JOIN posts p ON p.id = pp.post_id\s+JOIN threads t ON t.id = p.thread_id\s+WHERE pp.post_id = \$1`
+				threadQuery = `SELECT anchored, cyclical FROM threads WHERE id = \$1`
+				showQuery = `UPDATE posts SET is_deleted = FALSE WHERE id = \$1`
+				deleteQuery = `DELETE FROM pending_posts WHERE post_id = \$1`
+			}
+			mock.ExpectBegin()
+			mock.ExpectPrepare(selectQuery).ExpectQuery().WithArgs(5).
+				WillReturnRows(sqlmock.NewRows([]string{"bump_thread", "is_deleted", "board_id"}).AddRow(true, false, 1))
+			mock.ExpectPrepare(threadQuery).ExpectQuery().WithArgs(2).
+				WillReturnRows(sqlmock.NewRows([]string{"anchored", "cyclical"}).AddRow(true, false))
+			mock.ExpectPrepare(showQuery).ExpectExec().WithArgs(5).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			// the thread is anchored, so it shouldn't be bumped before the pending row is deleted
+			mock.ExpectPrepare(deleteQuery).ExpectExec().WithArgs(5).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			post := &Post{ID: 5, ThreadID: 2, IsDeleted: true}
+			assert.NoError(t, post.ApprovePending())
+			assert.False(t, post.IsDeleted)
+			assert.NoError(t, mock.ExpectationsWereMet())
+			closeMock(t, mock)
+		})
+	}
+}
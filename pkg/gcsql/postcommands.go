@@ -0,0 +1,47 @@
+package gcsql
+
+// GetCommandResults returns the stored results of the post commands in the post's message, in the order that
+// the commands appear in the message
+func (p *Post) GetCommandResults() ([]PostCommandResult, error) {
+	const query = `SELECT post_id, command_order, command, args, result FROM DBPREFIXpost_commands
+	WHERE post_id = ? ORDER BY command_order`
+	rows, err := QuerySQL(query, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []PostCommandResult
+	for rows.Next() {
+		var result PostCommandResult
+		if err = rows.Scan(&result.PostID, &result.Order, &result.Command, &result.Args, &result.Result); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Close()
+}
+
+// SetCommandResults stores the results of the post commands in the post's message so that they can be reused if
+// the message is formatted again, e.g. after it is edited
+func (p *Post) SetCommandResults(results []PostCommandResult) error {
+	const insertSQL = `INSERT INTO DBPREFIXpost_commands (post_id, command_order, command, args, result)
+	VALUES(?,?,?,?,?)`
+	if len(results) == 0 {
+		return nil
+	}
+	tx, err := BeginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for r := range results {
+		results[r].PostID = p.ID
+		results[r].Order = r
+		if _, err = ExecTxSQL(tx, insertSQL,
+			p.ID, r, results[r].Command, results[r].Args, results[r].Result,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
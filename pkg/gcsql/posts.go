@@ -1,7 +1,10 @@
 package gcsql
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"html/template"
@@ -16,11 +19,19 @@ const (
 		SELECT board_id FROM DBPREFIXthreads WHERE id = (
 			SELECT thread_id FROM DBPREFIXposts WHERE id = ?))`
 
+	// selects the number of non-deleted replies in a thread and the bump limit of its board
+	threadBumpLimitSQL = `SELECT COUNT(*),
+	(SELECT autosage_after FROM DBPREFIXboards WHERE id = ?)
+	FROM DBPREFIXposts WHERE thread_id = ? AND is_top_post = FALSE AND is_deleted = FALSE`
+
 	selectPostsBaseSQL = `SELECT 
 	id, thread_id, is_top_post, IP_NTOA, created_on, name, tripcode, is_role_signature,
 	email, subject, message, message_raw, password, deleted_at, is_deleted,
 	COALESCE(banned_message,'') AS banned_message, flag, country
 	FROM DBPREFIXposts `
+
+	// the number of characters in a poster ID
+	posterIDLength = 8
 )
 
 var (
@@ -226,6 +237,26 @@ func SinceLastThread(postIP string) (int, error) {
 	return int(time.Since(when).Seconds()), nil
 }
 
+// CountRecentBoardPosts returns the number of posts made on the board since the given time, including ones that
+// have since been deleted (used for checking if the board is being flooded)
+func CountRecentBoardPosts(boardID int, since time.Time) (int, error) {
+	const query = `SELECT COUNT(*) FROM DBPREFIXposts p
+	JOIN DBPREFIXthreads t ON t.id = p.thread_id
+	WHERE t.board_id = ? AND p.created_on > ?`
+	var count int
+	err := QueryRowSQL(query, interfaceSlice(boardID, since), interfaceSlice(&count))
+	return count, err
+}
+
+// GetPosterID returns a deterministic ID for the given IP address in the given thread, so that posters can be
+// told apart without revealing their IP. The same IP will have a different ID in every thread. IDs aren't stored,
+// so they only stay the same as long as the site's RandomSeed does
+func GetPosterID(ip string, threadID int) string {
+	mac := hmac.New(sha256.New, []byte(config.GetSystemCriticalConfig().RandomSeed))
+	fmt.Fprintf(mac, "posterid:%s:%d", ip, threadID)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:posterIDLength]
+}
+
 // UpdateContents updates the email, subject, and message text of the post
 func (p *Post) UpdateContents(email string, subject string, message template.HTML, messageRaw string) error {
 	const sqlUpdate = `UPDATE DBPREFIXposts SET email = ?, subject = ?, message = ?, message_raw = ? WHERE ID = ?`
@@ -301,12 +332,12 @@ func (p *Post) GetTopPost() (*Post, error) {
 
 // GetPostUpload returns the upload info associated with the file as well as any errors encountered.
 // If the file has no uploads, then *Upload is nil. If the file was removed from the post, then Filename
-// and OriginalFilename = "deleted"
+// and OriginalFilename = "deleted". If the post has multiple uploads, the first one is returned
 func (p *Post) GetUpload() (*Upload, error) {
 	const query = `SELECT
 	id, post_id, file_order, original_filename, filename, checksum,
 	file_size, is_spoilered, thumbnail_width, thumbnail_height, width, height
-	FROM DBPREFIXfiles WHERE post_id = ?`
+	FROM DBPREFIXfiles WHERE post_id = ? ORDER BY file_order LIMIT 1`
 	upload := new(Upload)
 	err := QueryRowSQL(query, interfaceSlice(p.ID), interfaceSlice(
 		&upload.ID, &upload.PostID, &upload.FileOrder, &upload.OriginalFilename, &upload.Filename, &upload.Checksum,
@@ -339,11 +370,29 @@ func (p *Post) Delete() error {
 		return deleteThread(p.ThreadID)
 	}
 	const deleteSQL = `UPDATE DBPREFIXposts SET is_deleted = TRUE, deleted_at = CURRENT_TIMESTAMP WHERE id = ?`
-	_, err := ExecSQL(deleteSQL, p.ID)
+	// deleted posts can't be approved, so they're removed from the approval queue
+	const deletePendingSQL = `DELETE FROM DBPREFIXpending_posts WHERE post_id = ?`
+	if _, err := ExecSQL(deleteSQL, p.ID); err != nil {
+		return err
+	}
+	_, err := ExecSQL(deletePendingSQL, p.ID)
 	return err
 }
 
 func (p *Post) Insert(bumpThread bool, boardID int, locked bool, stickied bool, anchored bool, cyclical bool) error {
+	tx, err := BeginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = p.insert(tx, bumpThread, boardID, locked, stickied, anchored, cyclical); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insert adds the post (and its thread, if it is a new thread) to the database as part of the given transaction
+func (p *Post) insert(tx *sql.Tx, bumpThread bool, boardID int, locked bool, stickied bool, anchored bool, cyclical bool) error {
 	if p.ID > 0 {
 		// already inserted
 		return ErrorPostAlreadySent
@@ -354,12 +403,7 @@ func (p *Post) Insert(bumpThread bool, boardID int, locked bool, stickied bool,
 	VALUES(?,?,PARAM_ATON,CURRENT_TIMESTAMP,?,?,?,?,?,?,?,?,?,?)`
 	bumpSQL := `UPDATE DBPREFIXthreads SET last_bump = CURRENT_TIMESTAMP WHERE id = ?`
 
-	tx, err := BeginTx()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
+	var err error
 	if p.ThreadID == 0 {
 		// thread doesn't exist yet, this is a new post
 		p.IsTopPost = true
@@ -370,14 +414,19 @@ func (p *Post) Insert(bumpThread bool, boardID int, locked bool, stickied bool,
 		}
 		p.ThreadID = threadID
 	} else {
-		var threadIsLocked bool
+		var locked bool
 		if err = QueryRowTxSQL(tx, "SELECT locked FROM DBPREFIXthreads WHERE id = ?",
-			interfaceSlice(p.ThreadID), interfaceSlice(&threadIsLocked)); err != nil {
+			interfaceSlice(p.ThreadID), interfaceSlice(&locked)); err != nil {
 			return err
 		}
-		if threadIsLocked {
+		if locked {
 			return ErrThreadLocked
 		}
+		if bumpThread {
+			if bumpThread, err = replyBumpsThread(tx, boardID, p.ThreadID); err != nil {
+				return err
+			}
+		}
 	}
 
 	stmt, err := PrepareSQL(insertSQL, tx)
@@ -402,7 +451,32 @@ func (p *Post) Insert(bumpThread bool, boardID int, locked bool, stickied bool,
 			return err
 		}
 	}
-	return tx.Commit()
+	return nil
+}
+
+// replyBumpsThread returns false if a new reply shouldn't bump the thread, either because it is anchored or
+// because it has reached the board's bump limit
+func replyBumpsThread(tx *sql.Tx, boardID int, threadID int) (bool, error) {
+	var thread Thread
+	if err := QueryRowTxSQL(tx, "SELECT anchored, cyclical FROM DBPREFIXthreads WHERE id = ?",
+		interfaceSlice(threadID), interfaceSlice(&thread.Anchored, &thread.Cyclical)); err != nil {
+		return false, err
+	}
+	if thread.Anchored {
+		// anchored threads are never bumped by replies
+		return false, nil
+	}
+	if thread.Cyclical {
+		// cyclical threads are exempt from the bump limit since their oldest replies are removed instead
+		return true, nil
+	}
+	var replyCount int
+	var board Board
+	if err := QueryRowTxSQL(tx, threadBumpLimitSQL, interfaceSlice(boardID, threadID),
+		interfaceSlice(&replyCount, &board.AutosageAfter)); err != nil {
+		return false, err
+	}
+	return !board.BumpLimitReached(replyCount), nil
 }
 
 func (p *Post) WebPath() string {
@@ -426,3 +500,42 @@ func (p *Post) WebPath() string {
 	}
 	return webRoot + boardDir + fmt.Sprintf("/res/%d.html#%d", opID, p.ID)
 }
+
+// PostLinkTarget holds the information needed to build a link to a post
+type PostLinkTarget struct {
+	PostID   int
+	OpID     int
+	BoardDir string
+}
+
+// GetPostLinkTargets takes a variable number of post IDs and returns a map of the IDs of the posts that exist
+// and haven't been deleted to the information needed to link to them
+func GetPostLinkTargets(postIDs ...int) (map[int]PostLinkTarget, error) {
+	targets := make(map[int]PostLinkTarget)
+	if len(postIDs) == 0 {
+		return targets, nil
+	}
+	params := make([]any, len(postIDs))
+	for i, id := range postIDs {
+		params[i] = id
+	}
+	query := `SELECT posts.id, (
+		SELECT op.id FROM DBPREFIXposts op WHERE op.thread_id = posts.thread_id AND op.is_top_post LIMIT 1
+	) AS op_id, boards.dir FROM DBPREFIXposts posts
+	JOIN DBPREFIXthreads threads ON threads.id = posts.thread_id
+	JOIN DBPREFIXboards boards ON boards.id = threads.board_id
+	WHERE posts.id IN ` + createArrayPlaceholder(params) + ` AND posts.is_deleted = FALSE`
+	rows, err := QuerySQL(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var target PostLinkTarget
+		if err = rows.Scan(&target.PostID, &target.OpID, &target.BoardDir); err != nil {
+			return nil, err
+		}
+		targets[target.PostID] = target
+	}
+	return targets, rows.Close()
+}
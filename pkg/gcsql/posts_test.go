@@ -0,0 +1,59 @@
+package gcsql
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPosterID(t *testing.T) {
+	config.SetRandomSeed("test")
+	id := GetPosterID("192.168.56.1", 1)
+	assert.Len(t, id, posterIDLength)
+	assert.Equal(t, id, GetPosterID("192.168.56.1", 1), "poster ID should be deterministic")
+	assert.NotEqual(t, id, GetPosterID("192.168.56.1", 2), "poster ID should be different in another thread")
+	assert.NotEqual(t, id, GetPosterID("192.168.56.2", 1), "poster ID should be different for another IP")
+}
+
+func TestPosterIDNotTripcode(t *testing.T) {
+	config.SetRandomSeed("test")
+	id := GetPosterID("192.168.56.1", 1)
+	tripcode := strings.TrimPrefix(gcutil.SecureTripcode("192.168.56.1:1", "test"), gcutil.SecureTripcodePrefix)
+	assert.NotEqual(t, id, tripcode[:posterIDLength],
+		"a poster ID shouldn't match the secure tripcode made from the same input")
+}
+
+func TestCountRecentBoardPosts(t *testing.T) {
+	for _, driver := range testingDBDrivers {
+		t.Run(driver, func(t *testing.T) {
+			config.SetTestDBConfig(driver, "localhost", "gochan", "gochan", "gochan", "")
+			db, mock, err := sqlmock.New()
+			if !assert.NoError(t, err) {
+				return
+			}
+			if !assert.NoError(t, SetTestingDB(driver, "gochan", "", db)) {
+				return
+			}
+
+			query := `SELECT COUNT\(\*\) FROM posts p\s+JOIN threads t ON t.id = p.thread_id\s+` +
+				`WHERE t.board_id = \? AND p.created_on > \?`
+			if driver != "mysql" {
+				query = `SELECT COUNT\(\*\) FROM posts p\s+JOIN threads t ON t.id = p.thread_id\s+` +
+					`WHERE t.board_id = \$1 AND p.created_on > \$2`
+			}
+			since := time.Now().Add(-time.Minute)
+			mock.ExpectPrepare(query).ExpectQuery().WithArgs(1, since).
+				WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(12))
+			count, err := CountRecentBoardPosts(1, since)
+			assert.NoError(t, err)
+			assert.Equal(t, 12, count)
+			assert.NoError(t, mock.ExpectationsWereMet())
+			closeMock(t, mock)
+		})
+	}
+}
@@ -16,7 +16,7 @@ const (
 	DBUpToDate
 	DBModernButAhead
 
-	targetDatabaseVersion = 3
+	targetDatabaseVersion = 4
 )
 
 var (
@@ -0,0 +1,91 @@
+package gcsql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// CheckR9KHashes returns true if any of the given hashes of a post's normalized text or uploaded files have already
+// been posted on the board
+func CheckR9KHashes(boardID int, hashes ...string) (bool, error) {
+	if len(hashes) == 0 {
+		return false, nil
+	}
+	params := []any{boardID}
+	for _, hash := range hashes {
+		params = append(params, hash)
+	}
+	query := `SELECT COUNT(*) FROM DBPREFIXr9k_hashes WHERE board_id = ? AND hash IN ` +
+		createArrayPlaceholder(params[1:])
+	var count int
+	err := QueryRowSQL(query, params, interfaceSlice(&count))
+	return count > 0, err
+}
+
+// AddR9KHashes stores the hashes of a post's normalized text and uploaded files so that they can't be posted on
+// the board again
+func AddR9KHashes(boardID int, hashes ...string) error {
+	const checkSQL = `SELECT COUNT(*) FROM DBPREFIXr9k_hashes WHERE board_id = ? AND hash = ?`
+	const insertSQL = `INSERT INTO DBPREFIXr9k_hashes (board_id, hash) VALUES(?,?)`
+	if len(hashes) == 0 {
+		return nil
+	}
+	tx, err := BeginTx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, hash := range hashes {
+		var count int
+		if err = QueryRowTxSQL(tx, checkSQL, interfaceSlice(boardID, hash), interfaceSlice(&count)); err != nil {
+			return err
+		}
+		if count > 0 {
+			// the same file can be uploaded more than once in a post
+			continue
+		}
+		if _, err = ExecTxSQL(tx, insertSQL, boardID, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetR9KMute returns the IP's R9K mute status on the board, or nil if it has never been muted there
+func GetR9KMute(boardID int, ip string) (*R9KMute, error) {
+	const query = `SELECT mute_count, expires_at FROM DBPREFIXr9k_mutes WHERE board_id = ? AND ip = PARAM_ATON`
+	mute := &R9KMute{BoardID: boardID, IP: ip}
+	err := QueryRowSQL(query, interfaceSlice(boardID, ip), interfaceSlice(&mute.MuteCount, &mute.ExpiresAt))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mute, nil
+}
+
+// IsActive returns true if the mute hasn't expired yet
+func (m *R9KMute) IsActive() bool {
+	return m != nil && time.Now().Before(m.ExpiresAt)
+}
+
+// Save stores the mute's count and expiration time, adding it if the IP hasn't been muted on the board before
+func (m *R9KMute) Save() error {
+	const updateSQL = `UPDATE DBPREFIXr9k_mutes SET mute_count = ?, expires_at = ?
+	WHERE board_id = ? AND ip = PARAM_ATON`
+	const insertSQL = `INSERT INTO DBPREFIXr9k_mutes (board_id, ip, mute_count, expires_at)
+	VALUES(?, PARAM_ATON, ?, ?)`
+	result, err := ExecSQL(updateSQL, m.MuteCount, m.ExpiresAt, m.BoardID, m.IP)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected > 0 {
+		return nil
+	}
+	_, err = ExecSQL(insertSQL, m.BoardID, m.IP, m.MuteCount, m.ExpiresAt)
+	return err
+}
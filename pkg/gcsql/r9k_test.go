@@ -0,0 +1,79 @@
+package gcsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckR9KHashes(t *testing.T) {
+	for _, driver := range testingDBDrivers {
+		t.Run(driver, func(t *testing.T) {
+			config.SetTestDBConfig(driver, "localhost", "gochan", "gochan", "gochan", "")
+			db, mock, err := sqlmock.New()
+			if !assert.NoError(t, err) {
+				return
+			}
+			if !assert.NoError(t, SetTestingDB(driver, "gochan", "", db)) {
+				return
+			}
+
+			unoriginal, err := CheckR9KHashes(1)
+			assert.NoError(t, err)
+			assert.False(t, unoriginal, "no hashes should never be unoriginal")
+
+			query := `SELECT COUNT\(\*\) FROM r9k_hashes WHERE board_id = \? AND hash IN \(\?,\?\)`
+			if driver != "mysql" {
+				query = `SELECT COUNT\(\*\) FROM r9k_hashes WHERE board_id = \$1 AND hash IN \(\$2,\$3\)`
+			}
+			mock.ExpectPrepare(query).ExpectQuery().WithArgs(1, "a", "b").
+				WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(1))
+			unoriginal, err = CheckR9KHashes(1, "a", "b")
+			assert.NoError(t, err)
+			assert.True(t, unoriginal)
+			assert.NoError(t, mock.ExpectationsWereMet())
+			closeMock(t, mock)
+		})
+	}
+}
+
+func TestGetR9KMute(t *testing.T) {
+	for _, driver := range testingDBDrivers {
+		t.Run(driver, func(t *testing.T) {
+			config.SetTestDBConfig(driver, "localhost", "gochan", "gochan", "gochan", "")
+			db, mock, err := sqlmock.New()
+			if !assert.NoError(t, err) {
+				return
+			}
+			if !assert.NoError(t, SetTestingDB(driver, "gochan", "", db)) {
+				return
+			}
+
+			query := `SELECT mute_count, expires_at FROM r9k_mutes WHERE board_id = \? AND ip = INET6_ATON\(\?\)`
+			if driver != "mysql" {
+				query = `SELECT mute_count, expires_at FROM r9k_mutes WHERE board_id = \$1 AND ip = \$2`
+			}
+			mock.ExpectPrepare(query).ExpectQuery().WithArgs(1, "192.168.56.1").
+				WillReturnRows(sqlmock.NewRows([]string{"mute_count", "expires_at"}))
+			mute, err := GetR9KMute(1, "192.168.56.1")
+			assert.NoError(t, err)
+			assert.Nil(t, mute)
+			assert.False(t, mute.IsActive(), "a nil mute should not be active")
+
+			expires := time.Now().Add(time.Minute)
+			mock.ExpectPrepare(query).ExpectQuery().WithArgs(1, "192.168.56.1").
+				WillReturnRows(sqlmock.NewRows([]string{"mute_count", "expires_at"}).AddRow(2, expires))
+			mute, err = GetR9KMute(1, "192.168.56.1")
+			if !assert.NoError(t, err) || !assert.NotNil(t, mute) {
+				return
+			}
+			assert.Equal(t, 2, mute.MuteCount)
+			assert.True(t, mute.IsActive())
+			assert.NoError(t, mock.ExpectationsWereMet())
+			closeMock(t, mock)
+		})
+	}
+}
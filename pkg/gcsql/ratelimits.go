@@ -0,0 +1,83 @@
+package gcsql
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/gochan-org/gochan/pkg/config"
+)
+
+// rateLimitTokenScale is the number of units stored for each rate limit token, so that partially refilled tokens
+// can be stored as integers
+const rateLimitTokenScale = 1000
+
+// TakeRateLimitToken takes a token from the shared rate limit bucket with the given key, which holds up to capacity
+// tokens and is refilled with refillPerSecond tokens every second. If the bucket is empty, it returns false and how
+// long it will be until a token is available
+func TakeRateLimitToken(key string, capacity int, refillPerSecond float64, now time.Time) (bool, time.Duration, error) {
+	// new buckets start full. The bucket is created before the transaction so that requests with the same key can't
+	// both try to insert it, and the row is locked while it is read and updated so that they can't both take the
+	// same token. SQLite doesn't support SELECT ... FOR UPDATE, but it only allows one transaction to write at a time
+	insertSQL := `INSERT INTO DBPREFIXrate_limits (bucket_key, tokens, updated_ms) VALUES(?, ?, ?)
+	ON CONFLICT (bucket_key) DO NOTHING`
+	selectSQL := `SELECT tokens, updated_ms FROM DBPREFIXrate_limits WHERE bucket_key = ?`
+	const updateSQL = `UPDATE DBPREFIXrate_limits SET tokens = ?, updated_ms = ? WHERE bucket_key = ?`
+	switch config.GetSystemCriticalConfig().DBtype {
+	case "mysql":
+		insertSQL = `INSERT IGNORE INTO DBPREFIXrate_limits (bucket_key, tokens, updated_ms) VALUES(?, ?, ?)`
+		selectSQL += " FOR UPDATE"
+	case "postgres":
+		selectSQL += " FOR UPDATE"
+	}
+
+	maxTokens := int64(capacity) * rateLimitTokenScale
+	nowMs := now.UnixMilli()
+	if _, err := ExecSQL(insertSQL, key, maxTokens, nowMs); err != nil {
+		return false, 0, err
+	}
+
+	tx, err := BeginTx()
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+
+	tokens := maxTokens
+	var updatedMs int64
+	err = QueryRowTxSQL(tx, selectSQL, interfaceSlice(key), interfaceSlice(&tokens, &updatedMs))
+	if errors.Is(err, sql.ErrNoRows) {
+		// the bucket was pruned after it was created, so it would have been full anyway
+		return true, 0, nil
+	} else if err != nil {
+		return false, 0, err
+	}
+	if nowMs > updatedMs {
+		refilled := float64(nowMs-updatedMs) / 1000 * refillPerSecond * rateLimitTokenScale
+		tokens = int64(math.Min(float64(maxTokens), float64(tokens)+refilled))
+	}
+	allowed := tokens >= rateLimitTokenScale
+	if allowed {
+		tokens -= rateLimitTokenScale
+	}
+
+	if _, err = ExecTxSQL(tx, updateSQL, tokens, nowMs, key); err != nil {
+		return false, 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return false, 0, err
+	}
+	if allowed {
+		return true, 0, nil
+	}
+	missing := float64(rateLimitTokenScale-tokens) / rateLimitTokenScale
+	return false, time.Duration(missing / refillPerSecond * float64(time.Second)), nil
+}
+
+// DeleteStaleRateLimits deletes the shared rate limit buckets that haven't been used since the given time
+func DeleteStaleRateLimits(before time.Time) error {
+	const query = `DELETE FROM DBPREFIXrate_limits WHERE updated_ms < ?`
+	_, err := ExecSQL(query, before.UnixMilli())
+	return err
+}
@@ -0,0 +1,71 @@
+package gcsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTakeRateLimitToken(t *testing.T) {
+	for _, driver := range testingDBDrivers {
+		t.Run(driver, func(t *testing.T) {
+			config.SetTestDBConfig(driver, "localhost", "gochan", "gochan", "gochan", "")
+			db, mock, err := sqlmock.New()
+			if !assert.NoError(t, err) {
+				return
+			}
+			if !assert.NoError(t, SetTestingDB(driver, "gochan", "", db)) {
+				return
+			}
+
+			insertQuery := `INSERT IGNORE INTO rate_limits \(bucket_key, tokens, updated_ms\) VALUES\(\?, \?, \?\)`
+			selectQuery := `SELECT tokens, updated_ms FROM rate_limits WHERE bucket_key = \? FOR UPDATE`
+			updateQuery := `UPDATE rate_limits SET tokens = \?, updated_ms = \? WHERE bucket_key = \?`
+			if driver != "mysql" {
+				insertQuery = `INSERT INTO rate_limits \(bucket_key, tokens, updated_ms\) VALUES\(\$1, \$2, \$3\)\s+` +
+					`ON CONFLICT \(bucket_key\) DO NOTHING`
+				selectQuery = `SELECT tokens, updated_ms FROM rate_limits WHERE bucket_key = \$1 FOR UPDATE`
+				updateQuery = `UPDATE rate_limits SET tokens = \$1, updated_ms = \$2 WHERE bucket_key = \$3`
+			}
+			if driver == "sqlite3" {
+				selectQuery = `SELECT tokens, updated_ms FROM rate_limits WHERE bucket_key = \$1$`
+			}
+			now := time.Now()
+			nowMs := now.UnixMilli()
+
+			// new bucket, starts full
+			mock.ExpectPrepare(insertQuery).ExpectExec().WithArgs("post:192.168.56.1", 3000, nowMs).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectBegin()
+			mock.ExpectPrepare(selectQuery).ExpectQuery().WithArgs("post:192.168.56.1").
+				WillReturnRows(sqlmock.NewRows([]string{"tokens", "updated_ms"}).AddRow(3000, nowMs))
+			mock.ExpectPrepare(updateQuery).ExpectExec().WithArgs(2000, nowMs, "post:192.168.56.1").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			allowed, retryAfter, err := TakeRateLimitToken("post:192.168.56.1", 3, 0.5, now)
+			assert.NoError(t, err)
+			assert.True(t, allowed)
+			assert.Zero(t, retryAfter)
+
+			// empty bucket, half a token refilled after one second
+			mock.ExpectPrepare(insertQuery).ExpectExec().WithArgs("post:192.168.56.1", 3000, nowMs).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectBegin()
+			mock.ExpectPrepare(selectQuery).ExpectQuery().WithArgs("post:192.168.56.1").
+				WillReturnRows(sqlmock.NewRows([]string{"tokens", "updated_ms"}).AddRow(0, nowMs-1000))
+			mock.ExpectPrepare(updateQuery).ExpectExec().WithArgs(500, nowMs, "post:192.168.56.1").
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			allowed, retryAfter, err = TakeRateLimitToken("post:192.168.56.1", 3, 0.5, now)
+			assert.NoError(t, err)
+			assert.False(t, allowed)
+			assert.Equal(t, time.Second, retryAfter)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+			closeMock(t, mock)
+		})
+	}
+}
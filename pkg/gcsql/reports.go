@@ -91,3 +91,13 @@ func GetReports(includeCleared bool) ([]Report, error) {
 	}
 	return reports, nil
 }
+
+// GetReportBoardID returns the ID of the board containing the post that the report with the given ID is for
+func GetReportBoardID(reportID int) (int, error) {
+	const query = `SELECT board_id FROM DBPREFIXthreads WHERE id = (
+		SELECT thread_id FROM DBPREFIXposts WHERE id = (
+			SELECT post_id FROM DBPREFIXreports WHERE id = ?))`
+	var boardID int
+	err := QueryRowSQL(query, interfaceSlice(reportID), interfaceSlice(&boardID))
+	return boardID, err
+}
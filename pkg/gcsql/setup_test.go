@@ -17,9 +17,11 @@ var (
 		`CREATE TABLE boards\(\s*id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+section_id BIGINT NOT NULL,\s+uri VARCHAR\(45\) NOT NULL,\s+dir VARCHAR\(45\) NOT NULL,\s+navbar_position SMALLINT NOT NULL,\s+title VARCHAR\(45\) NOT NULL,\s+subtitle VARCHAR\(64\) NOT NULL,\s+description VARCHAR\(64\) NOT NULL,\s+max_file_size INT NOT NULL,\s+max_threads SMALLINT NOT NULL,  default_style VARCHAR\(45\) NOT NULL,\s+locked BOOL NOT NULL,\s+created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+anonymous_name VARCHAR\(45\) NOT NULL DEFAULT 'Anonymous',\s+force_anonymous BOOL NOT NULL,\s+autosage_after SMALLINT NOT NULL,\s+no_images_after SMALLINT NOT NULL,\s+max_message_length SMALLINT NOT NULL,\s+min_message_length SMALLINT NOT NULL,\s+allow_embeds BOOL NOT NULL,\s+redirect_to_thread BOOL NOT NULL,\s+require_file BOOL NOT NULL,\s+enable_catalog BOOL NOT NULL,\s+CONSTRAINT boards_section_id_fk\s+FOREIGN KEY\(section_id\) REFERENCES sections\(id\),\s+CONSTRAINT boards_dir_unique UNIQUE\(dir\),\s+CONSTRAINT boards_uri_unique UNIQUE\(uri\)\s*\)`,
 		`CREATE TABLE threads\(\s*id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+board_id BIGINT NOT NULL,\s+locked BOOL NOT NULL DEFAULT FALSE,\s+stickied BOOL NOT NULL DEFAULT FALSE,\s+anchored BOOL NOT NULL DEFAULT FALSE,\s+cyclical BOOL NOT NULL DEFAULT FALSE,\s+last_bump TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+is_deleted BOOL NOT NULL DEFAULT FALSE,\s+CONSTRAINT threads_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE\s*\)`,
 		`CREATE INDEX thread_deleted_index ON threads\(is_deleted\)`,
-		`CREATE TABLE posts\(\s+id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+thread_id BIGINT NOT NULL,\s+is_top_post BOOL NOT NULL DEFAULT FALSE,\s+ip VARBINARY\(16\) NOT NULL,\s+created_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+name VARCHAR\(50\) NOT NULL DEFAULT '',\s+tripcode VARCHAR\(10\) NOT NULL DEFAULT '',\s+is_role_signature BOOL NOT NULL DEFAULT FALSE,  email VARCHAR\(50\) NOT NULL DEFAULT '',\s+subject VARCHAR\(100\) NOT NULL DEFAULT '',\s+message TEXT NOT NULL,\s+message_raw TEXT NOT NULL,\s+password TEXT NOT NULL,\s+deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+is_deleted BOOL NOT NULL DEFAULT FALSE,\s+banned_message TEXT,\s+flag VARCHAR\(45\) NOT NULL DEFAULT '',\s+country VARCHAR\(80\) NOT NULL DEFAULT '',\s+CONSTRAINT posts_thread_id_fk\s+FOREIGN KEY\(thread_id\) REFERENCES threads\(id\) ON DELETE CASCADE \)`,
+		`CREATE TABLE posts\(\s+id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+thread_id BIGINT NOT NULL,\s+is_top_post BOOL NOT NULL DEFAULT FALSE,\s+ip VARBINARY\(16\) NOT NULL,\s+created_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+name VARCHAR\(50\) NOT NULL DEFAULT '',\s+tripcode VARCHAR\(32\) NOT NULL DEFAULT '',\s+is_role_signature BOOL NOT NULL DEFAULT FALSE,  email VARCHAR\(50\) NOT NULL DEFAULT '',\s+subject VARCHAR\(100\) NOT NULL DEFAULT '',\s+message TEXT NOT NULL,\s+message_raw TEXT NOT NULL,\s+password TEXT NOT NULL,\s+deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+is_deleted BOOL NOT NULL DEFAULT FALSE,\s+banned_message TEXT,\s+flag VARCHAR\(45\) NOT NULL DEFAULT '',\s+country VARCHAR\(80\) NOT NULL DEFAULT '',\s+CONSTRAINT posts_thread_id_fk\s+FOREIGN KEY\(thread_id\) REFERENCES threads\(id\) ON DELETE CASCADE \)`,
 		`CREATE INDEX top_post_index ON posts\(is_top_post\)`,
-		`CREATE TABLE files\(\s+id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+post_id BIGINT NOT NULL,\s+file_order INT NOT NULL,\s+original_filename VARCHAR\(255\) NOT NULL,\s+filename VARCHAR\(45\) NOT NULL,\s+checksum TEXT NOT NULL,\s+file_size INT NOT NULL,\s+is_spoilered BOOL NOT NULL,\s+thumbnail_width INT NOT NULL,\s+thumbnail_height INT NOT NULL,\s+width INT NOT NULL,\s+height INT NOT NULL,\s+CONSTRAINT files_post_id_fk\s+FOREIGN KEY\(post_id\) REFERENCES posts\(id\) ON DELETE CASCADE,\s+CONSTRAINT files_post_id_file_order_unique UNIQUE\(post_id, file_order\) \)`,
+		`CREATE TABLE files\(\s+id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+post_id BIGINT NOT NULL,\s+file_order INT NOT NULL,\s+original_filename VARCHAR\(255\) NOT NULL,\s+filename VARCHAR\(45\) NOT NULL,\s+checksum TEXT NOT NULL,\s+file_size INT NOT NULL,\s+is_spoilered BOOL NOT NULL,\s+thumbnail_width INT NOT NULL,\s+thumbnail_height INT NOT NULL,\s+width INT NOT NULL,\s+height INT NOT NULL,\s+fingerprint VARCHAR\(64\) NOT NULL DEFAULT '',\s+CONSTRAINT files_post_id_fk\s+FOREIGN KEY\(post_id\) REFERENCES posts\(id\) ON DELETE CASCADE,\s+CONSTRAINT files_post_id_file_order_unique UNIQUE\(post_id, file_order\) \)`,
+		`CREATE TABLE post_commands\(\s+post_id BIGINT NOT NULL,\s+command_order INT NOT NULL,\s+command VARCHAR\(32\) NOT NULL,\s+args VARCHAR\(100\) NOT NULL DEFAULT '',\s+result VARCHAR\(255\) NOT NULL,\s+CONSTRAINT post_commands_post_id_fk\s+FOREIGN KEY\(post_id\) REFERENCES posts\(id\) ON DELETE CASCADE,\s+CONSTRAINT post_commands_pk PRIMARY KEY \(post_id,command_order\) \)`,
+		`CREATE TABLE pending_posts\(\s+post_id BIGINT NOT NULL,\s+reason VARCHAR\(255\) NOT NULL,\s+bump_thread BOOL NOT NULL,\s+CONSTRAINT pending_posts_post_id_fk\s+FOREIGN KEY\(post_id\) REFERENCES posts\(id\) ON DELETE CASCADE,\s+CONSTRAINT pending_posts_pk PRIMARY KEY \(post_id\) \)`,
 		`CREATE TABLE staff\(\s+id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+username VARCHAR\(45\) NOT NULL,\s+password_checksum VARCHAR\(120\) NOT NULL,\s+global_rank INT,\s+added_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+last_login TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+is_active BOOL NOT NULL DEFAULT TRUE,\s+CONSTRAINT staff_username_unique UNIQUE\(username\) \)`,
 		`CREATE TABLE sessions\(\s+id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+staff_id BIGINT NOT NULL,\s+expires TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+data VARCHAR\(45\) NOT NULL,\s+CONSTRAINT sessions_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\) ON DELETE CASCADE \)`,
 		`CREATE TABLE board_staff\(\s+board_id BIGINT NOT NULL,\s+staff_id BIGINT NOT NULL,  CONSTRAINT board_staff_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT board_staff_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\) ON DELETE CASCADE,\s+CONSTRAINT board_staff_pk PRIMARY KEY \(board_id,staff_id\) \)`,
@@ -33,8 +35,11 @@ var (
 		`CREATE TABLE filename_ban\(\s+id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+board_id BIGINT,\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+filename VARCHAR\(255\) NOT NULL,\s+is_regex BOOL NOT NULL,\s+CONSTRAINT filename_ban_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT filename_ban_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\) \)`,
 		`CREATE TABLE username_ban\(\s+id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+board_id BIGINT,\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+username VARCHAR\(255\) NOT NULL,\s+is_regex BOOL NOT NULL,\s+CONSTRAINT username_ban_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT username_ban_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\) \)`,
 		`CREATE TABLE file_ban\(\s+id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+board_id BIGINT,\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+checksum TEXT NOT NULL,\s+fingerprinter VARCHAR\(64\),\s+ban_ip BOOL NOT NULL,\s+ban_ip_message TEXT,\s+CONSTRAINT file_ban_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT file_ban_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\)\s+\)`,
-		`CREATE TABLE wordfilters\(\s+id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+board_dirs VARCHAR\(255\) DEFAULT '\*',\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+search VARCHAR\(75\) NOT NULL,\s+is_regex BOOL NOT NULL,\s+change_to VARCHAR\(75\) NOT NULL,\s+CONSTRAINT wordfilters_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\),\s+CONSTRAINT wordfilters_search_check CHECK \(search <> ''\) \)`,
-		`INSERT INTO database_version\(component, version\)\s+VALUES\('gochan', 3\)`,
+		`CREATE TABLE wordfilters\(\s+id BIGINT NOT NULL AUTO_INCREMENT UNIQUE PRIMARY KEY,\s+board_dirs VARCHAR\(255\) DEFAULT '\*',\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+search VARCHAR\(75\) NOT NULL,\s+is_regex BOOL NOT NULL,\s+change_to VARCHAR\(75\) NOT NULL,\s+action VARCHAR\(10\) NOT NULL DEFAULT 'replace',\s+ban_duration VARCHAR\(32\) NOT NULL DEFAULT '',\s+hits INT NOT NULL DEFAULT 0,\s+last_hit_at TIMESTAMP NULL,\s+CONSTRAINT wordfilters_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\),\s+CONSTRAINT wordfilters_search_check CHECK \(search <> ''\) \)`,
+		`CREATE TABLE r9k_hashes\(\s+board_id BIGINT NOT NULL,\s+hash CHAR\(64\) NOT NULL,\s+CONSTRAINT r9k_hashes_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT r9k_hashes_pk PRIMARY KEY \(board_id,hash\) \)`,
+		`CREATE TABLE r9k_mutes\(\s+board_id BIGINT NOT NULL,\s+ip VARBINARY\(16\) NOT NULL,\s+mute_count INT NOT NULL DEFAULT 0,\s+expires_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+CONSTRAINT r9k_mutes_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT r9k_mutes_pk PRIMARY KEY \(board_id,ip\) \)`,
+		`CREATE TABLE rate_limits\(\s+bucket_key VARCHAR\(128\) NOT NULL,\s+tokens BIGINT NOT NULL,\s+updated_ms BIGINT NOT NULL,\s+CONSTRAINT rate_limits_pk PRIMARY KEY \(bucket_key\) \)`,
+		`INSERT INTO database_version\(component, version\)\s+VALUES\('gochan', 4\)`,
 	}
 	testInitDBPostgresStatements = []string{
 		`CREATE TABLE database_version\(\s+component VARCHAR\(40\) NOT NULL PRIMARY KEY,\s+version INT NOT NULL \)`,
@@ -42,9 +47,11 @@ var (
 		`CREATE TABLE boards\(\s*id BIGSERIAL PRIMARY KEY,\s+section_id BIGINT NOT NULL,\s+uri VARCHAR\(45\) NOT NULL,\s+dir VARCHAR\(45\) NOT NULL,\s+navbar_position SMALLINT NOT NULL,\s+title VARCHAR\(45\) NOT NULL,\s+subtitle VARCHAR\(64\) NOT NULL,\s+description VARCHAR\(64\) NOT NULL,\s+max_file_size INT NOT NULL,\s+max_threads SMALLINT NOT NULL,  default_style VARCHAR\(45\) NOT NULL,\s+locked BOOL NOT NULL,\s+created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+anonymous_name VARCHAR\(45\) NOT NULL DEFAULT 'Anonymous',\s+force_anonymous BOOL NOT NULL,\s+autosage_after SMALLINT NOT NULL,\s+no_images_after SMALLINT NOT NULL,\s+max_message_length SMALLINT NOT NULL,\s+min_message_length SMALLINT NOT NULL,\s+allow_embeds BOOL NOT NULL,\s+redirect_to_thread BOOL NOT NULL,\s+require_file BOOL NOT NULL,\s+enable_catalog BOOL NOT NULL,\s+CONSTRAINT boards_section_id_fk\s+FOREIGN KEY\(section_id\) REFERENCES sections\(id\),\s+CONSTRAINT boards_dir_unique UNIQUE\(dir\),\s+CONSTRAINT boards_uri_unique UNIQUE\(uri\)\s*\)`,
 		`CREATE TABLE threads\(\s*id BIGSERIAL PRIMARY KEY,\s+board_id BIGINT NOT NULL,\s+locked BOOL NOT NULL DEFAULT FALSE,\s+stickied BOOL NOT NULL DEFAULT FALSE,\s+anchored BOOL NOT NULL DEFAULT FALSE,\s+cyclical BOOL NOT NULL DEFAULT FALSE,\s+last_bump TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+is_deleted BOOL NOT NULL DEFAULT FALSE,\s+CONSTRAINT threads_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE\s*\)`,
 		`CREATE INDEX thread_deleted_index ON threads\(is_deleted\)`,
-		`CREATE TABLE posts\(\s+id BIGSERIAL PRIMARY KEY,\s+thread_id BIGINT NOT NULL,\s+is_top_post BOOL NOT NULL DEFAULT FALSE,\s+ip INET NOT NULL,\s+created_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+name VARCHAR\(50\) NOT NULL DEFAULT '',\s+tripcode VARCHAR\(10\) NOT NULL DEFAULT '',\s+is_role_signature BOOL NOT NULL DEFAULT FALSE,  email VARCHAR\(50\) NOT NULL DEFAULT '',\s+subject VARCHAR\(100\) NOT NULL DEFAULT '',\s+message TEXT NOT NULL,\s+message_raw TEXT NOT NULL,\s+password TEXT NOT NULL,\s+deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+is_deleted BOOL NOT NULL DEFAULT FALSE,\s+banned_message TEXT,\s+flag VARCHAR\(45\) NOT NULL DEFAULT '',\s+country VARCHAR\(80\) NOT NULL DEFAULT '',\s+CONSTRAINT posts_thread_id_fk\s+FOREIGN KEY\(thread_id\) REFERENCES threads\(id\) ON DELETE CASCADE \)`,
+		`CREATE TABLE posts\(\s+id BIGSERIAL PRIMARY KEY,\s+thread_id BIGINT NOT NULL,\s+is_top_post BOOL NOT NULL DEFAULT FALSE,\s+ip INET NOT NULL,\s+created_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+name VARCHAR\(50\) NOT NULL DEFAULT '',\s+tripcode VARCHAR\(32\) NOT NULL DEFAULT '',\s+is_role_signature BOOL NOT NULL DEFAULT FALSE,  email VARCHAR\(50\) NOT NULL DEFAULT '',\s+subject VARCHAR\(100\) NOT NULL DEFAULT '',\s+message TEXT NOT NULL,\s+message_raw TEXT NOT NULL,\s+password TEXT NOT NULL,\s+deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+is_deleted BOOL NOT NULL DEFAULT FALSE,\s+banned_message TEXT,\s+flag VARCHAR\(45\) NOT NULL DEFAULT '',\s+country VARCHAR\(80\) NOT NULL DEFAULT '',\s+CONSTRAINT posts_thread_id_fk\s+FOREIGN KEY\(thread_id\) REFERENCES threads\(id\) ON DELETE CASCADE \)`,
 		`CREATE INDEX top_post_index ON posts\(is_top_post\)`,
-		`CREATE TABLE files\(\s+id BIGSERIAL PRIMARY KEY,\s+post_id BIGINT NOT NULL,\s+file_order INT NOT NULL,\s+original_filename VARCHAR\(255\) NOT NULL,\s+filename VARCHAR\(45\) NOT NULL,\s+checksum TEXT NOT NULL,\s+file_size INT NOT NULL,\s+is_spoilered BOOL NOT NULL,\s+thumbnail_width INT NOT NULL,\s+thumbnail_height INT NOT NULL,\s+width INT NOT NULL,\s+height INT NOT NULL,\s+CONSTRAINT files_post_id_fk\s+FOREIGN KEY\(post_id\) REFERENCES posts\(id\) ON DELETE CASCADE,\s+CONSTRAINT files_post_id_file_order_unique UNIQUE\(post_id, file_order\) \)`,
+		`CREATE TABLE files\(\s+id BIGSERIAL PRIMARY KEY,\s+post_id BIGINT NOT NULL,\s+file_order INT NOT NULL,\s+original_filename VARCHAR\(255\) NOT NULL,\s+filename VARCHAR\(45\) NOT NULL,\s+checksum TEXT NOT NULL,\s+file_size INT NOT NULL,\s+is_spoilered BOOL NOT NULL,\s+thumbnail_width INT NOT NULL,\s+thumbnail_height INT NOT NULL,\s+width INT NOT NULL,\s+height INT NOT NULL,\s+fingerprint VARCHAR\(64\) NOT NULL DEFAULT '',\s+CONSTRAINT files_post_id_fk\s+FOREIGN KEY\(post_id\) REFERENCES posts\(id\) ON DELETE CASCADE,\s+CONSTRAINT files_post_id_file_order_unique UNIQUE\(post_id, file_order\) \)`,
+		`CREATE TABLE post_commands\(\s+post_id BIGINT NOT NULL,\s+command_order INT NOT NULL,\s+command VARCHAR\(32\) NOT NULL,\s+args VARCHAR\(100\) NOT NULL DEFAULT '',\s+result VARCHAR\(255\) NOT NULL,\s+CONSTRAINT post_commands_post_id_fk\s+FOREIGN KEY\(post_id\) REFERENCES posts\(id\) ON DELETE CASCADE,\s+CONSTRAINT post_commands_pk PRIMARY KEY \(post_id,command_order\) \)`,
+		`CREATE TABLE pending_posts\(\s+post_id BIGINT NOT NULL,\s+reason VARCHAR\(255\) NOT NULL,\s+bump_thread BOOL NOT NULL,\s+CONSTRAINT pending_posts_post_id_fk\s+FOREIGN KEY\(post_id\) REFERENCES posts\(id\) ON DELETE CASCADE,\s+CONSTRAINT pending_posts_pk PRIMARY KEY \(post_id\) \)`,
 		`CREATE TABLE staff\(\s+id BIGSERIAL PRIMARY KEY,\s+username VARCHAR\(45\) NOT NULL,\s+password_checksum VARCHAR\(120\) NOT NULL,\s+global_rank INT,\s+added_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+last_login TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+is_active BOOL NOT NULL DEFAULT TRUE,\s+CONSTRAINT staff_username_unique UNIQUE\(username\) \)`,
 		`CREATE TABLE sessions\(\s+id BIGSERIAL PRIMARY KEY,\s+staff_id BIGINT NOT NULL,\s+expires TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+data VARCHAR\(45\) NOT NULL,\s+CONSTRAINT sessions_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\) ON DELETE CASCADE \)`,
 		`CREATE TABLE board_staff\(\s+board_id BIGINT NOT NULL,\s+staff_id BIGINT NOT NULL,  CONSTRAINT board_staff_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT board_staff_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\) ON DELETE CASCADE,\s+CONSTRAINT board_staff_pk PRIMARY KEY \(board_id,staff_id\) \)`,
@@ -58,8 +65,11 @@ var (
 		`CREATE TABLE filename_ban\(\s+id BIGSERIAL PRIMARY KEY,\s+board_id BIGINT,\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+filename VARCHAR\(255\) NOT NULL,\s+is_regex BOOL NOT NULL,\s+CONSTRAINT filename_ban_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT filename_ban_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\) \)`,
 		`CREATE TABLE username_ban\(\s+id BIGSERIAL PRIMARY KEY,\s+board_id BIGINT,\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+username VARCHAR\(255\) NOT NULL,\s+is_regex BOOL NOT NULL,\s+CONSTRAINT username_ban_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT username_ban_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\) \)`,
 		`CREATE TABLE file_ban\(\s+id BIGSERIAL PRIMARY KEY,\s+board_id BIGINT,\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+checksum TEXT NOT NULL,\s+fingerprinter VARCHAR\(64\),\s+ban_ip BOOL NOT NULL,\s+ban_ip_message TEXT,\s+CONSTRAINT file_ban_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT file_ban_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\)\s+\)`,
-		`CREATE TABLE wordfilters\(\s+id BIGSERIAL PRIMARY KEY,\s+board_dirs VARCHAR\(255\) DEFAULT '\*',\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+search VARCHAR\(75\) NOT NULL,\s+is_regex BOOL NOT NULL,\s+change_to VARCHAR\(75\) NOT NULL,\s+CONSTRAINT wordfilters_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\),\s+CONSTRAINT wordfilters_search_check CHECK \(search <> ''\) \)`,
-		`INSERT INTO database_version\(component, version\)\s+VALUES\('gochan', 3\)`,
+		`CREATE TABLE wordfilters\(\s+id BIGSERIAL PRIMARY KEY,\s+board_dirs VARCHAR\(255\) DEFAULT '\*',\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+search VARCHAR\(75\) NOT NULL,\s+is_regex BOOL NOT NULL,\s+change_to VARCHAR\(75\) NOT NULL,\s+action VARCHAR\(10\) NOT NULL DEFAULT 'replace',\s+ban_duration VARCHAR\(32\) NOT NULL DEFAULT '',\s+hits INT NOT NULL DEFAULT 0,\s+last_hit_at TIMESTAMP NULL,\s+CONSTRAINT wordfilters_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\),\s+CONSTRAINT wordfilters_search_check CHECK \(search <> ''\) \)`,
+		`CREATE TABLE r9k_hashes\(\s+board_id BIGINT NOT NULL,\s+hash CHAR\(64\) NOT NULL,\s+CONSTRAINT r9k_hashes_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT r9k_hashes_pk PRIMARY KEY \(board_id,hash\) \)`,
+		`CREATE TABLE r9k_mutes\(\s+board_id BIGINT NOT NULL,\s+ip INET NOT NULL,\s+mute_count INT NOT NULL DEFAULT 0,\s+expires_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+CONSTRAINT r9k_mutes_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT r9k_mutes_pk PRIMARY KEY \(board_id,ip\) \)`,
+		`CREATE TABLE rate_limits\(\s+bucket_key VARCHAR\(128\) NOT NULL,\s+tokens BIGINT NOT NULL,\s+updated_ms BIGINT NOT NULL,\s+CONSTRAINT rate_limits_pk PRIMARY KEY \(bucket_key\) \)`,
+		`INSERT INTO database_version\(component, version\)\s+VALUES\('gochan', 4\)`,
 	}
 	testInitDBSQLite3Statements = []string{
 		`CREATE TABLE database_version\(\s+component VARCHAR\(40\) NOT NULL PRIMARY KEY,\s+version INT NOT NULL \)`,
@@ -67,9 +77,11 @@ var (
 		`CREATE TABLE boards\(\s*id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+section_id BIGINT NOT NULL,\s+uri VARCHAR\(45\) NOT NULL,\s+dir VARCHAR\(45\) NOT NULL,\s+navbar_position SMALLINT NOT NULL,\s+title VARCHAR\(45\) NOT NULL,\s+subtitle VARCHAR\(64\) NOT NULL,\s+description VARCHAR\(64\) NOT NULL,\s+max_file_size INT NOT NULL,\s+max_threads SMALLINT NOT NULL,  default_style VARCHAR\(45\) NOT NULL,\s+locked BOOL NOT NULL,\s+created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+anonymous_name VARCHAR\(45\) NOT NULL DEFAULT 'Anonymous',\s+force_anonymous BOOL NOT NULL,\s+autosage_after SMALLINT NOT NULL,\s+no_images_after SMALLINT NOT NULL,\s+max_message_length SMALLINT NOT NULL,\s+min_message_length SMALLINT NOT NULL,\s+allow_embeds BOOL NOT NULL,\s+redirect_to_thread BOOL NOT NULL,\s+require_file BOOL NOT NULL,\s+enable_catalog BOOL NOT NULL,\s+CONSTRAINT boards_section_id_fk\s+FOREIGN KEY\(section_id\) REFERENCES sections\(id\),\s+CONSTRAINT boards_dir_unique UNIQUE\(dir\),\s+CONSTRAINT boards_uri_unique UNIQUE\(uri\)\s*\)`,
 		`CREATE TABLE threads\(\s*id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+board_id BIGINT NOT NULL,\s+locked BOOL NOT NULL DEFAULT FALSE,\s+stickied BOOL NOT NULL DEFAULT FALSE,\s+anchored BOOL NOT NULL DEFAULT FALSE,\s+cyclical BOOL NOT NULL DEFAULT FALSE,\s+last_bump TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+is_deleted BOOL NOT NULL DEFAULT FALSE,\s+CONSTRAINT threads_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE\s*\)`,
 		`CREATE INDEX thread_deleted_index ON threads\(is_deleted\)`,
-		`CREATE TABLE posts\(\s+id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+thread_id BIGINT NOT NULL,\s+is_top_post BOOL NOT NULL DEFAULT FALSE,\s+ip VARCHAR\(45\) NOT NULL,\s+created_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+name VARCHAR\(50\) NOT NULL DEFAULT '',\s+tripcode VARCHAR\(10\) NOT NULL DEFAULT '',\s+is_role_signature BOOL NOT NULL DEFAULT FALSE,  email VARCHAR\(50\) NOT NULL DEFAULT '',\s+subject VARCHAR\(100\) NOT NULL DEFAULT '',\s+message TEXT NOT NULL,\s+message_raw TEXT NOT NULL,\s+password TEXT NOT NULL,\s+deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+is_deleted BOOL NOT NULL DEFAULT FALSE,\s+banned_message TEXT,\s+flag VARCHAR\(45\) NOT NULL DEFAULT '',\s+country VARCHAR\(80\) NOT NULL DEFAULT '',\s+CONSTRAINT posts_thread_id_fk\s+FOREIGN KEY\(thread_id\) REFERENCES threads\(id\) ON DELETE CASCADE \)`,
+		`CREATE TABLE posts\(\s+id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+thread_id BIGINT NOT NULL,\s+is_top_post BOOL NOT NULL DEFAULT FALSE,\s+ip VARCHAR\(45\) NOT NULL,\s+created_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+name VARCHAR\(50\) NOT NULL DEFAULT '',\s+tripcode VARCHAR\(32\) NOT NULL DEFAULT '',\s+is_role_signature BOOL NOT NULL DEFAULT FALSE,  email VARCHAR\(50\) NOT NULL DEFAULT '',\s+subject VARCHAR\(100\) NOT NULL DEFAULT '',\s+message TEXT NOT NULL,\s+message_raw TEXT NOT NULL,\s+password TEXT NOT NULL,\s+deleted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+is_deleted BOOL NOT NULL DEFAULT FALSE,\s+banned_message TEXT,\s+flag VARCHAR\(45\) NOT NULL DEFAULT '',\s+country VARCHAR\(80\) NOT NULL DEFAULT '',\s+CONSTRAINT posts_thread_id_fk\s+FOREIGN KEY\(thread_id\) REFERENCES threads\(id\) ON DELETE CASCADE \)`,
 		`CREATE INDEX top_post_index ON posts\(is_top_post\)`,
-		`CREATE TABLE files\(\s+id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+post_id BIGINT NOT NULL,\s+file_order INT NOT NULL,\s+original_filename VARCHAR\(255\) NOT NULL,\s+filename VARCHAR\(45\) NOT NULL,\s+checksum TEXT NOT NULL,\s+file_size INT NOT NULL,\s+is_spoilered BOOL NOT NULL,\s+thumbnail_width INT NOT NULL,\s+thumbnail_height INT NOT NULL,\s+width INT NOT NULL,\s+height INT NOT NULL,\s+CONSTRAINT files_post_id_fk\s+FOREIGN KEY\(post_id\) REFERENCES posts\(id\) ON DELETE CASCADE,\s+CONSTRAINT files_post_id_file_order_unique UNIQUE\(post_id, file_order\) \)`,
+		`CREATE TABLE files\(\s+id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+post_id BIGINT NOT NULL,\s+file_order INT NOT NULL,\s+original_filename VARCHAR\(255\) NOT NULL,\s+filename VARCHAR\(45\) NOT NULL,\s+checksum TEXT NOT NULL,\s+file_size INT NOT NULL,\s+is_spoilered BOOL NOT NULL,\s+thumbnail_width INT NOT NULL,\s+thumbnail_height INT NOT NULL,\s+width INT NOT NULL,\s+height INT NOT NULL,\s+fingerprint VARCHAR\(64\) NOT NULL DEFAULT '',\s+CONSTRAINT files_post_id_fk\s+FOREIGN KEY\(post_id\) REFERENCES posts\(id\) ON DELETE CASCADE,\s+CONSTRAINT files_post_id_file_order_unique UNIQUE\(post_id, file_order\) \)`,
+		`CREATE TABLE post_commands\(\s+post_id BIGINT NOT NULL,\s+command_order INT NOT NULL,\s+command VARCHAR\(32\) NOT NULL,\s+args VARCHAR\(100\) NOT NULL DEFAULT '',\s+result VARCHAR\(255\) NOT NULL,\s+CONSTRAINT post_commands_post_id_fk\s+FOREIGN KEY\(post_id\) REFERENCES posts\(id\) ON DELETE CASCADE,\s+CONSTRAINT post_commands_pk PRIMARY KEY \(post_id,command_order\) \)`,
+		`CREATE TABLE pending_posts\(\s+post_id BIGINT NOT NULL,\s+reason VARCHAR\(255\) NOT NULL,\s+bump_thread BOOL NOT NULL,\s+CONSTRAINT pending_posts_post_id_fk\s+FOREIGN KEY\(post_id\) REFERENCES posts\(id\) ON DELETE CASCADE,\s+CONSTRAINT pending_posts_pk PRIMARY KEY \(post_id\) \)`,
 		`CREATE TABLE staff\(\s+id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+username VARCHAR\(45\) NOT NULL,\s+password_checksum VARCHAR\(120\) NOT NULL,\s+global_rank INT,\s+added_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+last_login TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+is_active BOOL NOT NULL DEFAULT TRUE,\s+CONSTRAINT staff_username_unique UNIQUE\(username\) \)`,
 		`CREATE TABLE sessions\(\s+id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+staff_id BIGINT NOT NULL,\s+expires TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+data VARCHAR\(45\) NOT NULL,\s+CONSTRAINT sessions_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\) ON DELETE CASCADE \)`,
 		`CREATE TABLE board_staff\(\s+board_id BIGINT NOT NULL,\s+staff_id BIGINT NOT NULL,  CONSTRAINT board_staff_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT board_staff_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\) ON DELETE CASCADE,\s+CONSTRAINT board_staff_pk PRIMARY KEY \(board_id,staff_id\) \)`,
@@ -83,8 +95,11 @@ var (
 		`CREATE TABLE filename_ban\(\s+id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+board_id BIGINT,\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+filename VARCHAR\(255\) NOT NULL,\s+is_regex BOOL NOT NULL,\s+CONSTRAINT filename_ban_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT filename_ban_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\) \)`,
 		`CREATE TABLE username_ban\(\s+id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+board_id BIGINT,\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+username VARCHAR\(255\) NOT NULL,\s+is_regex BOOL NOT NULL,\s+CONSTRAINT username_ban_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT username_ban_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\) \)`,
 		`CREATE TABLE file_ban\(\s+id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+board_id BIGINT,\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+checksum TEXT NOT NULL,\s+fingerprinter VARCHAR\(64\),\s+ban_ip BOOL NOT NULL,\s+ban_ip_message TEXT,\s+CONSTRAINT file_ban_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT file_ban_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\)\s+\)`,
-		`CREATE TABLE wordfilters\(\s+id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+board_dirs VARCHAR\(255\) DEFAULT '\*',\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+search VARCHAR\(75\) NOT NULL,\s+is_regex BOOL NOT NULL,\s+change_to VARCHAR\(75\) NOT NULL,\s+CONSTRAINT wordfilters_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\),\s+CONSTRAINT wordfilters_search_check CHECK \(search <> ''\) \)`,
-		`INSERT INTO database_version\(component, version\)\s+VALUES\('gochan', 3\)`,
+		`CREATE TABLE wordfilters\(\s+id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,\s+board_dirs VARCHAR\(255\) DEFAULT '\*',\s+staff_id BIGINT NOT NULL,\s+staff_note VARCHAR\(255\) NOT NULL,\s+issued_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+search VARCHAR\(75\) NOT NULL,\s+is_regex BOOL NOT NULL,\s+change_to VARCHAR\(75\) NOT NULL,\s+action VARCHAR\(10\) NOT NULL DEFAULT 'replace',\s+ban_duration VARCHAR\(32\) NOT NULL DEFAULT '',\s+hits INT NOT NULL DEFAULT 0,\s+last_hit_at TIMESTAMP NULL,\s+CONSTRAINT wordfilters_staff_id_fk\s+FOREIGN KEY\(staff_id\) REFERENCES staff\(id\),\s+CONSTRAINT wordfilters_search_check CHECK \(search <> ''\) \)`,
+		`CREATE TABLE r9k_hashes\(\s+board_id BIGINT NOT NULL,\s+hash CHAR\(64\) NOT NULL,\s+CONSTRAINT r9k_hashes_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT r9k_hashes_pk PRIMARY KEY \(board_id,hash\) \)`,
+		`CREATE TABLE r9k_mutes\(\s+board_id BIGINT NOT NULL,\s+ip VARCHAR\(45\) NOT NULL,\s+mute_count INT NOT NULL DEFAULT 0,\s+expires_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,\s+CONSTRAINT r9k_mutes_board_id_fk\s+FOREIGN KEY\(board_id\) REFERENCES boards\(id\) ON DELETE CASCADE,\s+CONSTRAINT r9k_mutes_pk PRIMARY KEY \(board_id,ip\) \)`,
+		`CREATE TABLE rate_limits\(\s+bucket_key VARCHAR\(128\) NOT NULL,\s+tokens BIGINT NOT NULL,\s+updated_ms BIGINT NOT NULL,\s+CONSTRAINT rate_limits_pk PRIMARY KEY \(bucket_key\) \)`,
+		`INSERT INTO database_version\(component, version\)\s+VALUES\('gochan', 4\)`,
 	}
 )
 
@@ -86,6 +86,21 @@ func (s *Staff) RankTitle() string {
 	return ""
 }
 
+// RankCapcode returns the capcode shown on posts made by staff of the given rank with a role signature,
+// or an empty string if the rank isn't a staff rank. It is stored in the post's tripcode column, so it must
+// not be longer than 10 characters
+func RankCapcode(rank int) string {
+	switch rank {
+	case 3:
+		return "Admin"
+	case 2:
+		return "Moderator"
+	case 1:
+		return "Janitor"
+	}
+	return ""
+}
+
 func UpdatePassword(username string, newPassword string) error {
 	const sqlUPDATE = `UPDATE DBPREFIXstaff SET password_checksum = ? WHERE username = ?`
 	checksum := gcutil.BcryptSum(newPassword)
@@ -158,6 +173,20 @@ func GetStaffBySession(session string) (*Staff, error) {
 	return staff, err
 }
 
+// GetStaffFromRequest returns the staff making the request. If the request does not have
+// a staff cookie, it will return a staff object with rank 0.
+func GetStaffFromRequest(request *http.Request) (*Staff, error) {
+	sessionCookie, err := request.Cookie("sessiondata")
+	if err != nil {
+		return &Staff{Rank: 0}, nil
+	}
+	staff, err := GetStaffBySession(sessionCookie.Value)
+	if err != nil {
+		staff = &Staff{Rank: 0}
+	}
+	return staff, err
+}
+
 func GetStaffByUsername(username string, onlyActive bool) (*Staff, error) {
 	query := `SELECT 
 	id, username, password_checksum, global_rank, added_on, last_login, is_active
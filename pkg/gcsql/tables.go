@@ -131,6 +131,7 @@ type Upload struct {
 	ThumbnailHeight  int    // sql: `thumbnail_height`
 	Width            int    // sql: `width`
 	Height           int    // sql: `height`
+	Fingerprint      string // sql: `fingerprint`
 }
 
 // IPBanBase used to composition IPBan and IPBanAudit. It does not represent a SQL table by itself
@@ -237,6 +238,33 @@ type Post struct {
 	Country         string        // sql: `country`
 }
 
+// PendingPost is a post that is being held for approval by a moderator, along with the reason it was held.
+// table: DBPREFIXpending_posts
+type PendingPost struct {
+	Post
+	Reason     string // sql: `reason`
+	BumpThread bool   // sql: `bump_thread`
+	BoardID    int
+	BoardDir   string
+}
+
+// table: DBPREFIXpost_commands
+type PostCommandResult struct {
+	PostID  int    // sql: `post_id`
+	Order   int    // sql: `command_order`
+	Command string // sql: `command`
+	Args    string // sql: `args`
+	Result  string // sql: `result`
+}
+
+// table: DBPREFIXr9k_mutes
+type R9KMute struct {
+	BoardID   int       // sql: `board_id`
+	IP        string    // sql: `ip`
+	MuteCount int       // sql: `mute_count`
+	ExpiresAt time.Time // sql: `expires_at`
+}
+
 // table: DBPREFIXreports
 type Report struct {
 	ID               int    // sql: `id`
@@ -312,4 +340,9 @@ type Wordfilter struct {
 	Search    string    `json:"search"`     // sql: `search`
 	IsRegex   bool      `json:"is_regex"`   // sql: `is_regex`
 	ChangeTo  string    `json:"change_to"`  // sql: `change_to`
+	// Action is what is done to posts that match the filter, see the Wordfilter* action constants
+	Action      string     `json:"action"`       // sql: `action`
+	BanDuration string     `json:"ban_duration"` // sql: `ban_duration`
+	Hits        int        `json:"hits"`         // sql: `hits`
+	LastHitAt   *time.Time `json:"last_hit_at"`  // sql: `last_hit_at`
 }
@@ -205,6 +205,55 @@ func (t *Thread) GetUploads() ([]Upload, error) {
 	return uploads, nil
 }
 
+// DeleteOldCyclicalReplies soft-deletes the oldest replies in the thread that exceed maxReplies and returns the IDs
+// of the deleted posts. It does nothing if the thread is not cyclical or maxReplies < 1
+func (t *Thread) DeleteOldCyclicalReplies(maxReplies int) ([]int, error) {
+	if !t.Cyclical || maxReplies < 1 {
+		return nil, nil
+	}
+	tx, err := BeginTx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := QueryTxSQL(tx, `SELECT id FROM DBPREFIXposts
+		WHERE thread_id = ? AND is_top_post = FALSE AND is_deleted = FALSE ORDER BY id DESC`, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var postIDs []int
+	var postIDsAny []interface{}
+	var id int
+	var repliesProcessed int
+	for rows.Next() {
+		repliesProcessed++
+		if repliesProcessed <= maxReplies {
+			continue
+		}
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		postIDs = append(postIDs, id)
+		postIDsAny = append(postIDsAny, id)
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+	if postIDs == nil {
+		// no replies to trim
+		return nil, nil
+	}
+
+	if _, err = ExecTxSQL(tx, `UPDATE DBPREFIXposts SET is_deleted = TRUE, deleted_at = CURRENT_TIMESTAMP WHERE id IN `+
+		createArrayPlaceholder(postIDsAny), postIDsAny...); err != nil {
+		return nil, err
+	}
+	return postIDs, tx.Commit()
+}
+
 // UpdateAttribute updates the given attribute (valid attribute values are "locked", "stickied, "anchored",
 // or "cyclical") for the thread
 func (t *Thread) UpdateAttribute(attribute string, value bool) error {
@@ -230,10 +279,15 @@ func (t *Thread) UpdateAttribute(attribute string, value bool) error {
 func deleteThread(threadID int) error {
 	const deletePostsSQL = `UPDATE DBPREFIXposts SET is_deleted = TRUE, deleted_at = CURRENT_TIMESTAMP WHERE thread_id = ?`
 	const deleteThreadSQL = `UPDATE DBPREFIXthreads SET is_deleted = TRUE, deleted_at = CURRENT_TIMESTAMP WHERE id = ?`
+	const deletePendingSQL = `DELETE FROM DBPREFIXpending_posts
+	WHERE post_id IN (SELECT id FROM DBPREFIXposts WHERE thread_id = ?)`
 	_, err := ExecSQL(deletePostsSQL, threadID)
 	if err != nil {
 		return err
 	}
-	_, err = ExecSQL(deleteThreadSQL, threadID)
+	if _, err = ExecSQL(deleteThreadSQL, threadID); err != nil {
+		return err
+	}
+	_, err = ExecSQL(deletePendingSQL, threadID)
 	return err
 }
@@ -16,6 +16,37 @@ var (
 	ErrAlreadyAttached = errors.New("upload already processed")
 )
 
+func getBoardUploadPostID(query string, boardID int, hash string) (int, error) {
+	var postID int
+	err := QueryRowSQL(query, interfaceSlice(boardID, hash), interfaceSlice(&postID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return postID, err
+}
+
+// GetUploadPostIDByChecksum returns the ID of a non-deleted post on the given board with an upload that has the
+// given checksum, or 0 if there isn't one
+func GetUploadPostIDByChecksum(boardID int, checksum string) (int, error) {
+	const query = `SELECT DBPREFIXposts.id FROM DBPREFIXfiles
+		JOIN DBPREFIXposts ON post_id = DBPREFIXposts.id
+		JOIN DBPREFIXthreads ON thread_id = DBPREFIXthreads.id
+		WHERE board_id = ? AND checksum = ? AND DBPREFIXposts.is_deleted = FALSE AND filename != 'deleted'
+		ORDER BY DBPREFIXposts.id DESC LIMIT 1`
+	return getBoardUploadPostID(query, boardID, checksum)
+}
+
+// GetUploadPostIDByFingerprint returns the ID of a non-deleted post on the given board with an upload that has the
+// given perceptual hash fingerprint, or 0 if there isn't one
+func GetUploadPostIDByFingerprint(boardID int, fingerprint string) (int, error) {
+	const query = `SELECT DBPREFIXposts.id FROM DBPREFIXfiles
+		JOIN DBPREFIXposts ON post_id = DBPREFIXposts.id
+		JOIN DBPREFIXthreads ON thread_id = DBPREFIXthreads.id
+		WHERE board_id = ? AND fingerprint = ? AND DBPREFIXposts.is_deleted = FALSE AND filename != 'deleted'
+		ORDER BY DBPREFIXposts.id DESC LIMIT 1`
+	return getBoardUploadPostID(query, boardID, fingerprint)
+}
+
 // GetThreadFiles gets a list of the files owned by posts in the thread, including thumbnails for convenience.
 func GetThreadFiles(post *Post) ([]Upload, error) {
 	query := selectFilesBaseSQL + `WHERE post_id IN (
@@ -40,6 +71,45 @@ func GetThreadFiles(post *Post) ([]Upload, error) {
 	return uploads, nil
 }
 
+// GetUploads returns all of the uploads attached to the post, in the order they were uploaded
+func (p *Post) GetUploads() ([]Upload, error) {
+	uploads, err := GetUploadsByPostIDs(p.ID)
+	if err != nil {
+		return nil, err
+	}
+	return uploads[p.ID], nil
+}
+
+// GetUploadsByPostIDs returns a map of the given post IDs to their uploads, in the order they were uploaded.
+// Posts without uploads are not included in the map
+func GetUploadsByPostIDs(postIDs ...int) (map[int][]Upload, error) {
+	uploads := make(map[int][]Upload)
+	if len(postIDs) == 0 {
+		return uploads, nil
+	}
+	params := make([]any, len(postIDs))
+	for i, id := range postIDs {
+		params[i] = id
+	}
+	query := selectFilesBaseSQL + `WHERE post_id IN ` + createArrayPlaceholder(params) + ` ORDER BY post_id, file_order`
+	rows, err := QuerySQL(query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var upload Upload
+		if err = rows.Scan(
+			&upload.ID, &upload.PostID, &upload.FileOrder, &upload.OriginalFilename, &upload.Filename, &upload.Checksum,
+			&upload.FileSize, &upload.IsSpoilered, &upload.ThumbnailWidth, &upload.ThumbnailHeight, &upload.Width, &upload.Height,
+		); err != nil {
+			return nil, err
+		}
+		uploads[upload.PostID] = append(uploads[upload.PostID], upload)
+	}
+	return uploads, rows.Close()
+}
+
 func (p *Post) nextFileOrder() (int, error) {
 	const query = `SELECT COALESCE(MAX(file_order) + 1, 0) FROM DBPREFIXfiles WHERE post_id = ?`
 	var next int
@@ -53,8 +123,8 @@ func (p *Post) AttachFile(upload *Upload) error {
 	}
 	const query = `INSERT INTO DBPREFIXfiles (
 		post_id, file_order, original_filename, filename, checksum, file_size,
-		is_spoilered, thumbnail_width, thumbnail_height, width, height)
-	VALUES(?,?,?,?,?,?,?,?,?,?,?)`
+		is_spoilered, thumbnail_width, thumbnail_height, width, height, fingerprint)
+	VALUES(?,?,?,?,?,?,?,?,?,?,?,?)`
 	if upload.ID > 0 {
 		return ErrAlreadyAttached
 	}
@@ -79,6 +149,7 @@ func (p *Post) AttachFile(upload *Upload) error {
 	if _, err = stmt.Exec(
 		&upload.PostID, &upload.FileOrder, &upload.OriginalFilename, &upload.Filename, &upload.Checksum, &upload.FileSize,
 		&upload.IsSpoilered, &upload.ThumbnailWidth, &upload.ThumbnailHeight, &upload.Width, &upload.Height,
+		&upload.Fingerprint,
 	); err != nil {
 		return err
 	}
@@ -95,7 +166,7 @@ func GetUploadFilenameAndBoard(postID int) (string, string, error) {
 		JOIN DBPREFIXposts ON post_id = DBPREFIXposts.id
 		JOIN DBPREFIXthreads ON thread_id = DBPREFIXthreads.id
 		JOIN DBPREFIXboards ON DBPREFIXboards.id = board_id
-		WHERE DBPREFIXposts.id = ?`
+		WHERE DBPREFIXposts.id = ? ORDER BY file_order LIMIT 1`
 	var filename, dir string
 	err := QueryRowSQL(query, []any{postID}, []any{&filename, &dir})
 	if errors.Is(err, sql.ErrNoRows) {
@@ -1,14 +1,50 @@
 package gcsql
 
 import (
+	"errors"
+	"html/template"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/Eggbertx/durationutil"
+)
+
+const (
+	// WordfilterReplace replaces the matched text with the filter's ChangeTo value
+	WordfilterReplace = "replace"
+	// WordfilterReject rejects the post, using ChangeTo as the message shown to the poster
+	WordfilterReject = "reject"
+	// WordfilterBan rejects the post and bans the poster's IP for BanDuration (or permanently if it is empty),
+	// using ChangeTo as the ban message
+	WordfilterBan = "ban"
+	// WordfilterHold holds the post for review by a moderator before it is shown
+	WordfilterHold = "hold"
+)
+
+var (
+	ErrInvalidWordfilterAction = errors.New("invalid wordfilter action")
 )
 
+// ValidateWordfilterAction returns an error if the action is not one of the Wordfilter* action constants, or
+// if it is a ban with an invalid duration
+func ValidateWordfilterAction(action string, banDuration string) error {
+	switch action {
+	case WordfilterReplace, WordfilterReject, WordfilterHold:
+		return nil
+	case WordfilterBan:
+		if banDuration == "" {
+			return nil
+		}
+		_, err := durationutil.ParseLongerDuration(banDuration)
+		return err
+	}
+	return ErrInvalidWordfilterAction
+}
+
 // CreateWordFilter inserts the given wordfilter data into the database and returns a pointer to a new WordFilter struct
 // boards should be a comma separated list of board strings, or "*" for all boards
-func CreateWordFilter(from string, to string, isRegex bool, boards string, staffID int, staffNote string) (*Wordfilter, error) {
+func CreateWordFilter(from string, to string, isRegex bool, boards string, staffID int, staffNote string, action string, banDuration string) (*Wordfilter, error) {
 	var err error
 	if isRegex {
 		_, err = regexp.Compile(from)
@@ -16,23 +52,28 @@ func CreateWordFilter(from string, to string, isRegex bool, boards string, staff
 			return nil, err
 		}
 	}
+	if err = ValidateWordfilterAction(action, banDuration); err != nil {
+		return nil, err
+	}
 
 	_, err = ExecSQL(`INSERT INTO DBPREFIXwordfilters
-		(board_dirs,staff_id,staff_note,search,is_regex,change_to)
-		VALUES(?,?,?,?,?,?)`, boards, staffID, staffNote, from, isRegex, to)
+		(board_dirs,staff_id,staff_note,search,is_regex,change_to,action,ban_duration)
+		VALUES(?,?,?,?,?,?,?,?)`, boards, staffID, staffNote, from, isRegex, to, action, banDuration)
 	if err != nil {
 		return nil, err
 	}
 	boardsPtr := new(string)
 	*boardsPtr = boards
 	return &Wordfilter{
-		BoardDirs: boardsPtr,
-		StaffID:   staffID,
-		StaffNote: staffNote,
-		IssuedAt:  time.Now(),
-		Search:    from,
-		IsRegex:   isRegex,
-		ChangeTo:  to,
+		BoardDirs:   boardsPtr,
+		StaffID:     staffID,
+		StaffNote:   staffNote,
+		IssuedAt:    time.Now(),
+		Search:      from,
+		IsRegex:     isRegex,
+		ChangeTo:    to,
+		Action:      action,
+		BanDuration: banDuration,
 	}, err
 }
 
@@ -40,7 +81,8 @@ func CreateWordFilter(from string, to string, isRegex bool, boards string, staff
 // encountered
 func GetWordfilters() ([]Wordfilter, error) {
 	var wfs []Wordfilter
-	query := `SELECT id,board_dirs,staff_id,staff_note,issued_at,search,is_regex,change_to FROM DBPREFIXwordfilters`
+	query := `SELECT id,board_dirs,staff_id,staff_note,issued_at,search,is_regex,change_to,action,ban_duration,
+	hits,last_hit_at FROM DBPREFIXwordfilters`
 	rows, err := QuerySQL(query)
 	if err != nil {
 		return wfs, err
@@ -57,6 +99,10 @@ func GetWordfilters() ([]Wordfilter, error) {
 			&wf.Search,
 			&wf.IsRegex,
 			&wf.ChangeTo,
+			&wf.Action,
+			&wf.BanDuration,
+			&wf.Hits,
+			&wf.LastHitAt,
 		); err != nil {
 			return wfs, err
 		}
@@ -109,9 +155,25 @@ func (wf *Wordfilter) StaffName() string {
 	return staff
 }
 
+// Matches returns true if the wordfilter's search string or regular expression matches the message
+func (wf *Wordfilter) Matches(message string) (bool, error) {
+	if wf.IsRegex {
+		re, err := regexp.Compile(wf.Search)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(message), nil
+	}
+	return strings.Contains(message, wf.Search), nil
+}
+
 // Apply runs the current wordfilter on the given string, without checking the board or (re)building the post
-// It returns an error if it is a regular expression and regexp.Compile failed to parse it
+// It returns an error if it is a regular expression and regexp.Compile failed to parse it. Filters with an
+// action other than WordfilterReplace don't change the message
 func (wf *Wordfilter) Apply(message string) (string, error) {
+	if wf.Action != "" && wf.Action != WordfilterReplace {
+		return message, nil
+	}
 	if wf.IsRegex {
 		re, err := regexp.Compile(wf.Search)
 		if err != nil {
@@ -123,3 +185,56 @@ func (wf *Wordfilter) Apply(message string) (string, error) {
 	}
 	return message, nil
 }
+
+// RecordHit increments the number of posts the wordfilter has matched and sets the time of its last hit
+func (wf *Wordfilter) RecordHit() error {
+	const updateSQL = `UPDATE DBPREFIXwordfilters SET hits = hits + 1, last_hit_at = ? WHERE id = ?`
+	now := time.Now()
+	if _, err := ExecSQL(updateSQL, now, wf.ID); err != nil {
+		return err
+	}
+	wf.Hits++
+	wf.LastHitAt = &now
+	return nil
+}
+
+// ApplyIPBan bans the given IP for posting a message matching a wordfilter with the WordfilterBan action.
+// If the filter is only applied to some boards, the ban is only for the board the post was made on.
+// If the action is something else, it returns with no error
+func (wf *Wordfilter) ApplyIPBan(postIP string, boardID int, postText string) error {
+	if wf.Action != WordfilterBan {
+		return nil
+	}
+	now := time.Now()
+	ipBan := &IPBan{
+		RangeStart:   postIP,
+		RangeEnd:     postIP,
+		IssuedAt:     now,
+		CopyPostText: template.HTML(template.HTMLEscapeString(postText)), // skipcq: GSC-G203
+	}
+	ipBan.IsActive = true
+	ipBan.CanAppeal = true
+	ipBan.AppealAt = now
+	ipBan.StaffID = wf.StaffID
+	if wf.BanDuration == "" {
+		ipBan.Permanent = true
+		ipBan.ExpiresAt = now
+	} else {
+		duration, err := durationutil.ParseLongerDuration(wf.BanDuration)
+		if err != nil {
+			return err
+		}
+		ipBan.ExpiresAt = now.Add(duration)
+	}
+	if wf.BoardsString() != "*" {
+		ipBan.BoardID = new(int)
+		*ipBan.BoardID = boardID
+	}
+	if wf.ChangeTo == "" {
+		ipBan.Message = "posting a message caught by a wordfilter, resulting in ban"
+	} else {
+		ipBan.Message = wf.ChangeTo
+	}
+	ipBan.StaffNote = "wordfilter"
+	return NewIPBan(ipBan)
+}
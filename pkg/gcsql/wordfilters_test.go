@@ -0,0 +1,66 @@
+package gcsql
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateWordfilterAction(t *testing.T) {
+	assert.NoError(t, ValidateWordfilterAction(WordfilterReplace, ""))
+	assert.NoError(t, ValidateWordfilterAction(WordfilterReject, ""))
+	assert.NoError(t, ValidateWordfilterAction(WordfilterHold, ""))
+	assert.NoError(t, ValidateWordfilterAction(WordfilterBan, ""), "empty ban duration should be permanent")
+	assert.NoError(t, ValidateWordfilterAction(WordfilterBan, "3d12h"))
+	assert.Error(t, ValidateWordfilterAction(WordfilterBan, "not a duration"))
+	assert.ErrorIs(t, ValidateWordfilterAction("delete", ""), ErrInvalidWordfilterAction)
+}
+
+func TestWordfilterActions(t *testing.T) {
+	replace := Wordfilter{Search: "foo", ChangeTo: "bar", Action: WordfilterReplace}
+	result, err := replace.Apply("foo baz")
+	assert.NoError(t, err)
+	assert.Equal(t, "bar baz", result)
+
+	reject := Wordfilter{Search: `fo+\b`, IsRegex: true, ChangeTo: "no foo allowed", Action: WordfilterReject}
+	matches, err := reject.Matches("fooo baz")
+	assert.NoError(t, err)
+	assert.True(t, matches)
+	result, err = reject.Apply("fooo baz")
+	assert.NoError(t, err)
+	assert.Equal(t, "fooo baz", result, "non-replace filters shouldn't change the message")
+
+	hold := Wordfilter{Search: "[", IsRegex: true, Action: WordfilterHold}
+	_, err = hold.Matches("baz")
+	assert.Error(t, err)
+}
+
+func TestWordfilterRecordHit(t *testing.T) {
+	for _, driver := range testingDBDrivers {
+		t.Run(driver, func(t *testing.T) {
+			config.SetTestDBConfig(driver, "localhost", "gochan", "gochan", "gochan", "")
+			db, mock, err := sqlmock.New()
+			if !assert.NoError(t, err) {
+				return
+			}
+			if !assert.NoError(t, SetTestingDB(driver, "gochan", "", db)) {
+				return
+			}
+
+			query := `UPDATE wordfilters SET hits = hits \+ 1, last_hit_at = \? WHERE id = \?`
+			if driver != "mysql" {
+				query = `UPDATE wordfilters SET hits = hits \+ 1, last_hit_at = \$1 WHERE id = \$2`
+			}
+			mock.ExpectPrepare(query).ExpectExec().WithArgs(sqlmock.AnyArg(), 3).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			wf := Wordfilter{ID: 3, Hits: 4}
+			assert.NoError(t, wf.RecordHit())
+			assert.Equal(t, 5, wf.Hits)
+			assert.NotNil(t, wf.LastHitAt)
+			assert.NoError(t, mock.ExpectationsWereMet())
+			closeMock(t, mock)
+		})
+	}
+}
@@ -30,6 +30,7 @@ const (
 	ManageIPSearch      = "manage_ipsearch.html"
 	ManageLogin         = "manage_login.html"
 	ManageNameBans      = "manage_namebans.html"
+	ManagePendingPosts  = "manage_pendingposts.html"
 	ManageRecentPosts   = "manage_recentposts.html"
 	ManageReports       = "manage_reports.html"
 	ManageSections      = "manage_sections.html"
@@ -104,6 +105,9 @@ var (
 		ManageNameBans: {
 			files: []string{"manage_namebans.html"},
 		},
+		ManagePendingPosts: {
+			files: []string{"manage_pendingposts.html"},
+		},
 		ManageRecentPosts: {
 			files: []string{"manage_recentposts.html"},
 		},
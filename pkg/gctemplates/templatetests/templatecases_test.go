@@ -198,6 +198,45 @@ var (
 				`</div></div></div>` +
 				`<div id="footer">Powered by<a href="http://github.com/gochan-org/gochan/">Gochan 3.10.1</a><br /></div></div></body></html>`,
 		},
+		{
+			desc: "R9K mute",
+			data: map[string]any{
+				"ban": &gcsql.IPBan{
+					BoardID:    &simpleBoard1.ID,
+					RangeStart: "192.168.56.1",
+					RangeEnd:   "192.168.56.1",
+					IPBanBase: gcsql.IPBanBase{
+						IsActive: true,
+						Message:  "mute message goes here",
+					},
+				},
+				"ip":         "192.168.56.1",
+				"board":      simpleBoard1,
+				"muted":      true,
+				"siteConfig": testingSiteConfig,
+				"systemCritical": config.SystemCriticalConfig{
+					WebRoot: "/",
+				},
+				"boardConfig": config.BoardConfig{
+					DefaultStyle: "pipes.css",
+				},
+			},
+			expectedOutput: `<!DOCTYPE html><html><head><title>Banned</title>` +
+				`<link rel="shortcut icon"href="/favicon.png">` +
+				`<link rel="stylesheet"href="/css/global.css"/>` +
+				`<link id="theme"rel="stylesheet"href="/css/pipes.css"/>` +
+				`<script type="text/javascript"src="/js/consts.js"></script>` +
+				`<script type="text/javascript"src="/js/gochan.js"></script></head>` +
+				`<body><div id="top-pane"><span id="site-title">Gochan</span><br /><span id="site-slogan">Gochan test</span></div><br />` +
+				`<div class="section-block"style="margin: 0px 26px 0px 24px">` +
+				`<div class="section-title-block"><span class="section-title"><b>YOU ARE MUTED</b></span></div>` +
+				`<div class="section-body"style="padding-top:8px"><div id="ban-info"style="float:left">You have been muted on<b>test</b>for the following reason:<br/><br/>` +
+				`<b>mute message goes here</b><br/><br/>` +
+				`Your mute will expire on&nbsp;<b>Mon,January 01,0001 12:00:00 AM</b>.<br />` +
+				`Your IP address is<b>192.168.56.1</b>.<br /><br/>` +
+				`</div></div></div>` +
+				`<div id="footer">Powered by<a href="http://github.com/gochan-org/gochan/">Gochan 3.10.1</a><br /></div></div></body></html>`,
+		},
 	}
 
 	boardPageTestCases = []templateTestCase{
@@ -10,6 +10,7 @@ import (
 	_ "github.com/gochan-org/gochan/pkg/gcsql/initsql"
 	"github.com/gochan-org/gochan/pkg/gctemplates"
 	"github.com/gochan-org/gochan/pkg/gcutil/testutil"
+	_ "github.com/gochan-org/gochan/pkg/posting"
 	_ "github.com/gochan-org/gochan/pkg/posting/uploads/inituploads"
 	"github.com/gochan-org/gochan/pkg/server/serverutil"
 	"github.com/stretchr/testify/assert"
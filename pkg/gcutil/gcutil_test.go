@@ -3,6 +3,7 @@ package gcutil
 import (
 	"errors"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -105,37 +106,90 @@ func TestNameParsing(t *testing.T) {
 			nameAndTrip:  "#",
 			expectedName: "",
 		},
+		{
+			nameAndTrip:      "Name##Trip",
+			expectedName:     "Name",
+			expectedTripcode: SecureTripcode("Trip", "seed"),
+		},
+		{
+			nameAndTrip:  "Name##",
+			expectedName: "Name",
+		},
 	}
 	for _, tC := range testCases {
 		t.Run(tC.nameAndTrip, func(t *testing.T) {
-			name, trip := ParseName(tC.nameAndTrip)
+			name, trip := ParseName(tC.nameAndTrip, "seed")
 			assert.Equal(t, tC.expectedName, name)
 			assert.Equal(t, tC.expectedTripcode, trip)
 		})
 	}
 }
 
+func TestSecureTripcode(t *testing.T) {
+	trip := SecureTripcode("Trip", "seed")
+	assert.Len(t, trip, len(SecureTripcodePrefix)+secureTripcodeLength)
+	assert.True(t, strings.HasPrefix(trip, SecureTripcodePrefix))
+	assert.Equal(t, trip, SecureTripcode("Trip", "seed"))
+	assert.NotEqual(t, trip, SecureTripcode("Trip", "other seed"), "the key should affect the tripcode")
+	assert.NotEqual(t, trip, SecureTripcode("trip", "seed"))
+}
+
 func TestGetRealIP(t *testing.T) {
 	const remoteAddr = "192.168.56.1"
 	const testIP = "192.168.56.2"
 	const cfIP = "192.168.56.3"
 	const forwardedIP = "192.168.56.4"
+	if !assert.NoError(t, SetTrustedProxies(nil)) {
+		return
+	}
 	req := &http.Request{
-		RemoteAddr: remoteAddr,
+		RemoteAddr: remoteAddr + ":12345",
 		Header:     make(http.Header),
 	}
 	assert.Equal(t, remoteAddr, GetRealIP(req))
 
 	req.Header.Set("X-Forwarded-For", forwardedIP)
-	assert.Equal(t, forwardedIP, GetRealIP(req))
+	req.Header.Set("CF-Connecting-IP", cfIP)
+	assert.Equal(t, remoteAddr, GetRealIP(req), "headers from untrusted peers should be ignored")
 
-	req.Header.Set("HTTP_CF_CONNECTING_IP", cfIP)
-	assert.Equal(t, cfIP, GetRealIP(req))
+	if !assert.NoError(t, SetTrustedProxies([]string{"192.168.56.0/30"})) {
+		return
+	}
+	defer SetTrustedProxies(nil)
+	assert.Equal(t, forwardedIP, GetRealIP(req),
+		"CF-Connecting-IP can be passed on from the client, so it shouldn't override X-Forwarded-For")
 
 	t.Setenv("GC_TESTIP", testIP)
 	assert.Equal(t, testIP, GetRealIP(req))
 }
 
+func TestForwardedForClient(t *testing.T) {
+	if !assert.NoError(t, SetTrustedProxies([]string{"10.0.0.0/8", "2001:db8::1"})) {
+		return
+	}
+	defer SetTrustedProxies(nil)
+	testCases := []struct {
+		desc     string
+		values   []string
+		expected string
+	}{
+		{desc: "single hop", values: []string{"192.168.56.1"}, expected: "192.168.56.1"},
+		{desc: "spoofed hop", values: []string{"1.2.3.4, 192.168.56.1"}, expected: "192.168.56.1"},
+		{desc: "trusted hops", values: []string{"1.2.3.4, 192.168.56.1, 10.0.0.2", "10.1.1.1"}, expected: "192.168.56.1"},
+		{desc: "all trusted", values: []string{"10.0.0.3, 2001:db8::1"}, expected: "10.0.0.3"},
+		{desc: "with port", values: []string{"192.168.56.1:1234"}, expected: "192.168.56.1"},
+		{desc: "mapped IPv4", values: []string{"::ffff:192.168.56.1"}, expected: "192.168.56.1"},
+		{desc: "invalid", values: []string{"192.168.56.1, garbage"}, expected: ""},
+		{desc: "empty", expected: ""},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, forwardedForClient(tC.values))
+		})
+	}
+	assert.Error(t, SetTrustedProxies([]string{"not an IP"}))
+}
+
 func TestHackyStringToInt(t *testing.T) {
 	i := HackyStringToInt("not an int")
 	assert.Zero(t, i)
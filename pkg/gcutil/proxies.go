@@ -0,0 +1,95 @@
+package gcutil
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+var (
+	trustedProxies      []netip.Prefix
+	trustedProxiesMutex sync.RWMutex
+)
+
+// SetTrustedProxies sets the IPs and CIDR ranges of the reverse proxies that are trusted to report the client's
+// IP address in request headers or PROXY protocol headers
+func SetTrustedProxies(proxies []string) error {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		if strings.ContainsRune(proxy, '/') {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	trustedProxiesMutex.Lock()
+	trustedProxies = prefixes
+	trustedProxiesMutex.Unlock()
+	return nil
+}
+
+func isTrustedProxyAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	trustedProxiesMutex.RLock()
+	defer trustedProxiesMutex.RUnlock()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTrustedProxy returns true if the IP address is in one of the trusted proxy ranges
+func IsTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	return err == nil && isTrustedProxyAddr(addr)
+}
+
+// IsTrustedProxyAddr returns true if the network address (usually from a connection's RemoteAddr) is a trusted
+// proxy
+func IsTrustedProxyAddr(addr net.Addr) bool {
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return IsTrustedProxy(addr.String())
+	}
+	return isTrustedProxyAddr(addrPort.Addr())
+}
+
+// forwardedForClient returns the right-most address in the X-Forwarded-For header values that isn't a trusted
+// proxy. Each proxy appends the address it received the request from, so anything to the left of that could have
+// been made up by the client. If every hop is trusted, the left-most one is returned
+func forwardedForClient(headerValues []string) string {
+	var hops []string
+	for _, value := range headerValues {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	var client string
+	for h := len(hops) - 1; h >= 0; h-- {
+		hop := strings.TrimSpace(hops[h])
+		addr, err := netip.ParseAddr(hop)
+		if err != nil {
+			// some proxies include the port
+			addrPort, portErr := netip.ParseAddrPort(hop)
+			if portErr != nil {
+				break
+			}
+			addr = addrPort.Addr()
+		}
+		client = addr.Unmap().String()
+		if !isTrustedProxyAddr(addr) {
+			break
+		}
+	}
+	return client
+}
@@ -1,8 +1,11 @@
 package gcutil
 
 import (
+	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha1" // skipcq GSC-G505
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -24,6 +27,9 @@ import (
 const (
 	// DefaultMaxAge is used for cookies that have an invalid or unset max age (default is 1 month)
 	DefaultMaxAge = 60 * 60 * 24 * 31
+	// SecureTripcodePrefix is added to the start of secure tripcodes, so they are displayed as !!tripcode
+	SecureTripcodePrefix = "!"
+	secureTripcodeLength = 10
 )
 
 var (
@@ -102,23 +108,24 @@ func GetFormattedFilesize(size float64) string {
 	return fmt.Sprintf("%0.2fGB", size/1024.0/1024.0/1024.0)
 }
 
-// GetRealIP checks the GC_TESTIP environment variable as well as HTTP_CF_CONNCTING_IP
-// and X-Forwarded-For HTTP headers to get a potentially obfuscated IP address, before
-// getting the request's reported remote address
+// GetRealIP returns the IP address of the client that made the request. The X-Forwarded-For header is only used
+// if the request came from a trusted proxy (see SetTrustedProxies). CF-Connecting-IP is ignored, since proxies in
+// front of gochan don't necessarily remove it from client requests. The GC_TESTIP environment variable overrides
+// everything, for testing
 func GetRealIP(request *http.Request) string {
 	ip, ok := os.LookupEnv("GC_TESTIP")
 	if ok {
 		return ip
 	}
-	if ip = request.Header.Get("HTTP_CF_CONNECTING_IP"); ip != "" {
-		return ip
-	}
-	if ip = request.Header.Get("X-Forwarded-For"); ip != "" {
-		return ip
-	}
 	remoteHost, _, err := net.SplitHostPort(request.RemoteAddr)
 	if err != nil {
-		return request.RemoteAddr
+		remoteHost = request.RemoteAddr
+	}
+	if !IsTrustedProxy(remoteHost) {
+		return remoteHost
+	}
+	if forwardedIP := forwardedForClient(request.Header.Values("X-Forwarded-For")); forwardedIP != "" {
+		return forwardedIP
 	}
 	return remoteHost
 }
@@ -146,20 +153,41 @@ func MarshalJSON(data interface{}, indent bool) (string, error) {
 	return string(jsonBytes), err
 }
 
-// ParseName takes a name string from a request object and returns the name and tripcode parts
-func ParseName(name string) (string, string) {
-	var namePart string
-	var tripcodePart string
-	if !strings.Contains(name, "#") {
-		namePart = name
-	} else if strings.Index(name, "#") == 0 {
-		tripcodePart = tripcode.Tripcode(name[1:])
-	} else if strings.Index(name, "#") > 0 {
-		postNameArr := strings.SplitN(name, "#", 2)
-		namePart = postNameArr[0]
-		tripcodePart = tripcode.Tripcode(postNameArr[1])
-	}
-	return namePart, tripcodePart
+// SplitName splits a name string from a request object into the name and the tripcode password. If the password
+// is separated from the name with ## instead of #, secure is true and the password should be used for a secure
+// tripcode
+func SplitName(name string) (namePart string, password string, secure bool) {
+	namePart, password, found := strings.Cut(name, "#")
+	if !found {
+		return namePart, "", false
+	}
+	if strings.HasPrefix(password, "#") {
+		return namePart, password[1:], true
+	}
+	return namePart, password, false
+}
+
+// SecureTripcode returns a tripcode generated from an HMAC of the password using the given key (normally the
+// site's RandomSeed), which can't be brute forced without knowing the key. It starts with SecureTripcodePrefix so
+// that it is displayed differently from a regular tripcode
+func SecureTripcode(password string, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	// the label keeps tripcodes from matching other values made with the same key, like poster IDs
+	mac.Write([]byte("tripcode:" + password))
+	return SecureTripcodePrefix + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:secureTripcodeLength]
+}
+
+// ParseName takes a name string from a request object and returns the name and tripcode parts. Names in the
+// form name##password get a secure tripcode generated using secureTripKey
+func ParseName(name string, secureTripKey string) (string, string) {
+	namePart, password, secure := SplitName(name)
+	if password == "" {
+		return namePart, ""
+	}
+	if secure {
+		return namePart, SecureTripcode(password, secureTripKey)
+	}
+	return namePart, tripcode.Tripcode(password)
 }
 
 // RandomString returns a randomly generated string of the given length
@@ -608,20 +608,43 @@ func rebuildBoardsCallback(_ http.ResponseWriter, _ *http.Request, _ *gcsql.Staf
 	return "Boards built successfully", nil
 }
 
-func reparseHTMLCallback(_ http.ResponseWriter, _ *http.Request, _ *gcsql.Staff, _ bool, _ *zerolog.Event, errEv *zerolog.Event) (output interface{}, err error) {
+// reparseHTMLCallback re-renders the HTML of every post's message (or only the posts on the board set in the board
+// form value) using the current formatting settings, e.g. after a board's MessageFormat has been changed
+func reparseHTMLCallback(_ http.ResponseWriter, request *http.Request, _ *gcsql.Staff, _ bool, infoEv *zerolog.Event, errEv *zerolog.Event) (output interface{}, err error) {
 	var outputStr string
+	// reload the board configuration(s) first so that the posts are formatted with the current MessageFormat
+	var board *gcsql.Board
+	if boardDir := request.FormValue("board"); boardDir != "" {
+		gcutil.LogStr("board", boardDir, infoEv, errEv)
+		if board, err = gcsql.GetBoardFromDir(boardDir); err != nil {
+			errEv.Err(err).Caller().Msg("Unable to get board")
+			return "", err
+		}
+		err = config.UpdateBoardConfig(board.Dir)
+	} else {
+		err = gcsql.ResetBoardSectionArrays()
+	}
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to reload board configuration")
+		return "", err
+	}
 	tx, err := gcsql.BeginTx()
 	if err != nil {
 		errEv.Err(err).Msg("Unable to begin transaction")
 		return "", errors.New("unable to begin SQL transaction")
 	}
 	defer tx.Rollback()
-	const query = `SELECT
+	query := `SELECT
 		id, message_raw, thread_id as threadid,
 		(SELECT id FROM DBPREFIXposts WHERE is_top_post = TRUE AND thread_id = threadid LIMIT 1) AS op,
 		(SELECT board_id FROM DBPREFIXthreads WHERE id = threadid) AS boardid,
 		(SELECT dir FROM DBPREFIXboards WHERE id = boardid) AS dir
 		FROM DBPREFIXposts WHERE is_deleted = FALSE`
+	var params []any
+	if board != nil {
+		query += ` AND thread_id IN (SELECT id FROM DBPREFIXthreads WHERE board_id = ?)`
+		params = append(params, board.ID)
+	}
 	const updateQuery = `UPDATE DBPREFIXposts SET message = ? WHERE id = ?`
 
 	stmt, err := gcsql.PrepareSQL(query, tx)
@@ -630,7 +653,7 @@ func reparseHTMLCallback(_ http.ResponseWriter, _ *http.Request, _ *gcsql.Staff,
 		return "", err
 	}
 	defer stmt.Close()
-	rows, err := stmt.Query()
+	rows, err := stmt.Query(params...)
 	if err != nil {
 		errEv.Err(err).Msg("Unable to query the database")
 		return "", err
@@ -643,7 +666,13 @@ func reparseHTMLCallback(_ http.ResponseWriter, _ *http.Request, _ *gcsql.Staff,
 			errEv.Err(err).Caller().Msg("Unable to scan SQL row")
 			return "", err
 		}
-		formatted := posting.FormatMessage(messageRaw, boardDir)
+		post := &gcsql.Post{ID: postID}
+		commandResults, err := post.GetCommandResults()
+		if err != nil {
+			errEv.Err(err).Caller().Int("postID", postID).Msg("Unable to get post command results")
+			return "", err
+		}
+		formatted := posting.FormatMessage(messageRaw, boardDir, commandResults...)
 		gcsql.ExecSQL(updateQuery, formatted, postID)
 	}
 	outputStr += "Done reparsing HTML<hr />"
@@ -658,7 +687,12 @@ func reparseHTMLCallback(_ http.ResponseWriter, _ *http.Request, _ *gcsql.Staff,
 	}
 	outputStr += "Done building board list JSON<hr />"
 
-	if err = building.BuildBoards(false); err != nil {
+	if board != nil {
+		err = building.BuildBoards(false, board.ID)
+	} else {
+		err = building.BuildBoards(false)
+	}
+	if err != nil {
 		return "", err
 	}
 	outputStr += "Done building boards<hr />"
@@ -683,6 +717,19 @@ func wordfiltersCallback(_ http.ResponseWriter, request *http.Request, staff *gc
 	}
 
 	submitBtn := request.FormValue("dowordfilter")
+	filterAction := request.FormValue("action")
+	if filterAction == "" {
+		filterAction = gcsql.WordfilterReplace
+	}
+	banDuration := request.FormValue("banduration")
+	if submitBtn != "" {
+		if err = gcsql.ValidateWordfilterAction(filterAction, banDuration); err != nil {
+			errEv.Err(err).Caller().
+				Str("action", filterAction).
+				Str("banDuration", banDuration).Send()
+			return err, err
+		}
+	}
 	switch submitBtn {
 	case "Edit wordfilter":
 		regexCheckStr := request.FormValue("isregex")
@@ -696,13 +743,17 @@ func wordfiltersCallback(_ http.ResponseWriter, request *http.Request, staff *gc
 				staff_note = ?,
 				search = ?,
 				is_regex = ?,
-				change_to = ?
+				change_to = ?,
+				action = ?,
+				ban_duration = ?
 				WHERE id = ?`,
 			request.FormValue("boarddirs"),
 			request.FormValue("staffnote"),
 			request.FormValue("find"),
 			regexCheckStr,
 			request.FormValue("replace"),
+			filterAction,
+			banDuration,
 			editIDstr)
 		infoEv.Str("do", "update")
 	case "Create new wordfilter":
@@ -712,7 +763,9 @@ func wordfiltersCallback(_ http.ResponseWriter, request *http.Request, staff *gc
 			request.FormValue("isregex") == "on",
 			request.FormValue("boarddirs"),
 			staff.ID,
-			request.FormValue("staffnote"))
+			request.FormValue("staffnote"),
+			filterAction,
+			banDuration)
 		infoEv.Str("do", "create")
 	case "":
 		infoEv.Discard()
@@ -722,7 +775,9 @@ func wordfiltersCallback(_ http.ResponseWriter, request *http.Request, staff *gc
 			Str("find", request.FormValue("find")).
 			Str("replace", request.FormValue("replace")).
 			Str("staffnote", request.FormValue("staffnote")).
-			Str("boarddirs", request.FormValue("boarddirs"))
+			Str("boarddirs", request.FormValue("boarddirs")).
+			Str("action", filterAction).
+			Str("banDuration", banDuration)
 	} else {
 		return err, err
 	}
@@ -13,6 +13,8 @@ import (
 	"github.com/gochan-org/gochan/pkg/gcsql"
 	"github.com/gochan-org/gochan/pkg/gctemplates"
 	"github.com/gochan-org/gochan/pkg/gcutil"
+	"github.com/gochan-org/gochan/pkg/posting"
+	"github.com/gochan-org/gochan/pkg/posting/uploads"
 	"github.com/gochan-org/gochan/pkg/server/serverutil"
 	"github.com/rs/zerolog"
 )
@@ -70,7 +72,7 @@ func clearMySessionsCallback(writer http.ResponseWriter, request *http.Request,
 	return "Logged out successfully", nil
 }
 
-func recentPostsCallback(_ http.ResponseWriter, request *http.Request, _ *gcsql.Staff, wantsJSON bool, _, errEv *zerolog.Event) (output interface{}, err error) {
+func recentPostsCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.Staff, wantsJSON bool, _, errEv *zerolog.Event) (output interface{}, err error) {
 	limit := 20
 	limitStr := request.FormValue("limit")
 	if limitStr != "" {
@@ -89,7 +91,24 @@ func recentPostsCallback(_ http.ResponseWriter, request *http.Request, _ *gcsql.
 			return "", err
 		}
 	}
-	recentposts, err = building.GetRecentPosts(boardid, limit)
+	boards, boardScoped, err := getModeratedBoards(staff)
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to get staff board assignments")
+		return "", err
+	}
+	var boardIDs []int
+	if boardid > 0 {
+		if err = checkModeratedBoard(staff, boardid); err != nil {
+			errEv.Err(err).Caller().Int("boardid", boardid).Send()
+			return "", err
+		}
+		boardIDs = append(boardIDs, boardid)
+	} else if boardScoped {
+		for _, board := range boards {
+			boardIDs = append(boardIDs, board.ID)
+		}
+	}
+	recentposts, err = building.GetRecentPosts(limit, boardIDs...)
 	if err != nil {
 		errEv.Err(err).Caller().Send()
 		return "", err
@@ -100,7 +119,7 @@ func recentPostsCallback(_ http.ResponseWriter, request *http.Request, _ *gcsql.
 	manageRecentsBuffer := bytes.NewBufferString("")
 	if err = serverutil.MinifyTemplate(gctemplates.ManageRecentPosts, map[string]interface{}{
 		"recentposts": recentposts,
-		"allBoards":   gcsql.AllBoards,
+		"allBoards":   boards,
 		"boardid":     boardid,
 		"limit":       limit,
 	}, manageRecentsBuffer, "text/html"); err != nil {
@@ -192,6 +211,37 @@ func staffCallback(writer http.ResponseWriter, request *http.Request, staff *gcs
 				Msg("Error updating password")
 			return "", err
 		}
+	} else if do == "setboards" && updateUsername != "" {
+		if staff.Rank < 3 {
+			writer.WriteHeader(http.StatusUnauthorized)
+			errEv.Err(ErrInsufficientPermission).Caller().
+				Int("rank", staff.Rank).Send()
+			return "", ErrInsufficientPermission
+		}
+		updateStaff, err := gcsql.GetStaffByUsername(updateUsername, true)
+		if err != nil {
+			errEv.Err(err).Caller().
+				Str("updateStaff", updateUsername).
+				Msg("Unable to get staff account")
+			return "", err
+		}
+		var boardIDs []int
+		for _, boardIDStr := range request.PostForm["boards"] {
+			boardID, err := strconv.Atoi(boardIDStr)
+			if err != nil {
+				errEv.Err(err).Caller().
+					Str("boardID", boardIDStr).Send()
+				return "", err
+			}
+			boardIDs = append(boardIDs, boardID)
+		}
+		if err = updateStaff.SetBoards(boardIDs...); err != nil {
+			errEv.Err(err).Caller().
+				Str("updateStaff", updateUsername).
+				Ints("boardIDs", boardIDs).
+				Msg("Error setting staff board assignments")
+			return "", err
+		}
 	}
 	if do == "add" || do == "del" {
 		allStaff, err = getAllStaffNopass(true)
@@ -202,11 +252,43 @@ func staffCallback(writer http.ResponseWriter, request *http.Request, staff *gcs
 		}
 	}
 
+	assignments, err := gcsql.GetBoardStaff()
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Error getting staff board assignments")
+		return "", err
+	}
+	// staff ID -> assigned board directories, and board IDs assigned to the staff member being updated
+	staffBoards := map[int][]string{}
+	updateBoards := map[int]bool{}
+	for _, assignment := range assignments {
+		for _, board := range gcsql.AllBoards {
+			if board.ID == int(assignment.BoardID) {
+				staffBoards[int(assignment.StaffID)] = append(staffBoards[int(assignment.StaffID)], board.Dir)
+				break
+			}
+		}
+		for _, s := range allStaff {
+			if s.ID == int(assignment.StaffID) && s.Username == updateUsername {
+				updateBoards[int(assignment.BoardID)] = true
+			}
+		}
+	}
+	var updateRank int
+	for _, s := range allStaff {
+		if s.Username == updateUsername {
+			updateRank = s.Rank
+		}
+	}
+
 	staffBuffer := bytes.NewBufferString("")
 	if err = serverutil.MinifyTemplate(gctemplates.ManageStaff, map[string]interface{}{
 		"do":             do,
 		"updateUsername": updateUsername,
+		"updateRank":     updateRank,
+		"updateBoards":   updateBoards,
 		"allstaff":       allStaff,
+		"staffBoards":    staffBoards,
+		"allBoards":      gcsql.AllBoards,
 		"currentStaff":   staff,
 	}, staffBuffer, "text/html"); err != nil {
 		errEv.Err(err).Str("template", "manage_staff.html").Send()
@@ -216,6 +298,135 @@ func staffCallback(writer http.ResponseWriter, request *http.Request, staff *gcs
 	return outputStr, nil
 }
 
+func pendingPostsCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.Staff, wantsJSON bool, infoEv, errEv *zerolog.Event) (output interface{}, err error) {
+	boards, boardScoped, err := getModeratedBoards(staff)
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to get staff board assignments")
+		return "", err
+	}
+	pending, err := gcsql.GetPendingPosts(0)
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to get pending posts")
+		return "", err
+	}
+	if boardScoped {
+		var scoped []gcsql.PendingPost
+		for _, pp := range pending {
+			if boardInList(pp.BoardID, boards) {
+				scoped = append(scoped, pp)
+			}
+		}
+		pending = scoped
+	}
+
+	approveIDStr := request.FormValue("approve")
+	rejectIDStr := request.FormValue("reject")
+	if approveIDStr != "" || rejectIDStr != "" {
+		postIDStr := approveIDStr
+		if postIDStr == "" {
+			postIDStr = rejectIDStr
+		}
+		postID, err := strconv.Atoi(postIDStr)
+		if err != nil {
+			errEv.Err(err).Caller().Str("postID", postIDStr).Send()
+			return "", err
+		}
+		gcutil.LogInt("postID", postID, infoEv, errEv)
+		var post *gcsql.PendingPost
+		for p := range pending {
+			if pending[p].ID == postID {
+				post = &pending[p]
+				break
+			}
+		}
+		if post == nil {
+			errEv.Err(gcsql.ErrPostNotPending).Caller().Send()
+			return "", gcsql.ErrPostNotPending
+		}
+		if approveIDStr != "" {
+			if err = post.ApprovePending(); err != nil {
+				errEv.Err(err).Caller().Msg("Unable to approve post")
+				return "", err
+			}
+			if err = posting.AddApprovedR9KHashes(post); err != nil {
+				// the post has already been approved, so it isn't worth failing here
+				errEv.Err(err).Caller().Msg("Unable to store R9K hashes of approved post")
+			}
+			if err = rebuildApprovedPost(&post.Post, post.BoardID); err != nil {
+				errEv.Err(err).Caller().Msg("Unable to rebuild pages after approving post")
+				return "", err
+			}
+			infoEv.Msg("Approved pending post")
+		} else {
+			if err = post.RejectPending(); err != nil {
+				errEv.Err(err).Caller().Msg("Unable to reject post")
+				return "", err
+			}
+			// the post stays deleted, so its uploads aren't needed anymore
+			postUploads, err := post.GetUploads()
+			if err != nil {
+				errEv.Err(err).Caller().Msg("Unable to get rejected post uploads")
+				return "", err
+			}
+			for u := range postUploads {
+				uploads.RemoveUploadFiles(post.BoardDir, &postUploads[u])
+			}
+			infoEv.Msg("Rejected pending post")
+		}
+		for p := range pending {
+			if pending[p].ID == postID {
+				pending = append(pending[:p], pending[p+1:]...)
+				break
+			}
+		}
+	}
+
+	if wantsJSON {
+		return pending, nil
+	}
+	pendingBuffer := bytes.NewBufferString("")
+	if err = serverutil.MinifyTemplate(gctemplates.ManagePendingPosts, map[string]interface{}{
+		"pending": pending,
+	}, pendingBuffer, "text/html"); err != nil {
+		errEv.Err(err).Str("template", "manage_pendingposts.html").Caller().Send()
+		return "", err
+	}
+	return pendingBuffer.String(), nil
+}
+
+// rebuildApprovedPost trims the thread if it is cyclical and rebuilds the board and thread pages that an approved
+// post now shows up on
+func rebuildApprovedPost(post *gcsql.Post, boardID int) error {
+	board, err := gcsql.GetBoardFromID(boardID)
+	if err != nil {
+		return err
+	}
+	if !post.IsTopPost {
+		thread, err := gcsql.GetThread(post.ThreadID)
+		if err != nil {
+			return err
+		}
+		if err = building.TrimCyclicalThread(board, thread); err != nil {
+			return err
+		}
+	}
+	opID, err := post.TopPostID()
+	if err != nil {
+		return err
+	}
+	op, err := gcsql.GetPostFromID(opID, true)
+	if err != nil {
+		return err
+	}
+	if err = building.BuildThreadPages(op); err != nil {
+		return err
+	}
+	if err = building.BuildBoardPages(board); err != nil {
+		return err
+	}
+	return building.BuildFrontPage()
+}
+
 func registerJanitorPages() {
 	actions = append(actions,
 		Action{
@@ -238,6 +449,13 @@ func registerJanitorPages() {
 			JSONoutput:  OptionalJSON,
 			Callback:    recentPostsCallback,
 		},
+		Action{
+			ID:          "pendingposts",
+			Title:       "Posts awaiting approval",
+			Permissions: JanitorPerms,
+			JSONoutput:  OptionalJSON,
+			Callback:    pendingPostsCallback,
+		},
 		Action{
 			ID:          "announcements",
 			Title:       "Announcements",
@@ -27,6 +27,11 @@ func bansCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.Sta
 	var outputStr string
 	var ban gcsql.IPBan
 	ban.StaffID = staff.ID
+	boards, boardScoped, err := getModeratedBoards(staff)
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to get staff board assignments")
+		return "", err
+	}
 	deleteIDStr := request.FormValue("delete")
 	postIDstr := request.FormValue("postid")
 	if deleteIDStr != "" {
@@ -38,6 +43,24 @@ func bansCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.Sta
 				Send()
 			return "", err
 		}
+		if boardScoped {
+			existing, err := gcsql.GetIPBanByID(ban.ID)
+			if err != nil {
+				errEv.Err(err).Caller().
+					Int("deleteBan", ban.ID).Send()
+				return "", err
+			}
+			var banBoardID int
+			if existing.BoardID != nil {
+				banBoardID = *existing.BoardID
+			}
+			if err = checkModeratedBoard(staff, banBoardID); err != nil {
+				errEv.Err(err).Caller().
+					Int("deleteBan", ban.ID).
+					Int("boardID", banBoardID).Send()
+				return "", err
+			}
+		}
 		if err = ban.Deactivate(staff.ID); err != nil {
 			errEv.Err(err).Caller().
 				Int("deleteBan", ban.ID).
@@ -57,6 +80,15 @@ func bansCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.Sta
 		gcutil.LogStr("rangeEnd", ban.RangeEnd, infoEv, errEv)
 		gcutil.LogStr("reason", ban.Message, infoEv, errEv)
 		gcutil.LogBool("appealable", ban.CanAppeal, infoEv, errEv)
+		if boardScoped {
+			// board moderators can't issue global bans or bans on boards they aren't assigned to
+			boardID := gcutil.HackyStringToInt(request.PostFormValue("boardid"))
+			if err = checkModeratedBoard(staff, boardID); err != nil {
+				errEv.Err(err).Caller().
+					Int("boardID", boardID).Send()
+				return "", err
+			}
+		}
 		err := ipBanFromRequest(&ban, request, infoEv, errEv)
 		if err != nil {
 			errEv.Err(err).Caller().
@@ -76,6 +108,13 @@ func bansCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.Sta
 			return "", err
 		}
 		ban.RangeEnd = ban.RangeStart
+	} else if ipStr := request.FormValue("ip"); ipStr != "" {
+		// prefill the ban form with the IP, e.g. from the dashboard's list of rate limited IPs
+		if ban.RangeStart, ban.RangeEnd, err = gcutil.ParseIPRange(ipStr); err != nil {
+			errEv.Err(err).Caller().
+				Str("ip", ipStr).Send()
+			return "", err
+		}
 	}
 
 	filterBoardIDstr := request.FormValue("filterboardid")
@@ -96,17 +135,38 @@ func bansCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.Sta
 			return "", err
 		}
 	}
+	if boardScoped && filterBoardID > 0 {
+		if err = checkModeratedBoard(staff, filterBoardID); err != nil {
+			errEv.Err(err).Caller().
+				Int("filterboardid", filterBoardID).Send()
+			return "", err
+		}
+	}
 	banlist, err := gcsql.GetIPBans(filterBoardID, limit, true)
 	if err != nil {
 		errEv.Err(err).Caller().Msg("Error getting ban list")
 		err = errors.New("Error getting ban list: " + err.Error())
 		return "", err
 	}
+	if boardScoped && filterBoardID == 0 {
+		// only show bans on boards the staff member is assigned to
+		var scopedBans []gcsql.IPBan
+		for _, b := range banlist {
+			if b.BoardID == nil {
+				continue
+			}
+			if boardInList(*b.BoardID, boards) {
+				scopedBans = append(scopedBans, b)
+			}
+		}
+		banlist = scopedBans
+	}
 	manageBansBuffer := bytes.NewBufferString("")
 
 	if err = serverutil.MinifyTemplate(gctemplates.ManageBans, map[string]interface{}{
 		"banlist":       banlist,
-		"allBoards":     gcsql.AllBoards,
+		"allBoards":     boards,
+		"boardScoped":   boardScoped,
 		"ban":           ban,
 		"filterboardid": filterBoardID,
 	}, manageBansBuffer, "text/html"); err != nil {
@@ -381,12 +441,42 @@ func nameBansCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql
 func ipSearchCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.Staff, _ bool, _ *zerolog.Event, errEv *zerolog.Event) (output interface{}, err error) {
 	ipQuery := request.FormValue("ip")
 	limitStr := request.FormValue("limit")
-	data := map[string]interface{}{
-		"ipQuery": ipQuery,
-		"limit":   20,
+	posterIDQuery := request.FormValue("posterid")
+	threadQuery, _ := strconv.Atoi(request.FormValue("thread"))
+	boardQuery, _ := strconv.Atoi(request.FormValue("boardid"))
+	boards, _, err := getModeratedBoards(staff)
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to get staff board assignments")
+		return "", err
 	}
-
-	if ipQuery != "" && limitStr != "" {
+	data := map[string]interface{}{
+		"ipQuery":       ipQuery,
+		"limit":         20,
+		"posterIDQuery": posterIDQuery,
+		"threadQuery":   threadQuery,
+		"boardQuery":    boardQuery,
+		"allBoards":     boards,
+	}
+
+	if posterIDQuery != "" && threadQuery > 0 {
+		// poster IDs are only searched for on one board so that staff can't correlate posters on boards they
+		// don't moderate
+		if err = checkModeratedBoard(staff, boardQuery); err != nil {
+			errEv.Err(err).Caller().
+				Int("boardID", boardQuery).Send()
+			return "", err
+		}
+		data["posts"], err = building.GetBuildablePostsByPosterID(boardQuery, threadQuery, posterIDQuery)
+		if err != nil {
+			errEv.Err(err).Caller().
+				Str("posterID", posterIDQuery).
+				Int("opID", threadQuery).
+				Int("boardID", boardQuery).
+				Send()
+			return "", fmt.Errorf("Error getting list of posts from ID %q in thread %d by staff %s: %s",
+				posterIDQuery, threadQuery, staff.Username, err.Error())
+		}
+	} else if ipQuery != "" && limitStr != "" {
 		var limit int
 		if limit, err = strconv.Atoi(limitStr); err == nil && limit > 0 {
 			data["limit"] = limit
@@ -419,6 +509,11 @@ func ipSearchCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql
 }
 
 func reportsCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.Staff, wantsJSON bool, infoEv *zerolog.Event, errEv *zerolog.Event) (output interface{}, err error) {
+	boards, boardScoped, err := getModeratedBoards(staff)
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to get staff board assignments")
+		return nil, err
+	}
 	dismissIDstr := request.FormValue("dismiss")
 	if dismissIDstr != "" {
 		// staff is dismissing a report
@@ -431,6 +526,20 @@ func reportsCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.
 				Caller().Send()
 			return "", errors.New("only the administrator can block reports")
 		}
+		if boardScoped {
+			boardID, err := gcsql.GetReportBoardID(dismissID)
+			if err != nil {
+				errEv.Err(err).Caller().
+					Int("reportID", dismissID).Send()
+				return nil, err
+			}
+			if err = checkModeratedBoard(staff, boardID); err != nil {
+				errEv.Err(err).Caller().
+					Int("reportID", dismissID).
+					Int("boardID", boardID).Send()
+				return nil, err
+			}
+		}
 		found, err := gcsql.ClearReport(dismissID, staff.ID, block != "" && staff.Rank == 3)
 		if err != nil {
 			errEv.Err(err).Caller().
@@ -448,7 +557,12 @@ func reportsCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.
 	rows, err := gcsql.QuerySQL(`SELECT id,
 		handled_by_staff_id as staff_id,
 		(SELECT username FROM DBPREFIXstaff WHERE id = DBPREFIXreports.handled_by_staff_id) as staff_user,
-		post_id, IP_NTOA, reason, is_cleared from DBPREFIXreports WHERE is_cleared = FALSE`)
+		post_id, IP_NTOA, reason, is_cleared, board_id from DBPREFIXreports
+		JOIN (
+			SELECT DBPREFIXposts.id AS reported_post_id, board_id FROM DBPREFIXposts
+			JOIN DBPREFIXthreads ON DBPREFIXthreads.id = thread_id
+		) reported ON reported.reported_post_id = DBPREFIXreports.post_id
+		WHERE is_cleared = FALSE`)
 	if err != nil {
 		return nil, err
 	}
@@ -462,10 +576,14 @@ func reportsCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.
 		var ip string
 		var reason string
 		var is_cleared int
-		err = rows.Scan(&id, &staff_id, &staff_user, &post_id, &ip, &reason, &is_cleared)
+		var boardID int
+		err = rows.Scan(&id, &staff_id, &staff_user, &post_id, &ip, &reason, &is_cleared, &boardID)
 		if err != nil {
 			return nil, err
 		}
+		if boardScoped && !boardInList(boardID, boards) {
+			continue
+		}
 
 		post, err := gcsql.GetPostFromID(post_id, true)
 		if err != nil {
@@ -500,11 +618,16 @@ func reportsCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.
 	return
 }
 
-func threadAttrsCallback(_ http.ResponseWriter, request *http.Request, _ *gcsql.Staff, wantsJSON bool, infoEv, errEv *zerolog.Event) (output interface{}, err error) {
+func threadAttrsCallback(_ http.ResponseWriter, request *http.Request, staff *gcsql.Staff, wantsJSON bool, infoEv, errEv *zerolog.Event) (output interface{}, err error) {
 	boardDir := request.FormValue("board")
 	attrBuffer := bytes.NewBufferString("")
+	boards, _, err := getModeratedBoards(staff)
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to get staff board assignments")
+		return "", err
+	}
 	data := map[string]interface{}{
-		"boards": gcsql.AllBoards,
+		"boards": boards,
 	}
 	if boardDir == "" {
 		if wantsJSON {
@@ -522,6 +645,10 @@ func threadAttrsCallback(_ http.ResponseWriter, request *http.Request, _ *gcsql.
 		errEv.Err(err).Caller().Send()
 		return "", err
 	}
+	if err = checkModeratedBoard(staff, board.ID); err != nil {
+		errEv.Err(err).Caller().Send()
+		return "", err
+	}
 	data["board"] = board
 	topPostStr := request.FormValue("thread")
 	if topPostStr != "" {
@@ -540,6 +667,13 @@ func threadAttrsCallback(_ http.ResponseWriter, request *http.Request, _ *gcsql.
 			errEv.Err(err).Caller().Send()
 			return "", err
 		}
+		if thread.BoardID != board.ID {
+			if err = checkModeratedBoard(staff, thread.BoardID); err != nil {
+				errEv.Err(err).Caller().
+					Int("threadBoardID", thread.BoardID).Send()
+				return "", err
+			}
+		}
 		if request.FormValue("unlock") != "" {
 			attr = "locked"
 			newVal = false
@@ -14,6 +14,7 @@ import (
 	"github.com/gochan-org/gochan/pkg/gcsql"
 	"github.com/gochan-org/gochan/pkg/gctemplates"
 	"github.com/gochan-org/gochan/pkg/gcutil"
+	"github.com/gochan-org/gochan/pkg/server"
 	"github.com/gochan-org/gochan/pkg/server/serverutil"
 	"github.com/rs/zerolog"
 	"golang.org/x/crypto/bcrypt"
@@ -98,15 +99,7 @@ func getCurrentStaff(request *http.Request) (string, error) { //TODO after refac
 // GetStaffFromRequest returns the staff making the request. If the request does not have
 // a staff cookie, it will return a staff object with rank 0.
 func GetStaffFromRequest(request *http.Request) (*gcsql.Staff, error) {
-	sessionCookie, err := request.Cookie("sessiondata")
-	if err != nil {
-		return &gcsql.Staff{Rank: 0}, nil
-	}
-	staff, err := gcsql.GetStaffBySession(sessionCookie.Value)
-	if err != nil {
-		staff = &gcsql.Staff{Rank: 0}
-	}
-	return staff, err
+	return gcsql.GetStaffFromRequest(request)
 }
 
 // GetStaffRank returns the rank number of the staff referenced in the request
@@ -143,6 +136,11 @@ func dashboardCallback(_ http.ResponseWriter, _ *http.Request, staff *gcsql.Staf
 		rankString = "janitor"
 	}
 
+	var rateLimited []server.RateLimitedIP
+	if staff.Rank >= ModPerms {
+		rateLimited = server.GetRateLimitedIPs()
+	}
+
 	availableActions := getAvailableActions(staff.Rank, true)
 	if err = serverutil.MinifyTemplate(gctemplates.ManageDashboard, map[string]interface{}{
 		"actions":       availableActions,
@@ -150,6 +148,7 @@ func dashboardCallback(_ http.ResponseWriter, _ *http.Request, staff *gcsql.Staf
 		"rankString":    rankString,
 		"announcements": announcements,
 		"boards":        gcsql.AllBoards,
+		"rateLimited":   rateLimited,
 	}, dashBuffer, "text/html"); err != nil {
 		errEv.Err(err).Str("template", "manage_dashboard.html").Caller().Send()
 		return "", err
@@ -205,6 +204,51 @@ func getAllStaffNopass(activeOnly bool) ([]gcsql.Staff, error) {
 	return staff, nil
 }
 
+// getModeratedBoards returns the boards that the staff member is allowed to moderate. The returned boolean is true
+// if the staff member has been assigned to specific boards instead of the entire site
+func getModeratedBoards(staff *gcsql.Staff) ([]gcsql.Board, bool, error) {
+	if staff.Rank == 3 {
+		return gcsql.AllBoards, false, nil
+	}
+	boardIDs, err := staff.GetBoardIDs()
+	if err != nil || len(boardIDs) == 0 {
+		return gcsql.AllBoards, false, err
+	}
+	var boards []gcsql.Board
+	for _, board := range gcsql.AllBoards {
+		for _, id := range boardIDs {
+			if board.ID == id {
+				boards = append(boards, board)
+				break
+			}
+		}
+	}
+	return boards, true, nil
+}
+
+// boardInList returns true if the board with the given ID is in the boards array
+func boardInList(boardID int, boards []gcsql.Board) bool {
+	for _, board := range boards {
+		if board.ID == boardID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkModeratedBoard returns ErrInsufficientPermission if the staff member isn't allowed to moderate the board
+// with the given ID
+func checkModeratedBoard(staff *gcsql.Staff, boardID int) error {
+	canModerate, err := staff.CanModerateBoard(boardID)
+	if err != nil {
+		return err
+	}
+	if !canModerate {
+		return ErrInsufficientPermission
+	}
+	return nil
+}
+
 // getBoardDataFromForm parses the relevant form fields into the board and returns any errors for invalid string to int
 // or missing required fields. It should only be used for editing and creating boards
 func getBoardDataFromForm(board *gcsql.Board, request *http.Request) error {
@@ -17,6 +17,18 @@ import (
 )
 
 func showBanpage(ban *gcsql.IPBan, post *gcsql.Post, postBoard *gcsql.Board, writer http.ResponseWriter, _ *http.Request) {
+	if !serveBanPage(ban, post, postBoard, false, writer) {
+		return
+	}
+	gcutil.LogWarning().
+		Str("IP", post.IP).
+		Str("boardDir", postBoard.Dir).
+		Msg("Rejected post from banned IP")
+}
+
+// serveBanPage serves the ban page for the ban, or for an R9K mute if muted is true. It returns false if there was
+// an error building the page
+func serveBanPage(ban *gcsql.IPBan, post *gcsql.Post, postBoard *gcsql.Board, muted bool, writer http.ResponseWriter) bool {
 	banPageBuffer := bytes.NewBufferString("")
 	err := serverutil.MinifyTemplate(gctemplates.BanPage, map[string]interface{}{
 		"systemCritical": config.GetSystemCriticalConfig(),
@@ -27,6 +39,7 @@ func showBanpage(ban *gcsql.IPBan, post *gcsql.Post, postBoard *gcsql.Board, wri
 		"board":          postBoard,
 		"permanent":      ban.Permanent,
 		"expires":        ban.ExpiresAt,
+		"muted":          muted,
 	}, banPageBuffer, "text/html")
 	if err != nil {
 		gcutil.LogError(err).
@@ -34,13 +47,10 @@ func showBanpage(ban *gcsql.IPBan, post *gcsql.Post, postBoard *gcsql.Board, wri
 			Str("building", "minifier").
 			Str("template", "banpage.html").Send()
 		server.ServeErrorPage(writer, "Error minifying page: "+err.Error())
-		return
+		return false
 	}
 	writer.Write(banPageBuffer.Bytes())
-	gcutil.LogWarning().
-		Str("IP", post.IP).
-		Str("boardDir", postBoard.Dir).
-		Msg("Rejected post from banned IP")
+	return true
 }
 
 // checks the post for spam. It returns true if a ban page or an error page was served (causing MakePost() to return)
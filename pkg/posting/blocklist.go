@@ -0,0 +1,312 @@
+package posting
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/gochan-org/gochan/pkg/gcutil"
+)
+
+const (
+	blocklistActionReject  = "reject"
+	blocklistActionCaptcha = "captcha"
+	blocklistActionHold    = "hold"
+	blocklistActionNone    = "none"
+
+	dnsblCachePruneTime = time.Minute
+)
+
+var (
+	blocklistResolver BlocklistResolver
+	localBlocklist    ipBlocklist
+	dnsblCache        = dnsblResultCache{
+		results: make(map[netip.Addr]dnsblResult),
+	}
+
+	// dnsblErrorRange is used by some DNSBLs (Spamhaus, for example) to return errors instead of listings
+	dnsblErrorRange  = netip.MustParsePrefix("127.255.255.0/24")
+	dnsblListedRange = netip.MustParsePrefix("127.0.0.0/8")
+)
+
+// BlocklistResolver looks up the A records returned by DNSBLs. *net.Resolver implements it
+type BlocklistResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// SetBlocklistResolver sets the resolver used for DNSBL lookups instead of the one set by the DNSResolver setting.
+// If it is nil, the configured resolver is used
+func SetBlocklistResolver(resolver BlocklistResolver) {
+	blocklistResolver = resolver
+}
+
+func getBlocklistResolver(address string) BlocklistResolver {
+	if blocklistResolver != nil {
+		return blocklistResolver
+	}
+	if address == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+}
+
+// dnsblQueryName returns the name that is looked up to check if the IP is in the DNSBL zone. IPv4 addresses have
+// their octets reversed and IPv6 addresses have their nibbles reversed
+func dnsblQueryName(ip netip.Addr, zone string) string {
+	var builder strings.Builder
+	if ip.Is4() {
+		octets := ip.As4()
+		for o := len(octets) - 1; o >= 0; o-- {
+			builder.WriteString(strconv.Itoa(int(octets[o])))
+			builder.WriteByte('.')
+		}
+	} else {
+		const hexDigits = "0123456789abcdef"
+		bytes := ip.As16()
+		for b := len(bytes) - 1; b >= 0; b-- {
+			builder.WriteByte(hexDigits[bytes[b]&0xf])
+			builder.WriteByte('.')
+			builder.WriteByte(hexDigits[bytes[b]>>4])
+			builder.WriteByte('.')
+		}
+	}
+	builder.WriteString(strings.TrimSuffix(zone, "."))
+	return builder.String()
+}
+
+// lookupDNSBL returns the first zone that lists the IP, or an empty string if none of them do. If a lookup fails,
+// the rest of the zones are still checked, and the error is returned if none of them list the IP
+func lookupDNSBL(ctx context.Context, resolver BlocklistResolver, ip netip.Addr, zones []string) (string, error) {
+	var lookupErr error
+	for _, zone := range zones {
+		addrs, err := resolver.LookupHost(ctx, dnsblQueryName(ip, zone))
+		if err != nil {
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				continue
+			}
+			lookupErr = fmt.Errorf("unable to look up IP in %s: %w", zone, err)
+			continue
+		}
+		for _, addrStr := range addrs {
+			addr, err := netip.ParseAddr(addrStr)
+			if err == nil && dnsblListedRange.Contains(addr) && !dnsblErrorRange.Contains(addr) {
+				return zone, nil
+			}
+		}
+	}
+	return "", lookupErr
+}
+
+type dnsblResult struct {
+	zone    string
+	expires time.Time
+}
+
+// dnsblResultCache holds the results of recent DNSBL lookups so that every post doesn't need new ones
+type dnsblResultCache struct {
+	mutex     sync.Mutex
+	results   map[netip.Addr]dnsblResult
+	lastPrune time.Time
+}
+
+func (drc *dnsblResultCache) get(ip netip.Addr) (string, bool) {
+	drc.mutex.Lock()
+	defer drc.mutex.Unlock()
+	result, ok := drc.results[ip]
+	if !ok || time.Now().After(result.expires) {
+		return "", false
+	}
+	return result.zone, true
+}
+
+func (drc *dnsblResultCache) set(ip netip.Addr, zone string, expires time.Time) {
+	drc.mutex.Lock()
+	defer drc.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(drc.lastPrune) > dnsblCachePruneTime {
+		drc.lastPrune = now
+		for cachedIP, result := range drc.results {
+			if now.After(result.expires) {
+				delete(drc.results, cachedIP)
+			}
+		}
+	}
+	drc.results[ip] = dnsblResult{zone: zone, expires: expires}
+}
+
+type blocklistEntry struct {
+	prefix netip.Prefix
+	list   string
+}
+
+// ipBlocklist holds the IPs and ranges from the local blocklist files
+type ipBlocklist struct {
+	mutex   sync.RWMutex
+	entries []blocklistEntry
+}
+
+// load replaces the blocklist with the contents of the files. If any of them can't be loaded, the blocklist isn't
+// changed
+func (bl *ipBlocklist) load(paths []string) error {
+	var entries []blocklistEntry
+	for _, listPath := range paths {
+		fi, err := os.Open(listPath)
+		if err != nil {
+			return err
+		}
+		prefixes, err := parseBlocklist(fi)
+		fi.Close()
+		if err != nil {
+			return fmt.Errorf("unable to parse blocklist %s: %w", listPath, err)
+		}
+		for _, prefix := range prefixes {
+			entries = append(entries, blocklistEntry{prefix: prefix, list: listPath})
+		}
+	}
+	bl.mutex.Lock()
+	bl.entries = entries
+	bl.mutex.Unlock()
+	return nil
+}
+
+// contains returns the path of the list that contains the IP, if any
+func (bl *ipBlocklist) contains(ip netip.Addr) (string, bool) {
+	bl.mutex.RLock()
+	defer bl.mutex.RUnlock()
+	for _, entry := range bl.entries {
+		if entry.prefix.Contains(ip) {
+			return entry.list, true
+		}
+	}
+	return "", false
+}
+
+// parseBlocklist reads a list with one IP address or CIDR range at the start of each line. Blank lines and lines
+// starting with # are ignored
+func parseBlocklist(reader io.Reader) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	scanner := bufio.NewScanner(reader)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if strings.ContainsRune(fields[0], '/') {
+			prefix, err := netip.ParsePrefix(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, scanner.Err()
+}
+
+func reloadLocalBlocklists(interval time.Duration) {
+	for range time.Tick(interval) {
+		blocklistCfg := config.GetSiteConfig().Blocklists
+		if err := localBlocklist.load(blocklistCfg.LocalLists); err != nil {
+			gcutil.LogError(err).Caller().
+				Strs("localLists", blocklistCfg.LocalLists).
+				Msg("Unable to reload local blocklists, keeping the previous ones")
+		}
+	}
+}
+
+// InitBlocklists loads the local blocklists set in the configuration and starts reloading them periodically
+func InitBlocklists() {
+	blocklistCfg := config.GetSiteConfig().Blocklists
+	if len(blocklistCfg.LocalLists) == 0 {
+		return
+	}
+	if err := localBlocklist.load(blocklistCfg.LocalLists); err != nil {
+		gcutil.LogFatal().Err(err).
+			Strs("localLists", blocklistCfg.LocalLists).
+			Msg("Unable to load local blocklists")
+	}
+	if blocklistCfg.ReloadMinutes > 0 {
+		go reloadLocalBlocklists(time.Duration(blocklistCfg.ReloadMinutes) * time.Minute)
+	}
+}
+
+// checkBlocklists returns the local list or DNSBL zone that the IP is on, or an empty string if it isn't on any
+func checkBlocklists(ipStr string) (string, error) {
+	blocklistCfg := config.GetSiteConfig().Blocklists
+	if !blocklistCfg.UseBlocklists() {
+		return "", nil
+	}
+	ip, err := netip.ParseAddr(ipStr)
+	if err != nil {
+		return "", err
+	}
+	ip = ip.Unmap()
+	if list, ok := localBlocklist.contains(ip); ok {
+		return list, nil
+	}
+	if len(blocklistCfg.DNSBLZones) == 0 {
+		return "", nil
+	}
+	if zone, ok := dnsblCache.get(ip); ok {
+		return zone, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(blocklistCfg.DNSTimeoutSeconds)*time.Second)
+	defer cancel()
+	zone, err := lookupDNSBL(ctx, getBlocklistResolver(blocklistCfg.DNSResolver), ip, blocklistCfg.DNSBLZones)
+	if err != nil && zone == "" {
+		return "", err
+	}
+	dnsblCache.set(ip, zone, time.Now().Add(time.Duration(blocklistCfg.CacheMinutes)*time.Minute))
+	return zone, nil
+}
+
+// posterBlocklistAction returns the board's BlocklistAction and the blocklist the poster's IP is on, or empty
+// strings if it isn't on one. Logged in staff are never blocked
+func posterBlocklistAction(post *gcsql.Post, boardConfig *config.BoardConfig, request *http.Request) (string, string, error) {
+	if boardConfig.BlocklistAction == blocklistActionNone {
+		return "", "", nil
+	}
+	if staff, _ := gcsql.GetStaffFromRequest(request); staff.Rank > 0 {
+		return "", "", nil
+	}
+	list, err := checkBlocklists(post.IP)
+	if err != nil || list == "" {
+		return "", "", err
+	}
+	action := boardConfig.BlocklistAction
+	switch action {
+	case blocklistActionCaptcha:
+		if captchaCfg := config.GetSiteConfig().Captcha; !captchaCfg.UseCaptcha() {
+			// there's no CAPTCHA to require, so the post can't be allowed through
+			action = blocklistActionReject
+		}
+	case blocklistActionHold:
+	default:
+		action = blocklistActionReject
+	}
+	return action, list, nil
+}
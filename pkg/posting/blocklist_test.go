@@ -0,0 +1,183 @@
+package posting
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// startFakeDNSServer starts a DNS server that answers A queries for the names in records and returns NXDOMAIN for
+// everything else
+func startFakeDNSServer(t *testing.T, records map[string]string) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err = query.Unpack(buf[:n]); err != nil || len(query.Questions) == 0 {
+				continue
+			}
+			question := query.Questions[0]
+			response := dnsmessage.Message{
+				Header: dnsmessage.Header{
+					ID:                 query.ID,
+					Response:           true,
+					Authoritative:      true,
+					RecursionDesired:   query.RecursionDesired,
+					RecursionAvailable: true,
+				},
+				Questions: query.Questions,
+			}
+			answer, ok := records[strings.TrimSuffix(question.Name.String(), ".")]
+			if !ok {
+				response.RCode = dnsmessage.RCodeNameError
+			} else if question.Type == dnsmessage.TypeA {
+				response.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{
+						Name:  question.Name,
+						Type:  dnsmessage.TypeA,
+						Class: dnsmessage.ClassINET,
+						TTL:   60,
+					},
+					Body: &dnsmessage.AResource{A: netip.MustParseAddr(answer).As4()},
+				}}
+			}
+			packed, err := response.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(packed, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestDNSBLQueryName(t *testing.T) {
+	assert.Equal(t, "4.3.2.1.dnsbl.example.com", dnsblQueryName(netip.MustParseAddr("1.2.3.4"), "dnsbl.example.com."))
+	assert.Equal(t,
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.dnsbl.example.com",
+		dnsblQueryName(netip.MustParseAddr("2001:db8::1"), "dnsbl.example.com"))
+}
+
+func TestLookupDNSBL(t *testing.T) {
+	address := startFakeDNSServer(t, map[string]string{
+		"2.0.0.127.listed.test":  "127.0.0.2",
+		"2.0.0.127.errors.test":  "127.255.255.254",
+		"3.0.0.127.errors.test":  "127.255.255.254",
+		"3.0.0.127.listed2.test": "127.0.0.4",
+	})
+	resolver := getBlocklistResolver(address)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	zone, err := lookupDNSBL(ctx, resolver, netip.MustParseAddr("127.0.0.2"), []string{"errors.test", "listed.test"})
+	assert.NoError(t, err)
+	assert.Equal(t, "listed.test", zone)
+
+	zone, err = lookupDNSBL(ctx, resolver, netip.MustParseAddr("127.0.0.3"), []string{"errors.test", "listed.test"})
+	assert.NoError(t, err)
+	assert.Empty(t, zone, "error responses and NXDOMAIN shouldn't be treated as listings")
+
+	zone, err = lookupDNSBL(ctx, resolver, netip.MustParseAddr("127.0.0.3"), []string{"listed.test", "listed2.test"})
+	assert.NoError(t, err)
+	assert.Equal(t, "listed2.test", zone)
+}
+
+func TestParseBlocklist(t *testing.T) {
+	prefixes, err := parseBlocklist(strings.NewReader("# Tor exits\n\n192.168.56.1\n10.0.0.5/8 some comment\n2001:db8::/32\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("192.168.56.1/32"),
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}, prefixes)
+
+	_, err = parseBlocklist(strings.NewReader("192.168.56.1\nnot an ip\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+type stubBlocklistResolver struct {
+	listed  map[string]bool
+	lookups int
+}
+
+func (sbr *stubBlocklistResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	sbr.lookups++
+	if sbr.listed[host] {
+		return []string{"127.0.0.2"}, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestCheckBlocklists(t *testing.T) {
+	config.SetVersion(versionStr)
+	blocklistCfg := &config.GetSiteConfig().Blocklists
+	oldBlocklistCfg := *blocklistCfg
+	resolver := &stubBlocklistResolver{listed: map[string]bool{"2.56.168.192.dnsbl.test": true}}
+	SetBlocklistResolver(resolver)
+	defer func() {
+		*blocklistCfg = oldBlocklistCfg
+		SetBlocklistResolver(nil)
+		localBlocklist.load(nil)
+	}()
+
+	listPath := path.Join(t.TempDir(), "torexits.txt")
+	if !assert.NoError(t, os.WriteFile(listPath, []byte("192.168.56.0/30\n"), 0644)) {
+		return
+	}
+	blocklistCfg.LocalLists = []string{listPath}
+	blocklistCfg.DNSBLZones = []string{"dnsbl.test"}
+	blocklistCfg.DNSTimeoutSeconds = 2
+	blocklistCfg.CacheMinutes = 10
+	if !assert.NoError(t, localBlocklist.load(blocklistCfg.LocalLists)) {
+		return
+	}
+
+	list, err := checkBlocklists("192.168.56.1")
+	assert.NoError(t, err)
+	assert.Equal(t, listPath, list)
+	list, err = checkBlocklists("::ffff:192.168.56.1")
+	assert.NoError(t, err)
+	assert.Equal(t, listPath, list, "IPv4-mapped IPv6 addresses should match IPv4 ranges")
+	assert.Zero(t, resolver.lookups, "IPs on a local list shouldn't be looked up in DNSBLs")
+
+	list, err = checkBlocklists("192.168.56.2")
+	assert.NoError(t, err)
+	assert.Equal(t, listPath, list)
+
+	list, err = checkBlocklists("192.168.56.5")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+	assert.Equal(t, 1, resolver.lookups)
+	list, err = checkBlocklists("192.168.56.5")
+	assert.NoError(t, err)
+	assert.Empty(t, list)
+	assert.Equal(t, 1, resolver.lookups, "DNSBL results should be cached")
+
+	assert.NoError(t, os.WriteFile(listPath, []byte("10.0.0.0/8\n"), 0644))
+	assert.NoError(t, localBlocklist.load(blocklistCfg.LocalLists))
+	list, err = checkBlocklists("192.168.56.2")
+	assert.NoError(t, err)
+	assert.Equal(t, "dnsbl.test", list, "reloaded list should replace the old one")
+}
@@ -1,12 +1,10 @@
 package posting
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
-	"net/url"
-	"strconv"
 	"time"
 
 	"github.com/gochan-org/gochan/pkg/config"
@@ -19,70 +17,127 @@ import (
 
 var (
 	ErrNoCaptchaToken     = errors.New("missing required CAPTCHA")
-	ErrUnsupportedCaptcha = errors.New("unsupported captcha type set in configuration (currently only hcaptcha is supported)")
-	validCaptchaTypes     = []string{"hcaptcha"}
+	ErrUnsupportedCaptcha = errors.New("unsupported captcha type set in configuration")
+
+	captchaProviders      = make(map[string]CaptchaProvider)
+	activeCaptchaProvider CaptchaProvider
 )
 
-type CaptchaResult struct {
-	Hostname  string    `json:"hostname"`
-	Credit    bool      `json:"credit"`
-	Success   bool      `json:"success"`
-	Timestamp time.Time `json:"challenge_ts"`
+// CaptchaProvider verifies the CAPTCHA responses submitted with posts. A provider is used if the ID it was
+// registered with is set as the Type in the site's Captcha configuration
+type CaptchaProvider interface {
+	// Init is called when gochan starts if the provider is configured to be used. It should return an error if
+	// the configuration is invalid for the provider
+	Init(captchaCfg *config.CaptchaConfig) error
+	// WidgetHTML returns the HTML added to the post form for the poster to solve the CAPTCHA
+	WidgetHTML(captchaCfg *config.CaptchaConfig) template.HTML
+	// Verify returns true if the request has a valid response to the CAPTCHA, or ErrNoCaptchaToken if the
+	// response is missing
+	Verify(request *http.Request, captchaCfg *config.CaptchaConfig) (bool, error)
+}
+
+// captchaChallengeServer is implemented by providers that serve their own challenges from /captcha. It returns
+// true if it handled the request
+type captchaChallengeServer interface {
+	ServeChallenge(writer http.ResponseWriter, request *http.Request) bool
+}
+
+// RegisterCaptchaProvider registers a CAPTCHA provider that can be used by setting the ID as the Type in the
+// site's Captcha configuration
+func RegisterCaptchaProvider(id string, provider CaptchaProvider) error {
+	if _, ok := captchaProviders[id]; ok {
+		return fmt.Errorf("a captcha provider has already been registered to the ID %q", id)
+	}
+	captchaProviders[id] = provider
+	return nil
 }
 
+// InitCaptcha sets up the CAPTCHA provider set in the configuration. It should be called after plugins are loaded,
+// so that they can register providers
 func InitCaptcha() {
-	var typeIsValid bool
 	captchaCfg := config.GetSiteConfig().Captcha
+	activeCaptchaProvider = nil
 	if !captchaCfg.UseCaptcha() {
 		return
 	}
-	for _, vType := range validCaptchaTypes {
-		if captchaCfg.Type == vType {
-			typeIsValid = true
-		}
-	}
-	if !typeIsValid {
-		gcutil.LogFatal().
+	provider, ok := captchaProviders[captchaCfg.Type]
+	if !ok {
+		gcutil.LogFatal().Err(ErrUnsupportedCaptcha).
 			Str("captchaType", captchaCfg.Type).
 			Msg("Unsupported captcha type set in configuration")
 	}
+	if err := provider.Init(&captchaCfg); err != nil {
+		gcutil.LogFatal().Err(err).
+			Str("captchaType", captchaCfg.Type).
+			Msg("Unable to initialize captcha provider")
+	}
+	activeCaptchaProvider = provider
 }
 
-// submitCaptchaResponse parses the incoming captcha form values, submits them, and returns the results
-func submitCaptchaResponse(request *http.Request) (bool, error) {
+// getCaptchaProvider returns the configured CAPTCHA provider, or nil if CAPTCHAs aren't used
+func getCaptchaProvider() (CaptchaProvider, error) {
 	captchaCfg := config.GetSiteConfig().Captcha
 	if !captchaCfg.UseCaptcha() {
-		return true, nil // captcha isn't required, skip the test
+		return nil, nil
 	}
-	threadid, _ := strconv.Atoi(request.PostFormValue("threadid"))
-	if captchaCfg.OnlyNeededForThreads && threadid > 0 {
-		return true, nil
+	if activeCaptchaProvider != nil {
+		return activeCaptchaProvider, nil
 	}
-
-	var token string
-	switch captchaCfg.Type {
-	case "hcaptcha":
-		token = request.PostFormValue("h-captcha-response")
-	default:
-
+	provider, ok := captchaProviders[captchaCfg.Type]
+	if !ok {
+		return nil, ErrUnsupportedCaptcha
 	}
+	return provider, nil
+}
 
-	if token == "" {
-		return false, ErrNoCaptchaToken
+// captchaWidget is used by templates to get the HTML for the configured CAPTCHA provider's post form widget
+func captchaWidget() template.HTML {
+	provider, err := getCaptchaProvider()
+	if err != nil || provider == nil {
+		return ""
 	}
-	params := url.Values{
-		"secret":   []string{captchaCfg.AccountSecret},
-		"response": []string{token},
+	captchaCfg := config.GetSiteConfig().Captcha
+	return provider.WidgetHTML(&captchaCfg)
+}
+
+// captchaRequired returns true if the board's CAPTCHA policy requires the IP to solve a CAPTCHA for the post
+func captchaRequired(ip string, newThread bool, postBoard *gcsql.Board, boardConfig *config.BoardConfig) (bool, error) {
+	captchaCfg := config.GetSiteConfig().Captcha
+	policy := boardConfig.CaptchaPolicy
+	switch policy.GetMode(&captchaCfg) {
+	case config.CaptchaPolicyNever:
+		return false, nil
+	case config.CaptchaPolicyThreads:
+		return newThread, nil
+	case config.CaptchaPolicyNewIPs:
+		approved, err := gcsql.CountApprovedIPPosts(ip, postBoard.ID)
+		if err != nil {
+			return false, err
+		}
+		return approved < policy.MinApprovedPosts, nil
+	case config.CaptchaPolicyFlood:
+		since := time.Now().Add(-time.Duration(policy.FloodSeconds) * time.Second)
+		recentPosts, err := gcsql.CountRecentBoardPosts(postBoard.ID, since)
+		if err != nil {
+			return false, err
+		}
+		return recentPosts > policy.FloodPosts, nil
+	default:
+		return true, nil
 	}
-	resp, err := http.PostForm("https://hcaptcha.com/siteverify", params)
+}
+
+// submitCaptchaResponse parses the incoming captcha form values, submits them, and returns the results
+func submitCaptchaResponse(request *http.Request) (bool, error) {
+	provider, err := getCaptchaProvider()
 	if err != nil {
 		return false, err
 	}
-	var vals CaptchaResult
-	if err = json.NewDecoder(resp.Body).Decode(&vals); err != nil {
-		return false, err
+	if provider == nil {
+		return true, nil // captcha isn't required, skip the test
 	}
-	return vals.Success, resp.Body.Close()
+	captchaCfg := config.GetSiteConfig().Captcha
+	return provider.Verify(request, &captchaCfg)
 }
 
 // ServeCaptcha handles requests to /captcha if the captcha is properly configured
@@ -98,10 +153,21 @@ func ServeCaptcha(writer http.ResponseWriter, request *http.Request) {
 		errEv.Discard()
 	}()
 	wantsJSON := serverutil.IsRequestingJSON(request)
-	if !captchaCfg.UseCaptcha() {
+	provider, err := getCaptchaProvider()
+	if err != nil {
+		errEv.Err(err).Caller().Str("captchaType", captchaCfg.Type).Send()
+		server.ServeError(writer, err.Error(), wantsJSON, nil)
+		return
+	}
+	if provider == nil {
 		server.ServeError(writer, "This site is not set up to require a CAPTCHA test", wantsJSON, nil)
 		return
 	}
+	if challengeServer, ok := provider.(captchaChallengeServer); ok && request.Method == "GET" {
+		if challengeServer.ServeChallenge(writer, request) {
+			return
+		}
+	}
 	if request.Method == "POST" {
 		result, err := submitCaptchaResponse(request)
 		if err != nil {
@@ -111,13 +177,47 @@ func ServeCaptcha(writer http.ResponseWriter, request *http.Request) {
 		}
 		fmt.Println("Success:", result)
 	}
-	err := serverutil.MinifyTemplate(gctemplates.Captcha, map[string]interface{}{
+	err = serverutil.MinifyTemplate(gctemplates.Captcha, map[string]interface{}{
 		"boardConfig": config.GetBoardConfig(""),
 		"boards":      gcsql.AllBoards,
-		"siteKey":     captchaCfg.SiteKey,
 	}, writer, "text/html")
 	if err != nil {
 		errEv.Err(err).Caller().Send()
 		server.ServeError(writer, "Error serving CAPTCHA: "+err.Error(), wantsJSON, nil)
 	}
 }
+
+func init() {
+	gctemplates.AddTemplateFuncs(template.FuncMap{
+		"captchaWidget": captchaWidget,
+	})
+	RegisterCaptchaProvider("hcaptcha", newSiteVerifyProvider("h-captcha-response",
+		"https://hcaptcha.com/siteverify",
+		`<div class="h-captcha" data-sitekey="{{.SiteKey}}"></div>`+
+			`<script src="https://js.hcaptcha.com/1/api.js" async defer></script>`,
+		false))
+	RegisterCaptchaProvider("recaptcha", newSiteVerifyProvider("g-recaptcha-response",
+		"https://www.google.com/recaptcha/api/siteverify",
+		`<div class="g-recaptcha" data-sitekey="{{.SiteKey}}"></div>`+
+			`<script src="https://www.google.com/recaptcha/api.js" async defer></script>`,
+		false))
+	// reCAPTCHA v3 has no widget. A token is requested in the background and refreshed before it expires
+	RegisterCaptchaProvider("recaptchav3", newSiteVerifyProvider("g-recaptcha-response",
+		"https://www.google.com/recaptcha/api/siteverify",
+		`<input type="hidden" name="g-recaptcha-response" class="recaptcha-v3-response" />`+
+			`<script src="https://www.google.com/recaptcha/api.js?render={{.SiteKey}}"></script>`+
+			`<script>grecaptcha.ready(function() {`+
+			`var refresh = function() { grecaptcha.execute({{.SiteKey}}, {action: "post"}).then(function(token) {`+
+			`document.querySelectorAll("input.recaptcha-v3-response").forEach(function(el) { el.value = token; });`+
+			`}); };`+
+			`refresh(); setInterval(refresh, 90000);`+
+			`});</script>`,
+		true))
+	RegisterCaptchaProvider("turnstile", newSiteVerifyProvider("cf-turnstile-response",
+		"https://challenges.cloudflare.com/turnstile/v0/siteverify",
+		`<div class="cf-turnstile" data-sitekey="{{.SiteKey}}"></div>`+
+			`<script src="https://challenges.cloudflare.com/turnstile/v0/api.js" async defer></script>`,
+		false))
+	RegisterCaptchaProvider("image", &imageCaptchaProvider{})
+	RegisterCaptchaProvider("pow", &powCaptchaProvider{})
+}
@@ -0,0 +1,180 @@
+package posting
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/stretchr/testify/assert"
+	lua "github.com/yuin/gopher-lua"
+)
+
+func newCaptchaPostRequest(values url.Values) *http.Request {
+	request := httptest.NewRequest("POST", "/post", strings.NewReader(values.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return request
+}
+
+func TestSiteVerifyProviders(t *testing.T) {
+	var gotValues url.Values
+	var result CaptchaResult
+	stub := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		request.ParseForm()
+		gotValues = request.PostForm
+		json.NewEncoder(writer).Encode(result)
+	}))
+	defer stub.Close()
+
+	testCases := []struct {
+		provider      string
+		responseField string
+		result        CaptchaResult
+		minScore      float64
+		expectSuccess bool
+	}{
+		{provider: "hcaptcha", responseField: "h-captcha-response", result: CaptchaResult{Success: true}, expectSuccess: true},
+		{provider: "hcaptcha", responseField: "h-captcha-response", result: CaptchaResult{Success: false}},
+		{provider: "recaptcha", responseField: "g-recaptcha-response", result: CaptchaResult{Success: true}, expectSuccess: true},
+		{provider: "recaptchav3", responseField: "g-recaptcha-response", result: CaptchaResult{Success: true, Score: 0.9}, minScore: 0.5, expectSuccess: true},
+		{provider: "recaptchav3", responseField: "g-recaptcha-response", result: CaptchaResult{Success: true, Score: 0.1}, minScore: 0.5},
+		{provider: "turnstile", responseField: "cf-turnstile-response", result: CaptchaResult{Success: true}, expectSuccess: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.provider, func(t *testing.T) {
+			captchaCfg := &config.CaptchaConfig{
+				Type:          tC.provider,
+				SiteKey:       "sitekey",
+				AccountSecret: "secret",
+				VerifyURL:     stub.URL,
+				MinScore:      tC.minScore,
+			}
+			provider := captchaProviders[tC.provider]
+			if !assert.NotNil(t, provider) || !assert.NoError(t, provider.Init(captchaCfg)) {
+				return
+			}
+			assert.Contains(t, provider.WidgetHTML(captchaCfg), "sitekey")
+
+			_, err := provider.Verify(newCaptchaPostRequest(url.Values{}), captchaCfg)
+			assert.ErrorIs(t, err, ErrNoCaptchaToken)
+
+			result = tC.result
+			success, err := provider.Verify(newCaptchaPostRequest(url.Values{tC.responseField: {"token"}}), captchaCfg)
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expectSuccess, success)
+			assert.Equal(t, "secret", gotValues.Get("secret"))
+			assert.Equal(t, "token", gotValues.Get("response"))
+		})
+	}
+
+	assert.ErrorIs(t, captchaProviders["hcaptcha"].Init(&config.CaptchaConfig{Type: "hcaptcha"}), ErrMissingCaptchaKeys)
+}
+
+func TestRegisterCaptchaProvider(t *testing.T) {
+	assert.Error(t, RegisterCaptchaProvider("hcaptcha", &imageCaptchaProvider{}),
+		"registering a provider with a used ID should fail")
+}
+
+func TestLuaCaptchaProvider(t *testing.T) {
+	l := lua.NewState()
+	defer l.Close()
+	l.PreloadModule("posting", PreloadModule)
+	err := l.DoString(`local posting = require("posting")
+local err = posting.register_captcha_provider("luacaptcha", {
+	widget = function(cfg)
+		return '<input type="text" name="luaanswer" />'
+	end,
+	verify = function(request, cfg)
+		return request:PostFormValue("luaanswer") == cfg.SiteKey, nil
+	end
+})
+assert(err == nil)`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer delete(captchaProviders, "luacaptcha")
+	provider := captchaProviders["luacaptcha"]
+	if !assert.NotNil(t, provider) {
+		return
+	}
+	captchaCfg := &config.CaptchaConfig{Type: "luacaptcha", SiteKey: "answer"}
+	assert.NoError(t, provider.Init(captchaCfg))
+	assert.EqualValues(t, `<input type="text" name="luaanswer" />`, provider.WidgetHTML(captchaCfg))
+	success, err := provider.Verify(newCaptchaPostRequest(url.Values{"luaanswer": {"answer"}}), captchaCfg)
+	assert.NoError(t, err)
+	assert.True(t, success)
+	success, err = provider.Verify(newCaptchaPostRequest(url.Values{"luaanswer": {"wrong"}}), captchaCfg)
+	assert.NoError(t, err)
+	assert.False(t, success)
+
+	assert.Error(t, l.DoString(`require("posting").register_captcha_provider("noverify", {})`),
+		"providers without a verify function should be rejected")
+}
+
+func TestCaptchaRequired(t *testing.T) {
+	config.SetVersion(versionStr)
+	captchaCfg := &config.GetSiteConfig().Captcha
+	oldCaptchaCfg := *captchaCfg
+	defer func() {
+		*captchaCfg = oldCaptchaCfg
+	}()
+	captchaCfg.Type = "image"
+	captchaCfg.OnlyNeededForThreads = false
+
+	config.SetTestDBConfig("mysql", "localhost", "gochan", "gochan", "gochan", "")
+	db, mock, err := sqlmock.New()
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, gcsql.SetTestingDB("mysql", "gochan", "", db)) {
+		return
+	}
+	board := &gcsql.Board{ID: 1, Dir: "test"}
+	boardConfig := &config.BoardConfig{}
+	ip := "192.168.56.1"
+
+	testCases := []struct {
+		mode      string
+		newThread bool
+		count     int
+		expected  bool
+	}{
+		{mode: "", expected: true},
+		{mode: config.CaptchaPolicyNever, newThread: true, expected: false},
+		{mode: config.CaptchaPolicyThreads, newThread: true, expected: true},
+		{mode: config.CaptchaPolicyThreads, expected: false},
+		{mode: config.CaptchaPolicyNewIPs, count: 2, expected: true},
+		{mode: config.CaptchaPolicyNewIPs, count: 3, expected: false},
+		{mode: config.CaptchaPolicyFlood, count: 10, expected: false},
+		{mode: config.CaptchaPolicyFlood, count: 11, expected: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.mode, func(t *testing.T) {
+			boardConfig.CaptchaPolicy = config.CaptchaPolicy{
+				Mode:             tC.mode,
+				MinApprovedPosts: 3,
+				FloodPosts:       10,
+				FloodSeconds:     60,
+			}
+			switch tC.mode {
+			case config.CaptchaPolicyNewIPs:
+				mock.ExpectPrepare(`SELECT COUNT\(\*\) FROM posts p\s+JOIN threads t ON t.id = p.thread_id\s+WHERE p.ip = INET6_ATON\(\?\)`).
+					ExpectQuery().WithArgs(ip, board.ID).
+					WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(tC.count))
+			case config.CaptchaPolicyFlood:
+				mock.ExpectPrepare(`SELECT COUNT\(\*\) FROM posts p\s+JOIN threads t ON t.id = p.thread_id\s+WHERE t.board_id = \? AND p.created_on > \?`).
+					ExpectQuery().WithArgs(board.ID, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)"}).AddRow(tC.count))
+			}
+			required, err := captchaRequired(ip, tC.newThread, board, boardConfig)
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expected, required)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
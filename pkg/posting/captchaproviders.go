@@ -0,0 +1,157 @@
+package posting
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcutil"
+)
+
+var (
+	ErrMissingCaptchaKeys = errors.New("SiteKey and AccountSecret must be set in the captcha configuration")
+
+	captchaHTTPClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+// CaptchaResult is the response from a CAPTCHA service's siteverify endpoint
+type CaptchaResult struct {
+	Hostname   string    `json:"hostname"`
+	Credit     bool      `json:"credit"`
+	Success    bool      `json:"success"`
+	Timestamp  time.Time `json:"challenge_ts"`
+	Score      float64   `json:"score"`
+	Action     string    `json:"action"`
+	ErrorCodes []string  `json:"error-codes"`
+}
+
+// siteVerifyProvider is a CaptchaProvider for services that have the poster's browser submit a token with the post,
+// which is checked by sending it to the service's siteverify endpoint with the account secret. hCaptcha, reCAPTCHA
+// and Turnstile all work this way
+type siteVerifyProvider struct {
+	responseField    string
+	defaultVerifyURL string
+	widgetTmpl       *template.Template
+	// checkScore is true if the service returns a score (reCAPTCHA v3) that should be compared to MinScore
+	checkScore bool
+}
+
+func newSiteVerifyProvider(responseField string, defaultVerifyURL string, widget string, checkScore bool) *siteVerifyProvider {
+	return &siteVerifyProvider{
+		responseField:    responseField,
+		defaultVerifyURL: defaultVerifyURL,
+		widgetTmpl:       template.Must(template.New(responseField).Parse(widget)),
+		checkScore:       checkScore,
+	}
+}
+
+func (svp *siteVerifyProvider) verifyURL(captchaCfg *config.CaptchaConfig) string {
+	if captchaCfg.VerifyURL != "" {
+		return captchaCfg.VerifyURL
+	}
+	return svp.defaultVerifyURL
+}
+
+func (svp *siteVerifyProvider) Init(captchaCfg *config.CaptchaConfig) error {
+	if captchaCfg.SiteKey == "" || captchaCfg.AccountSecret == "" {
+		return ErrMissingCaptchaKeys
+	}
+	_, err := url.ParseRequestURI(svp.verifyURL(captchaCfg))
+	return err
+}
+
+func (svp *siteVerifyProvider) WidgetHTML(captchaCfg *config.CaptchaConfig) template.HTML {
+	var buf bytes.Buffer
+	if err := svp.widgetTmpl.Execute(&buf, captchaCfg); err != nil {
+		gcutil.LogError(err).Caller().Str("captchaType", captchaCfg.Type).Send()
+		return ""
+	}
+	return template.HTML(buf.String()) // skipcq: GSC-G203
+}
+
+func (svp *siteVerifyProvider) Verify(request *http.Request, captchaCfg *config.CaptchaConfig) (bool, error) {
+	token := request.PostFormValue(svp.responseField)
+	if token == "" {
+		return false, ErrNoCaptchaToken
+	}
+	params := url.Values{
+		"secret":   []string{captchaCfg.AccountSecret},
+		"response": []string{token},
+		"remoteip": []string{gcutil.GetRealIP(request)},
+	}
+	resp, err := captchaHTTPClient.PostForm(svp.verifyURL(captchaCfg), params)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("captcha verification returned status %s", resp.Status)
+	}
+	var vals CaptchaResult
+	if err = json.NewDecoder(resp.Body).Decode(&vals); err != nil {
+		return false, err
+	}
+	if svp.checkScore && vals.Score < captchaCfg.MinScore {
+		return false, nil
+	}
+	return vals.Success, nil
+}
+
+// imageCaptchaProvider is the built-in distorted text image CAPTCHA
+type imageCaptchaProvider struct{}
+
+func (*imageCaptchaProvider) Init(captchaCfg *config.CaptchaConfig) error {
+	if captchaCfg.ImageLength < 1 || captchaCfg.ImageWidth < 1 || captchaCfg.ImageHeight < 1 || captchaCfg.ImageExpireMinutes < 1 {
+		return errors.New("ImageLength, ImageWidth, ImageHeight, and ImageExpireMinutes must be greater than 0")
+	}
+	return nil
+}
+
+func (*imageCaptchaProvider) WidgetHTML(_ *config.CaptchaConfig) template.HTML {
+	captchaPath := template.HTMLEscapeString(config.WebPath("/captcha"))
+	return template.HTML(`<img src="` + captchaPath + `?image" alt="CAPTCHA" class="image-captcha" ` + // skipcq: GSC-G203
+		`title="Click for a new CAPTCHA" onclick="this.src=this.src.split('?')[0]+'?image&amp;t='+Date.now()" /><br />` +
+		`<input type="text" name="captchaanswer" autocomplete="off" placeholder="Type the text in the image" />`)
+}
+
+func (*imageCaptchaProvider) Verify(request *http.Request, _ *config.CaptchaConfig) (bool, error) {
+	return checkImageCaptcha(request)
+}
+
+func (*imageCaptchaProvider) ServeChallenge(writer http.ResponseWriter, request *http.Request) bool {
+	if !request.URL.Query().Has("image") {
+		return false
+	}
+	serveImageCaptcha(writer, request)
+	return true
+}
+
+// powCaptchaProvider is the built-in proof-of-work CAPTCHA, solved by the poster's browser
+type powCaptchaProvider struct{}
+
+func (*powCaptchaProvider) Init(_ *config.CaptchaConfig) error {
+	return nil
+}
+
+func (*powCaptchaProvider) WidgetHTML(_ *config.CaptchaConfig) template.HTML {
+	return `<input type="hidden" name="powchallenge" /><input type="hidden" name="powsolution" />` +
+		`Your browser will solve a proof-of-work puzzle when you post (requires JavaScript)`
+}
+
+func (*powCaptchaProvider) Verify(request *http.Request, _ *config.CaptchaConfig) (bool, error) {
+	return checkPowCaptcha(request)
+}
+
+func (*powCaptchaProvider) ServeChallenge(writer http.ResponseWriter, request *http.Request) bool {
+	if !request.URL.Query().Has("pow") {
+		return false
+	}
+	servePowChallenge(writer, request)
+	return true
+}
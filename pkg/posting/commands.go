@@ -0,0 +1,250 @@
+package posting
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"html"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gochan-org/gochan/pkg/gcsql"
+)
+
+const (
+	// maxPostCommands is the maximum number of commands that will be run in a single post. Any commands after
+	// that are left as text
+	maxPostCommands    = 10
+	maxCommandResult   = 255
+	maxDice            = 20
+	maxDieSides        = 10000
+	maxDiceModifierLen = 5
+)
+
+var (
+	postCommands = make(map[string]PostCommandHandler)
+
+	commandNameRE = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+	// postCommandRE matches [command], [command args], and #command in the formatted message
+	postCommandRE = regexp.MustCompile(`\[([A-Za-z0-9_]{1,32})(?: ([^\[\]<>]{1,100}))?\]|(^|\s)#([A-Za-z0-9_]{1,32})\b`)
+	diceRE        = regexp.MustCompile(`^(\d{0,2})[dD](\d{1,5})(?:([+-])(\d{1,` + strconv.Itoa(maxDiceModifierLen) + `}))?$`)
+
+	ErrInvalidCommandArgs = errors.New("invalid post command arguments")
+
+	eightBallAnswers = []string{
+		"It is certain", "It is decidedly so", "Without a doubt", "Yes definitely", "You may rely on it",
+		"As I see it, yes", "Most likely", "Outlook good", "Yes", "Signs point to yes",
+		"Reply hazy, try again", "Ask again later", "Better not tell you now", "Cannot predict now",
+		"Concentrate and ask again",
+		"Don't count on it", "My reply is no", "My sources say no", "Outlook not so good", "Very doubtful",
+	}
+)
+
+// PostCommandHandler computes the result of a post command when a post is made. args is the text after the
+// command's name (for example "2d6+1" in [dice 2d6+1]), and is empty if the command was used without any. If it
+// returns an error, the command is left in the message as text
+type PostCommandHandler func(args string) (string, error)
+
+// RegisterPostCommand registers a command that can be used in post messages as [name], [name args], or #name.
+// The result is computed once when the post is made and stored with it, so it can't be changed by editing the post
+func RegisterPostCommand(name string, handler PostCommandHandler) error {
+	name = strings.ToLower(name)
+	if !commandNameRE.MatchString(name) {
+		return fmt.Errorf("invalid post command name %q", name)
+	}
+	if _, ok := postCommands[name]; ok {
+		return fmt.Errorf("a post command has already been registered with the name %q", name)
+	}
+	postCommands[name] = handler
+	return nil
+}
+
+// UnregisterPostCommand removes the command with the given name, if it has been registered
+func UnregisterPostCommand(name string) {
+	delete(postCommands, strings.ToLower(name))
+}
+
+// postCommandState keeps track of the post commands in a message while it is being formatted
+type postCommandState struct {
+	// if run is true, the commands are run and their results are added to results. Otherwise, results holds the
+	// stored results of the post's commands
+	run     bool
+	results []gcsql.PostCommandResult
+	used    []bool
+	// codeDepth is the number of code and pre elements that are open, since commands in them are left as text.
+	// It is kept between lines since code blocks can span more than one
+	codeDepth int
+}
+
+// commandResult returns the result of the command, either by running it or by finding an unused stored result
+// for the same command and arguments. It returns false if the command shouldn't be rendered
+func (pcs *postCommandState) commandResult(command string, args string) (string, bool) {
+	if !pcs.run {
+		for r, result := range pcs.results {
+			if !pcs.used[r] && result.Command == command && result.Args == args {
+				pcs.used[r] = true
+				return result.Result, true
+			}
+		}
+		return "", false
+	}
+	handler, ok := postCommands[command]
+	if !ok || len(pcs.results) >= maxPostCommands {
+		return "", false
+	}
+	result, err := handler(args)
+	if err != nil {
+		return "", false
+	}
+	for len(result) > maxCommandResult || !utf8.ValidString(result) {
+		result = strings.ToValidUTF8(result, "")
+		if len(result) > maxCommandResult {
+			result = result[:maxCommandResult]
+		}
+	}
+	pcs.results = append(pcs.results, gcsql.PostCommandResult{
+		Order:   len(pcs.results),
+		Command: command,
+		Args:    args,
+		Result:  result,
+	})
+	return result, true
+}
+
+// apply replaces the commands in the line (outside of any HTML tags and code or pre elements) with their results
+func (pcs *postCommandState) apply(line string) string {
+	var builder strings.Builder
+	inTag := false
+	segmentStart := 0
+	for i := 0; i <= len(line); i++ {
+		if i < len(line) && line[i] != '<' && line[i] != '>' {
+			continue
+		}
+		segment := line[segmentStart:i]
+		if inTag {
+			pcs.codeDepth += codeTagDepth(segment)
+			if pcs.codeDepth < 0 {
+				pcs.codeDepth = 0
+			}
+		} else if pcs.codeDepth == 0 {
+			segment = postCommandRE.ReplaceAllStringFunc(segment, pcs.replaceCommand)
+		}
+		builder.WriteString(segment)
+		if i < len(line) {
+			builder.WriteByte(line[i])
+		}
+		inTag = i < len(line) && line[i] == '<'
+		segmentStart = i + 1
+	}
+	return builder.String()
+}
+
+// codeTagDepth returns 1 if the tag (without its angle brackets) opens a code or pre element, -1 if it closes
+// one, or 0 otherwise
+func codeTagDepth(tag string) int {
+	name := strings.TrimPrefix(tag, "/")
+	if end := strings.IndexAny(name, " \t\n/"); end >= 0 {
+		name = name[:end]
+	}
+	name = strings.ToLower(name)
+	if name != "code" && name != "pre" {
+		return 0
+	}
+	if strings.HasPrefix(tag, "/") {
+		return -1
+	}
+	return 1
+}
+
+func (pcs *postCommandState) replaceCommand(match string) string {
+	submatches := postCommandRE.FindStringSubmatch(match)
+	var prefix, command, args string
+	if submatches[1] != "" {
+		command = submatches[1]
+		args = html.UnescapeString(strings.TrimSpace(submatches[2]))
+	} else {
+		prefix = submatches[3]
+		command = submatches[4]
+	}
+	command = strings.ToLower(command)
+	result, ok := pcs.commandResult(command, args)
+	if !ok {
+		return match
+	}
+	return fmt.Sprintf(`%s<span class="post-command post-command-%s">%s</span>`,
+		prefix, command, html.EscapeString(result))
+}
+
+// randomInt returns a cryptographically secure random number in [0,n)
+func randomInt(n int) (int, error) {
+	num, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(num.Int64()), nil
+}
+
+// rollDice handles [dice XdY+Z] commands. If no arguments are given, a single six-sided die is rolled
+func rollDice(args string) (string, error) {
+	if args == "" {
+		args = "1d6"
+	}
+	match := diceRE.FindStringSubmatch(args)
+	if match == nil {
+		return "", ErrInvalidCommandArgs
+	}
+	numDice := 1
+	if match[1] != "" {
+		numDice, _ = strconv.Atoi(match[1])
+	}
+	sides, _ := strconv.Atoi(match[2])
+	if numDice < 1 || numDice > maxDice || sides < 2 || sides > maxDieSides {
+		return "", ErrInvalidCommandArgs
+	}
+	var total int
+	rolls := make([]string, numDice)
+	for r := range rolls {
+		roll, err := randomInt(sides)
+		if err != nil {
+			return "", err
+		}
+		total += roll + 1
+		rolls[r] = strconv.Itoa(roll + 1)
+	}
+	if match[3] != "" {
+		modifier, _ := strconv.Atoi(match[4])
+		if match[3] == "-" {
+			modifier = -modifier
+		}
+		total += modifier
+	}
+	return fmt.Sprintf("Rolled %s: %s = %d", strings.ToLower(args), strings.Join(rolls, ", "), total), nil
+}
+
+func flipCoin(_ string) (string, error) {
+	side, err := randomInt(2)
+	if err != nil {
+		return "", err
+	}
+	if side == 0 {
+		return "Flipped a coin: heads", nil
+	}
+	return "Flipped a coin: tails", nil
+}
+
+func shakeEightBall(_ string) (string, error) {
+	answer, err := randomInt(len(eightBallAnswers))
+	if err != nil {
+		return "", err
+	}
+	return "Magic 8-ball: " + eightBallAnswers[answer], nil
+}
+
+func init() {
+	RegisterPostCommand("dice", rollDice)
+	RegisterPostCommand("flip", flipCoin)
+	RegisterPostCommand("8ball", shakeEightBall)
+}
@@ -16,6 +16,14 @@ import (
 var (
 	msgfmtr *MessageFormatter
 	urlRE   = regexp.MustCompile(`https?://(\S+)`)
+	// postLinkRE matches links to posts (>>123), after the message has been HTML escaped
+	postLinkRE = regexp.MustCompile(`^&gt;&gt;(\d+)$`)
+	// boardLinkRE matches cross-board links to boards (>>>/dir/) and posts (>>>/dir/123)
+	boardLinkRE = regexp.MustCompile(`^&gt;&gt;&gt;/([^\s/]+)/(\d*)$`)
+	// bbCodeBlockRE matches bbcode code blocks and inline code, which shouldn't have URLs turned into links
+	bbCodeBlockRE = regexp.MustCompile(`(?is)\[code\b[^\]]*\].*?\[/code\]|\[icode\].*?\[/icode\]`)
+	// htmlCodeRE matches the HTML of code blocks and inline code created by the formatters
+	htmlCodeRE = regexp.MustCompile(`(?s)<pre[ >].*?</pre>|<code>.*?</code>`)
 )
 
 // InitPosting prepares the formatter and the temp post pruner
@@ -36,7 +44,9 @@ type MessageFormatter struct {
 func (mf *MessageFormatter) Init() {
 	mf.bbCompiler = bbcode.NewCompiler(true, true)
 	mf.bbCompiler.SetTag("center", nil)
-	// mf.bbCompiler.SetTag("code", nil)
+	mf.bbCompiler.SetTag("code", compileBBCodeBlock)
+	mf.bbCompiler.SetTag("icode", compileBBInlineCode)
+	mf.bbCompiler.SetTag("spoiler", compileBBSpoiler)
 	mf.bbCompiler.SetTag("color", nil)
 	mf.bbCompiler.SetTag("img", nil)
 	mf.bbCompiler.SetTag("quote", nil)
@@ -48,7 +58,78 @@ func (mf *MessageFormatter) Init() {
 	)
 }
 
-func (*MessageFormatter) ApplyWordFilters(message string, boardDir string) (string, error) {
+// bbCodeRawText returns the text of the node's children without any bbcode tags being compiled
+func bbCodeRawText(node *bbcode.BBCodeNode) string {
+	var builder strings.Builder
+	for _, child := range node.Children {
+		switch child.ID {
+		case bbcode.TEXT:
+			builder.WriteString(child.Value.(string))
+		case bbcode.CLOSING_TAG:
+			builder.WriteString(child.Value.(bbcode.BBClosingTag).Raw)
+		default:
+			builder.WriteString(child.Value.(bbcode.BBOpeningTag).Raw)
+		}
+		builder.WriteString(bbCodeRawText(child))
+		if child.ID == bbcode.OPENING_TAG && child.ClosingTag != nil {
+			builder.WriteString(child.ClosingTag.Raw)
+		}
+	}
+	return builder.String()
+}
+
+// compileBBCodeBlock compiles [code], [code=lang], and [code lang=lang] blocks, highlighting the code if the
+// language is recognized
+func compileBBCodeBlock(node *bbcode.BBCodeNode) (*bbcode.HTMLTag, bool) {
+	opening := node.GetOpeningTag()
+	lang, ok := opening.Args["lang"]
+	if !ok {
+		lang = opening.Value
+	}
+	out := bbcode.NewHTMLTag("")
+	out.Name = "pre"
+	if lang = getSyntaxLanguage(lang); lang != "" {
+		out.Attrs["class"] = "code lang-" + lang
+	}
+	for _, token := range highlightCode(bbCodeRawText(node), lang) {
+		text := bbcode.NewHTMLTag(token.text)
+		if token.class == "" {
+			out.AppendChild(text)
+			continue
+		}
+		span := bbcode.NewHTMLTag("")
+		span.Name = "span"
+		span.Attrs["class"] = token.class
+		out.AppendChild(span.AppendChild(text))
+	}
+	if len(out.Children) == 0 {
+		out.AppendChild(nil)
+	}
+	return out, false
+}
+
+func compileBBInlineCode(node *bbcode.BBCodeNode) (*bbcode.HTMLTag, bool) {
+	out := bbcode.NewHTMLTag("")
+	out.Name = "code"
+	return out.AppendChild(bbcode.NewHTMLTag(bbCodeRawText(node))), false
+}
+
+func compileBBSpoiler(_ *bbcode.BBCodeNode) (*bbcode.HTMLTag, bool) {
+	out := bbcode.NewHTMLTag("")
+	out.Name = "span"
+	out.Attrs["class"] = "spoiler"
+	return out, true
+}
+
+func (mf *MessageFormatter) ApplyWordFilters(message string, boardDir string) (string, error) {
+	message, _, err := mf.checkWordFilters(message, boardDir)
+	return message, err
+}
+
+// checkWordFilters applies the replacement wordfilters to the message, and returns the filter that decides what
+// happens to the post if any filters with another action match it. Reject and ban filters take priority over
+// hold filters. The hit counts of all of the matching filters are updated
+func (*MessageFormatter) checkWordFilters(message string, boardDir string) (string, *gcsql.Wordfilter, error) {
 	var filters []gcsql.Wordfilter
 	var err error
 	if boardDir == "" {
@@ -57,19 +138,46 @@ func (*MessageFormatter) ApplyWordFilters(message string, boardDir string) (stri
 		filters, err = gcsql.GetBoardWordFilters(boardDir)
 	}
 	if err != nil {
-		return message, err
+		return message, nil, err
 	}
-	for _, wf := range filters {
-		if message, err = wf.Apply(message); err != nil {
-			return message, err
+	var actionFilter *gcsql.Wordfilter
+	for f, wf := range filters {
+		matches, err := wf.Matches(message)
+		if err != nil {
+			return message, nil, err
+		}
+		if !matches {
+			continue
+		}
+		if err = wf.RecordHit(); err != nil {
+			return message, nil, err
+		}
+		switch wf.Action {
+		case gcsql.WordfilterReject, gcsql.WordfilterBan:
+			if actionFilter == nil || actionFilter.Action == gcsql.WordfilterHold {
+				actionFilter = &filters[f]
+			}
+		case gcsql.WordfilterHold:
+			if actionFilter == nil {
+				actionFilter = &filters[f]
+			}
+		default:
+			if message, err = wf.Apply(message); err != nil {
+				return message, nil, err
+			}
 		}
 	}
-	return message, nil
+	return message, actionFilter, nil
 }
 
+// Compile formats the message using the board's MessageFormat, returning the HTML to be processed by FormatMessage
 func (mf *MessageFormatter) Compile(msg string, boardDir string) string {
-	if config.GetBoardConfig(boardDir).DisableBBcode {
-		return msg
+	boardCfg := config.GetBoardConfig(boardDir)
+	switch boardCfg.GetMessageFormat() {
+	case "markdown":
+		return compileMarkdown(msg, boardCfg.RenderURLsAsLinks)
+	case "plain":
+		return compilePlain(msg, boardCfg.RenderURLsAsLinks)
 	}
 	return mf.bbCompiler.Compile(msg)
 }
@@ -78,62 +186,209 @@ func ApplyWordFilters(message string, boardDir string) (string, error) {
 	return msgfmtr.ApplyWordFilters(message, boardDir)
 }
 
+// CheckWordFilters applies the board's wordfilters to the message. If any filters with an action other than
+// replace match it, the filter that decides what happens to the post is returned
+func CheckWordFilters(message string, boardDir string) (string, *gcsql.Wordfilter, error) {
+	return msgfmtr.checkWordFilters(message, boardDir)
+}
+
 func wrapLinksInURL(urlStr string) string {
 	return "[url]" + urlStr + "[/url]"
 }
 
-func FormatMessage(message string, boardDir string) template.HTML {
-	if config.GetBoardConfig(boardDir).RenderURLsAsLinks {
-		message = urlRE.ReplaceAllStringFunc(message, wrapLinksInURL)
+// wrapLinksOutsideCode wraps URLs in [url] tags, skipping any that are in code blocks or inline code
+func wrapLinksOutsideCode(message string) string {
+	var builder strings.Builder
+	last := 0
+	for _, match := range bbCodeBlockRE.FindAllStringIndex(message, -1) {
+		builder.WriteString(urlRE.ReplaceAllStringFunc(message[last:match[0]], wrapLinksInURL))
+		builder.WriteString(message[match[0]:match[1]])
+		last = match[1]
+	}
+	builder.WriteString(urlRE.ReplaceAllStringFunc(message[last:], wrapLinksInURL))
+	return builder.String()
+}
+
+// applySpoilers turns pairs of ** outside of HTML tags in the line into spoilers
+func applySpoilers(line string) string {
+	var markers []int
+	inTag := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '<':
+			inTag = true
+		case line[i] == '>':
+			inTag = false
+		case !inTag && strings.HasPrefix(line[i:], "**"):
+			markers = append(markers, i)
+			i++
+		}
+	}
+	if len(markers) < 2 {
+		return line
+	}
+	var builder strings.Builder
+	last := 0
+	for m, marker := range markers[:len(markers)/2*2] {
+		builder.WriteString(line[last:marker])
+		if m%2 == 0 {
+			builder.WriteString(`<span class="spoiler">`)
+		} else {
+			builder.WriteString(`</span>`)
+		}
+		last = marker + 2
+	}
+	builder.WriteString(line[last:])
+	return builder.String()
+}
+
+// getLinkTargets looks up every post and board referenced by quote links in the message's words, using one
+// query for the posts and one for the boards instead of one query per link
+func getLinkTargets(lines [][]string) (map[int]gcsql.PostLinkTarget, map[string]bool) {
+	var postIDs []int
+	var boardDirs []string
+	seenPosts := make(map[int]bool)
+	seenBoards := make(map[string]bool)
+	for _, words := range lines {
+		for _, word := range words {
+			var postIDStr string
+			if match := postLinkRE.FindStringSubmatch(word); match != nil {
+				postIDStr = match[1]
+			} else if match = boardLinkRE.FindStringSubmatch(word); match != nil {
+				if match[2] == "" {
+					if !seenBoards[match[1]] {
+						seenBoards[match[1]] = true
+						boardDirs = append(boardDirs, match[1])
+					}
+					continue
+				}
+				postIDStr = match[2]
+			} else {
+				continue
+			}
+			if postID, err := strconv.Atoi(postIDStr); err == nil && !seenPosts[postID] {
+				seenPosts[postID] = true
+				postIDs = append(postIDs, postID)
+			}
+		}
+	}
+
+	targets, err := gcsql.GetPostLinkTargets(postIDs...)
+	if err != nil {
+		gcutil.LogError(err).Ints("postIDs", postIDs).Msg("Error getting quote link targets")
+	}
+	existingDirs, err := gcsql.GetExistingBoardDirs(boardDirs...)
+	if err != nil {
+		gcutil.LogError(err).Strs("boardDirs", boardDirs).Msg("Error getting boards for cross-board links")
+	}
+	boards := make(map[string]bool)
+	for _, dir := range existingDirs {
+		boards[dir] = true
+	}
+	return targets, boards
+}
+
+func deadLink(word string) string {
+	return `<a href="javascript:;"><strike>` + word + `</strike></a>`
+}
+
+// FormatMessage formats the message using the board's settings. If the post has any commands, their stored
+// results should be passed so that they are rendered instead of being run again. Commands without a matching
+// stored result are left as text
+func FormatMessage(message string, boardDir string, commandResults ...gcsql.PostCommandResult) template.HTML {
+	return formatMessage(message, boardDir, &postCommandState{
+		results: commandResults,
+		used:    make([]bool, len(commandResults)),
+	})
+}
+
+// FormatNewMessage formats the message of a new post, running any post commands in it. The results should be
+// stored with the post (see gcsql.Post.SetCommandResults) after it is inserted
+func FormatNewMessage(message string, boardDir string) (template.HTML, []gcsql.PostCommandResult) {
+	commands := &postCommandState{run: true}
+	formatted := formatMessage(message, boardDir, commands)
+	return formatted, commands.results
+}
+
+func formatMessage(message string, boardDir string, commands *postCommandState) template.HTML {
+	boardCfg := config.GetBoardConfig(boardDir)
+	if boardCfg.RenderURLsAsLinks && boardCfg.GetMessageFormat() == "bbcode" {
+		// the markdown and plain formatters link URLs themselves
+		message = wrapLinksOutsideCode(message)
 		message = msgfmtr.linkFixer.Replace(message)
 	}
-	message = msgfmtr.Compile(message, boardDir)
+	message = msgfmtr.Compile(strings.ReplaceAll(message, "\x00", ""), boardDir)
+
+	// code is swapped out for placeholders so that it isn't affected by greentext, links, or spoilers
+	var codeReplacements []string
+	message = htmlCodeRE.ReplaceAllStringFunc(message, func(code string) string {
+		placeholder := "\x00" + strconv.Itoa(len(codeReplacements)/2) + "\x00"
+		codeReplacements = append(codeReplacements, placeholder, code)
+		return placeholder
+	})
+
 	// prepare each line to be formatted
 	postLines := strings.Split(message, "<br>")
+	lines := make([][]string, len(postLines))
 	for i, line := range postLines {
-		trimmedLine := strings.TrimSpace(line)
-		lineWords := strings.Split(trimmedLine, " ")
+		lines[i] = strings.Split(strings.TrimSpace(line), " ")
+	}
+	linkTargets, linkBoards := getLinkTargets(lines)
+	WebRoot := config.GetSystemCriticalConfig().WebRoot
+	for i, lineWords := range lines {
 		isGreentext := false // if true, append </span> to end of line
-		WebRoot := config.GetSystemCriticalConfig().WebRoot
 		for w, word := range lineWords {
-			if strings.LastIndex(word, "&gt;&gt;") == 0 {
-				//word is a backlink
-				if postID, err := strconv.Atoi(word[8:]); err == nil {
-					// the link is in fact, a valid int
-					var boardDir string
-					var linkParent int
-					var p gcsql.Post
-					p.GetTopPost()
-					if boardDir, err = gcsql.GetBoardDirFromPostID(postID); err != nil {
-						gcutil.LogError(err).
-							Int("postid", postID).
-							Msg("Error getting board dir for backlink")
-					}
-					if err == gcsql.ErrBoardDoesNotExist {
-						lineWords[w] = `<a href="javascript:;"><strike>` + word + `</strike></a>`
-						continue
-					}
-					linkParent, err := gcsql.GetTopPostInThread(postID)
-					if err != nil {
-						gcutil.LogError(err).
-							Int("postid", postID).
-							Msg("Error getting post parent for backlink")
-						lineWords[w] = `<a href="javascript:;"><strike>` + word + `</strike></a>`
+			var postIDStr string
+			var linkBoard string // if set, the link must point to a post on this board
+			if match := postLinkRE.FindStringSubmatch(word); match != nil {
+				postIDStr = match[1]
+			} else if match = boardLinkRE.FindStringSubmatch(word); match != nil {
+				if match[2] == "" {
+					// word is a link to a board
+					if linkBoards[match[1]] {
+						lineWords[w] = fmt.Sprintf(`<a href="%s%s/" class="boardref">%s</a>`, WebRoot, match[1], word)
 					} else {
-						lineWords[w] = fmt.Sprintf(`<a href="%s%s/res/%d.html#%s" class="postref">%s</a>`, WebRoot, boardDir, linkParent, word[8:], word)
+						lineWords[w] = deadLink(word)
 					}
+					continue
 				}
+				postIDStr = match[2]
+				linkBoard = match[1]
 			} else if strings.Index(word, "&gt;") == 0 && w == 0 {
 				// word is at the beginning of a line, and is greentext
 				isGreentext = true
 				lineWords[w] = `<span class="greentext">` + word
+				continue
+			} else {
+				continue
+			}
+
+			// word is a backlink
+			postID, err := strconv.Atoi(postIDStr)
+			if err != nil {
+				continue
+			}
+			target, ok := linkTargets[postID]
+			if !ok || (linkBoard != "" && target.BoardDir != linkBoard) {
+				lineWords[w] = deadLink(word)
+				continue
 			}
+			lineWords[w] = fmt.Sprintf(`<a href="%s%s/res/%d.html#%d" class="postref">%s</a>`,
+				WebRoot, target.BoardDir, target.OpID, postID, word)
 		}
-		line = strings.Join(lineWords, " ")
+		line := strings.Join(lineWords, " ")
 		if isGreentext {
 			line += "</span>"
 		}
-		postLines[i] = line
+		if boardCfg.GetMessageFormat() == "bbcode" {
+			// the markdown formatter handles spoilers itself
+			line = applySpoilers(line)
+		}
+		postLines[i] = commands.apply(line)
+	}
+	message = strings.Join(postLines, "<br />")
+	if len(codeReplacements) > 0 {
+		message = strings.NewReplacer(codeReplacements...).Replace(message)
 	}
-	return template.HTML(strings.Join(postLines, "<br />")) // skipcq: GSC-G203
+	return template.HTML(message) // skipcq: GSC-G203
 }
@@ -3,7 +3,9 @@ package posting
 import (
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,6 +31,17 @@ gochan.org with bad link: https://gochan.org/a">:)</a>`
 
 	doubleTagPreRender = `[url=https://gochan.org]Gochan[/url] [url]https://gochan.org[/url]`
 	doubleTagExpected  = `<a href="https://gochan.org">Gochan</a> <a href="https://gochan.org">https://gochan.org</a>`
+
+	quoteLinksPreRender = `>>1 >>2 >>1
+>>>/test/1 >>>/other/1
+>>>/test/ >>>/missing/`
+	quoteLinksExpected = `<a href="/test/res/1.html#1" class="postref">&gt;&gt;1</a> ` +
+		`<a href="javascript:;"><strike>&gt;&gt;2</strike></a> ` +
+		`<a href="/test/res/1.html#1" class="postref">&gt;&gt;1</a><br />` +
+		`<a href="/test/res/1.html#1" class="postref">&gt;&gt;&gt;/test/1</a> ` +
+		`<a href="javascript:;"><strike>&gt;&gt;&gt;/other/1</strike></a><br />` +
+		`<a href="/test/" class="boardref">&gt;&gt;&gt;/test/</a> ` +
+		`<a href="javascript:;"><strike>&gt;&gt;&gt;/missing/</strike></a>`
 )
 
 func TestBBCode(t *testing.T) {
@@ -55,3 +68,201 @@ func TestNoDoubleTags(t *testing.T) {
 	rendered := FormatMessage(doubleTagPreRender, "")
 	assert.EqualValues(t, doubleTagExpected, rendered)
 }
+
+func TestQuoteLinks(t *testing.T) {
+	config.SetVersion(versionStr)
+	config.SetTestDBConfig("mysql", "localhost", "gochan", "gochan", "gochan", "")
+	db, mock, err := sqlmock.New()
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, gcsql.SetTestingDB("mysql", "gochan", "", db)) {
+		return
+	}
+	msgfmtr = new(MessageFormatter)
+	msgfmtr.Init()
+
+	// each post and board should only be looked up once, no matter how many times it is linked
+	mock.ExpectPrepare(`SELECT posts.id, .+ WHERE posts.id IN \(\?,\?\) AND posts.is_deleted = FALSE`).
+		ExpectQuery().WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "op_id", "dir"}).AddRow(1, 1, "test"))
+	mock.ExpectPrepare(`SELECT dir FROM boards WHERE dir IN \(\?,\?\)`).
+		ExpectQuery().WithArgs("test", "missing").
+		WillReturnRows(sqlmock.NewRows([]string{"dir"}).AddRow("test"))
+
+	rendered := FormatMessage(quoteLinksPreRender, "")
+	assert.EqualValues(t, quoteLinksExpected, rendered)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkdown(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		msg      string
+		autoLink bool
+		expected string
+	}{
+		{
+			desc:     "emphasis",
+			msg:      "__Bold__ *Italics* ~~Strikethrough~~ **Spoiler** 2 * 3 * 4",
+			expected: `<b>Bold</b> <i>Italics</i> <s>Strikethrough</s> <span class="spoiler">Spoiler</span> 2 * 3 * 4`,
+		},
+		{
+			desc:     "inline code is not formatted",
+			msg:      "`**not bold** <b>`",
+			expected: "<code>**not bold** &lt;b&gt;</code>",
+		},
+		{
+			desc: "code block",
+			msg:  "before\n```go\nfmt.Println(\"<hi>\")\n  *x*\n```\nafter",
+			expected: `before<br><pre class="code lang-go">fmt.Println(<span class="hl-string">&#34;&lt;hi&gt;&#34;</span>)` +
+				"\n  *x*</pre><br>after",
+		},
+		{
+			desc:     "code block with unknown language",
+			msg:      "```brainfuck\n+[-->-[>>+>-----<<]<--<---]>-\n```",
+			expected: "<pre>+[--&gt;-[&gt;&gt;+&gt;-----&lt;&lt;]&lt;--&lt;---]&gt;-</pre>",
+		},
+		{
+			desc:     "unterminated code block",
+			msg:      "```\n*x*",
+			expected: "<pre>*x*</pre>",
+		},
+		{
+			desc:     "links",
+			msg:      "[__gochan__](https://gochan.org) [bad](javascript:alert(1)) https://gochan.org/a?b=1&c=2",
+			autoLink: true,
+			expected: `<a href="https://gochan.org"><b>gochan</b></a> [bad](javascript:alert(1)) ` +
+				`<a href="https://gochan.org/a?b=1&amp;c=2">https://gochan.org/a?b=1&amp;c=2</a>`,
+		},
+		{
+			desc:     "HTML is escaped",
+			msg:      `<script>alert("hi")</script>` + "\r\n" + `<a href="javascript:;">*x*</a>`,
+			expected: `&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt;<br>&lt;a href=&#34;javascript:;&#34;&gt;<i>x</i>&lt;/a&gt;`,
+		},
+		{
+			desc:     "greentext and post links are left for FormatMessage",
+			msg:      ">implying\n>>123",
+			expected: "&gt;implying<br>&gt;&gt;123",
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, compileMarkdown(tC.msg, tC.autoLink))
+		})
+	}
+}
+
+func TestPlain(t *testing.T) {
+	assert.Equal(t, `[b]&lt;b&gt;**x**&lt;/b&gt;[/b]<br><a href="https://gochan.org">https://gochan.org</a>`,
+		compilePlain("[b]<b>**x**</b>[/b]\nhttps://gochan.org", true))
+	assert.Equal(t, "https://gochan.org", compilePlain("https://gochan.org", false))
+}
+
+func TestBBCodeMarkup(t *testing.T) {
+	config.SetVersion(versionStr)
+	var testFmtr MessageFormatter
+	testFmtr.Init()
+	testCases := []struct {
+		desc     string
+		msg      string
+		expected string
+	}{
+		{
+			desc:     "spoiler",
+			msg:      "[spoiler][b]secret[/b][/spoiler]",
+			expected: `<span class="spoiler"><b>secret</b></span>`,
+		},
+		{
+			desc:     "inline code",
+			msg:      "[icode][b]<x>[/b][/icode]",
+			expected: `<code>[b]&lt;x&gt;[/b]</code>`,
+		},
+		{
+			desc: "highlighted code",
+			msg:  "[code lang=go]// hi\nfunc f() string { return \"[b]\" + 1 }[/code]",
+			expected: `<pre class="code lang-go"><span class="hl-comment">// hi</span>` + "\n" +
+				`<span class="hl-keyword">func</span> f() string { <span class="hl-keyword">return</span> ` +
+				`<span class="hl-string">&#34;[b]&#34;</span> + <span class="hl-number">1</span> }</pre>`,
+		},
+		{
+			desc:     "code with language value",
+			msg:      "[code=Lua]--[[ x ]] local y[/code]",
+			expected: `<pre class="code lang-lua"><span class="hl-comment">--[[ x ]]</span> <span class="hl-keyword">local</span> y</pre>`,
+		},
+		{
+			desc:     "code with unknown language",
+			msg:      "[code=<script>]x[/code]",
+			expected: `<pre>x</pre>`,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, testFmtr.Compile(tC.msg, ""))
+		})
+	}
+}
+
+func TestCodeSkipsFormatting(t *testing.T) {
+	config.SetVersion(versionStr)
+	msgfmtr = new(MessageFormatter)
+	msgfmtr.Init()
+	// no queries are expected, since the post links are in code
+	rendered := FormatMessage("[icode]>>123 **x**[/icode] **spoiler** https://gochan.org\n"+
+		"[code]\n>not greentext\nhttps://gochan.org\n[/code]", "")
+	assert.EqualValues(t, `<code>&gt;&gt;123 **x**</code> <span class="spoiler">spoiler</span> `+
+		`<a href="https://gochan.org">https://gochan.org</a><br />`+
+		"<pre>\n&gt;not greentext\nhttps://gochan.org\n</pre>", rendered)
+}
+
+func TestApplySpoilers(t *testing.T) {
+	assert.Equal(t, `<span class="spoiler">a <b>b</b></span> **c`, applySpoilers("**a <b>b</b>** **c"))
+	assert.Equal(t, `<a href="https://x/**a**">x</a>`, applySpoilers(`<a href="https://x/**a**">x</a>`))
+}
+
+func TestPostCommands(t *testing.T) {
+	config.SetVersion(versionStr)
+	msgfmtr = new(MessageFormatter)
+	msgfmtr.Init()
+	formatted, results := FormatNewMessage("[flip] and #flip\n[dice 2d6+1] [dice 1d1] [dice] [notacommand]", "")
+	if !assert.Len(t, results, 4) {
+		return
+	}
+	assert.Equal(t, "flip", results[0].Command)
+	assert.Equal(t, "flip", results[1].Command)
+	assert.Equal(t, "dice", results[2].Command)
+	assert.Equal(t, "2d6+1", results[2].Args)
+	assert.Equal(t, "", results[3].Args)
+	assert.Regexp(t, `^Rolled 2d6\+1: [1-6], [1-6] = \d+$`, results[2].Result)
+	assert.Contains(t, string(formatted), `[dice 1d1]`, "invalid dice arguments should be left as text")
+	assert.Contains(t, string(formatted), `[notacommand]`)
+	assert.Contains(t, string(formatted), ` and <span class="post-command post-command-flip">`)
+
+	// stored results are reused, and commands without a matching stored result are left as text
+	stored := []gcsql.PostCommandResult{
+		{Command: "dice", Args: "2d6+1", Result: "Rolled 2d6+1: 6, 6 = 13"},
+		{Command: "flip", Result: "Flipped a coin: heads"},
+	}
+	formatted = FormatMessage("[dice 2d6+1] [dice 3d6] #flip #flip", "", stored...)
+	assert.EqualValues(t, `<span class="post-command post-command-dice">Rolled 2d6+1: 6, 6 = 13</span> [dice 3d6] `+
+		`<span class="post-command post-command-flip">Flipped a coin: heads</span> #flip`, formatted)
+}
+
+func TestPostCommandsInCode(t *testing.T) {
+	commands := &postCommandState{run: true}
+	assert.Equal(t, `<code>[flip]</code> <pre class="code">#flip`, commands.apply(`<code>[flip]</code> <pre class="code">#flip`))
+	assert.Regexp(t, `^\[dice\]</pre> <span class="post-command post-command-flip">`, commands.apply(`[dice]</pre> #flip`),
+		"commands in a code block spanning more than one line shouldn't be run")
+	assert.Len(t, commands.results, 1)
+}
+
+func TestRollDice(t *testing.T) {
+	for _, args := range []string{"", "d20", "20d10000-99999", "3D6+2"} {
+		_, err := rollDice(args)
+		assert.NoError(t, err, args)
+	}
+	for _, args := range []string{"0d6", "21d6", "2d1", "2d6*2", "abc"} {
+		_, err := rollDice(args)
+		assert.ErrorIs(t, err, ErrInvalidCommandArgs, args)
+	}
+}
@@ -0,0 +1,198 @@
+package posting
+
+import (
+	"html"
+	"strings"
+)
+
+// syntaxDef describes a language well enough to highlight its keywords, comments, strings, and numbers
+type syntaxDef struct {
+	keywords      map[string]bool
+	lineComments  []string
+	blockComments [][2]string
+	// characters that can start and end a string. Backtick strings can span multiple lines
+	stringDelims string
+}
+
+// codeToken is a span of highlighted code. If class is empty, the text is not highlighted
+type codeToken struct {
+	class string
+	text  string
+}
+
+var syntaxDefs = make(map[string]*syntaxDef)
+
+func newSyntaxDef(keywords string, lineComments []string, blockComments [][2]string, stringDelims string, aliases ...string) {
+	def := &syntaxDef{
+		keywords:      make(map[string]bool),
+		lineComments:  lineComments,
+		blockComments: blockComments,
+		stringDelims:  stringDelims,
+	}
+	for _, keyword := range strings.Fields(keywords) {
+		def.keywords[keyword] = true
+	}
+	for _, alias := range aliases {
+		syntaxDefs[alias] = def
+	}
+}
+
+// getSyntaxLanguage returns the normalized name of the language if it can be highlighted, or an empty string
+// if it can't
+func getSyntaxLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if _, ok := syntaxDefs[lang]; !ok {
+		return ""
+	}
+	return lang
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// highlightCode splits the code into tokens using the language's syntax definition. If the language isn't
+// recognized, the code is returned as a single unhighlighted token
+func highlightCode(code string, lang string) []codeToken {
+	def, ok := syntaxDefs[getSyntaxLanguage(lang)]
+	if !ok {
+		return []codeToken{{text: code}}
+	}
+	var tokens []codeToken
+	addToken := func(class string, text string) {
+		if text == "" {
+			return
+		}
+		if last := len(tokens) - 1; last >= 0 && tokens[last].class == class {
+			tokens[last].text += text
+			return
+		}
+		tokens = append(tokens, codeToken{class: class, text: text})
+	}
+
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		end := -1
+		class := ""
+		// block comments are checked first, since they can start with a line comment (--[[ in Lua)
+		for _, delims := range def.blockComments {
+			if strings.HasPrefix(rest, delims[0]) {
+				if end = strings.Index(rest[len(delims[0]):], delims[1]); end < 0 {
+					end = len(rest)
+				} else {
+					end += len(delims[0]) + len(delims[1])
+				}
+				class = "hl-comment"
+				break
+			}
+		}
+		if end < 0 {
+			for _, prefix := range def.lineComments {
+				if strings.HasPrefix(rest, prefix) {
+					if end = strings.IndexByte(rest, '\n'); end < 0 {
+						end = len(rest)
+					}
+					class = "hl-comment"
+					break
+				}
+			}
+		}
+		if end < 0 && strings.IndexByte(def.stringDelims, rest[0]) >= 0 {
+			delim := rest[0]
+			end = 1
+			for end < len(rest) && rest[end] != delim && (delim == '`' || rest[end] != '\n') {
+				if rest[end] == '\\' && delim != '`' {
+					end++
+				}
+				end++
+			}
+			if end < len(rest) && rest[end] == delim {
+				end++
+			} else if end > len(rest) {
+				end = len(rest)
+			}
+			class = "hl-string"
+		}
+		if end < 0 && isIdentChar(rest[0]) {
+			end = 1
+			for end < len(rest) && (isIdentChar(rest[end]) || (isDigit(rest[0]) && rest[end] == '.')) {
+				end++
+			}
+			if isDigit(rest[0]) {
+				class = "hl-number"
+			} else if def.keywords[rest[:end]] {
+				class = "hl-keyword"
+			}
+		}
+		if end < 0 {
+			end = 1
+		}
+		addToken(class, rest[:end])
+		i += end
+	}
+	return tokens
+}
+
+// highlightCodeHTML returns the escaped and highlighted code to be used in a <pre> element
+func highlightCodeHTML(code string, lang string) string {
+	var builder strings.Builder
+	for _, token := range highlightCode(code, lang) {
+		if token.class == "" {
+			builder.WriteString(html.EscapeString(token.text))
+			continue
+		}
+		builder.WriteString(`<span class="` + token.class + `">` + html.EscapeString(token.text) + `</span>`)
+	}
+	return builder.String()
+}
+
+// codeBlockHTML returns the <pre> element for a code block, highlighted if the language is recognized
+func codeBlockHTML(code string, lang string) string {
+	if lang = getSyntaxLanguage(lang); lang == "" {
+		return "<pre>" + html.EscapeString(code) + "</pre>"
+	}
+	return `<pre class="code lang-` + lang + `">` + highlightCodeHTML(code, lang) + "</pre>"
+}
+
+func init() {
+	cStyleComments := [][2]string{{"/*", "*/"}}
+	newSyntaxDef(`break case chan const continue default defer else fallthrough for func go goto if import interface
+		map package range return select struct switch type var true false nil iota`,
+		[]string{"//"}, cStyleComments, "\"'`", "go", "golang")
+	newSyntaxDef(`auto break case char const continue default do double else enum extern float for goto if inline int
+		long register restrict return short signed sizeof static struct switch typedef union unsigned void volatile while
+		bool class delete explicit friend namespace new nullptr operator private protected public template this throw try
+		catch using virtual true false NULL`,
+		[]string{"//"}, cStyleComments, `"'`, "c", "h", "cpp", "c++", "cc", "hpp")
+	newSyntaxDef(`abstract assert boolean break byte case catch char class const continue default do double else enum
+		extends final finally float for goto if implements import instanceof int interface long native new package
+		private protected public return short static super switch synchronized this throw throws try void volatile while
+		var true false null`,
+		[]string{"//"}, cStyleComments, `"'`, "java")
+	newSyntaxDef(`as async await break case catch class const continue debugger default delete do else enum export
+		extends finally for from function if implements import in instanceof interface let new of return static super
+		switch this throw try type typeof var void while yield true false null undefined`,
+		[]string{"//"}, cStyleComments, "\"'`", "javascript", "js", "typescript", "ts")
+	newSyntaxDef(`and as assert async await break class continue def del elif else except finally for from global if
+		import in is lambda nonlocal not or pass raise return try while with yield True False None`,
+		[]string{"#"}, nil, `"'`, "python", "py")
+	newSyntaxDef(`as async await break const continue crate dyn else enum extern fn for if impl in let loop match mod
+		move mut pub ref return self Self static struct super trait type unsafe use where while true false`,
+		[]string{"//"}, cStyleComments, `"`, "rust", "rs")
+	newSyntaxDef(`and break do else elseif end for function goto if in local not or repeat return then until while
+		true false nil`,
+		[]string{"--"}, [][2]string{{"--[[", "]]"}}, `"'`, "lua")
+	newSyntaxDef(`if then else elif fi for while until do done case esac in function return local export select break
+		continue`,
+		[]string{"#"}, nil, `"'`, "sh", "bash", "shell")
+	newSyntaxDef(`SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER INDEX JOIN
+		LEFT RIGHT INNER OUTER ON AS ORDER BY GROUP HAVING LIMIT OFFSET NULL IS IN LIKE PRIMARY KEY FOREIGN REFERENCES
+		DEFAULT DISTINCT UNION ALL select from where and or not insert into values update set delete create table drop
+		alter index join left right inner outer on as order by group having limit offset null is in like primary key
+		foreign references default distinct union all`,
+		[]string{"--"}, cStyleComments, `"'`, "sql")
+}
@@ -0,0 +1,260 @@
+package posting
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	mathrand "math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcutil"
+	"github.com/gochan-org/gochan/pkg/server"
+	"github.com/gochan-org/gochan/pkg/server/serverutil"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	imageCaptchaCookie = "captchaid"
+	// imageCaptchaChars excludes characters that are easily confused with each other (0/O, 1/I/L, etc)
+	imageCaptchaChars = "ABCDEFGHJKMNPRSTUVWXYZ2345678"
+	// maxImageCaptchas is the maximum number of unsolved image CAPTCHAs kept in memory. If it is reached, the
+	// oldest ones are discarded
+	maxImageCaptchas      = 50000
+	imageCaptchaPruneTime = time.Minute
+)
+
+var (
+	imageCaptchas = imageCaptchaStore{
+		challenges: make(map[string]imageCaptchaChallenge),
+	}
+)
+
+type imageCaptchaChallenge struct {
+	answer  string
+	expires time.Time
+}
+
+// imageCaptchaStore holds the answers to image CAPTCHAs that haven't been solved yet
+type imageCaptchaStore struct {
+	mutex      sync.Mutex
+	challenges map[string]imageCaptchaChallenge
+	lastPrune  time.Time
+	// order holds the challenge IDs in the order they were added, so that the oldest can be removed without
+	// scanning every challenge. IDs of challenges that have already been solved are skipped
+	order []string
+}
+
+// add stores a new challenge and returns its ID
+func (ics *imageCaptchaStore) add(answer string, expires time.Time) (string, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(idBytes)
+	ics.mutex.Lock()
+	defer ics.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(ics.lastPrune) > imageCaptchaPruneTime || len(ics.challenges) >= maxImageCaptchas {
+		ics.prune(now)
+	}
+	ics.challenges[id] = imageCaptchaChallenge{answer: answer, expires: expires}
+	ics.order = append(ics.order, id)
+	return id, nil
+}
+
+// prune removes the oldest challenges until it reaches one that hasn't expired, and keeps removing them if there
+// are still too many. The mutex must be locked by the caller
+func (ics *imageCaptchaStore) prune(now time.Time) {
+	ics.lastPrune = now
+	removed := 0
+	for _, id := range ics.order {
+		challenge, ok := ics.challenges[id]
+		if ok && !now.After(challenge.expires) && len(ics.challenges) < maxImageCaptchas {
+			break
+		}
+		delete(ics.challenges, id)
+		removed++
+	}
+	ics.order = ics.order[removed:]
+
+	if len(ics.order) > 2*maxImageCaptchas {
+		// most of the queue is solved challenges that haven't reached the front yet
+		order := make([]string, 0, len(ics.challenges))
+		for _, id := range ics.order {
+			if _, ok := ics.challenges[id]; ok {
+				order = append(order, id)
+			}
+		}
+		ics.order = order
+	}
+}
+
+// solve returns true if the answer is correct and the challenge hasn't expired. Each challenge can only be
+// attempted once, whether or not the answer is correct
+func (ics *imageCaptchaStore) solve(id string, answer string) bool {
+	ics.mutex.Lock()
+	challenge, ok := ics.challenges[id]
+	delete(ics.challenges, id)
+	ics.mutex.Unlock()
+	if !ok || time.Now().After(challenge.expires) {
+		return false
+	}
+	answer = strings.ToUpper(strings.Join(strings.Fields(answer), ""))
+	return subtle.ConstantTimeCompare([]byte(answer), []byte(challenge.answer)) == 1
+}
+
+// newImageCaptchaAnswer returns a random string of the given length to be drawn in a CAPTCHA image
+func newImageCaptchaAnswer(length int) (string, error) {
+	answer := make([]byte, length)
+	for c := range answer {
+		i, err := randomInt(len(imageCaptchaChars))
+		if err != nil {
+			return "", err
+		}
+		answer[c] = imageCaptchaChars[i]
+	}
+	return string(answer), nil
+}
+
+// glyphMask returns the basicfont glyph for the character as an alpha mask
+func glyphMask(c byte) *image.Alpha {
+	face := basicfont.Face7x13
+	mask := image.NewAlpha(image.Rect(0, 0, face.Advance, face.Height))
+	drawer := font.Drawer{
+		Dst:  mask,
+		Src:  image.Opaque,
+		Face: face,
+		Dot:  fixed.P(0, face.Ascent),
+	}
+	drawer.DrawString(string(c))
+	return mask
+}
+
+// renderImageCaptcha draws the text as a distorted image with noise to make it hard to read automatically
+func renderImageCaptcha(text string, width int, height int) *image.RGBA {
+	rng := mathrand.New(mathrand.NewSource(time.Now().UnixNano()))
+	textLayer := image.NewAlpha(image.Rect(0, 0, width, height))
+	cellWidth := float64(width) / float64(len(text)+1)
+	face := basicfont.Face7x13
+	scale := math.Min(cellWidth*1.1/float64(face.Advance), float64(height)*0.7/float64(face.Height))
+
+	for c := 0; c < len(text); c++ {
+		mask := glyphMask(text[c])
+		centerX := cellWidth*(float64(c)+1) + (rng.Float64()-0.5)*cellWidth*0.3
+		centerY := float64(height)/2 + (rng.Float64()-0.5)*float64(height)*0.2
+		glyphScale := scale * (0.85 + rng.Float64()*0.3)
+		angle := (rng.Float64() - 0.5) * 0.8
+		sin, cos := math.Sincos(angle)
+		radius := glyphScale * float64(face.Height)
+		for y := int(centerY - radius); y <= int(centerY+radius); y++ {
+			for x := int(centerX - radius); x <= int(centerX+radius); x++ {
+				// map the pixel back to where it would be in the unrotated, unscaled glyph
+				dx := float64(x) - centerX
+				dy := float64(y) - centerY
+				gx := (dx*cos+dy*sin)/glyphScale + float64(face.Advance)/2
+				gy := (-dx*sin+dy*cos)/glyphScale + float64(face.Height)/2
+				if gx < 0 || gy < 0 {
+					continue
+				}
+				if mask.AlphaAt(int(gx), int(gy)).A > 0 {
+					textLayer.SetAlpha(x, y, color.Alpha{A: 0xff})
+				}
+			}
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	background := color.RGBA{R: uint8(200 + rng.Intn(56)), G: uint8(200 + rng.Intn(56)), B: uint8(200 + rng.Intn(56)), A: 0xff}
+	foreground := color.RGBA{R: uint8(rng.Intn(100)), G: uint8(rng.Intn(100)), B: uint8(rng.Intn(100)), A: 0xff}
+	amplitudeX := float64(height) * (0.02 + rng.Float64()*0.03)
+	amplitudeY := float64(height) * (0.03 + rng.Float64()*0.03)
+	periodX := float64(height) * (0.8 + rng.Float64()*0.6)
+	periodY := float64(width) * (0.3 + rng.Float64()*0.3)
+	phaseX := rng.Float64() * 2 * math.Pi
+	phaseY := rng.Float64() * 2 * math.Pi
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// warp the text with sine waves
+			sx := x + int(amplitudeX*math.Sin(2*math.Pi*float64(y)/periodX+phaseX))
+			sy := y + int(amplitudeY*math.Sin(2*math.Pi*float64(x)/periodY+phaseY))
+			if textLayer.AlphaAt(sx, sy).A > 0 {
+				img.SetRGBA(x, y, foreground)
+			} else {
+				img.SetRGBA(x, y, background)
+			}
+		}
+	}
+
+	// add lines crossing the text and some speckles
+	for l := 0; l < 2+rng.Intn(2); l++ {
+		x0, y0 := rng.Float64()*float64(width)/4, rng.Float64()*float64(height)
+		x1, y1 := float64(width)*(0.75+rng.Float64()/4), rng.Float64()*float64(height)
+		steps := int(math.Hypot(x1-x0, y1-y0))
+		for s := 0; s <= steps; s++ {
+			t := float64(s) / float64(steps)
+			x := int(x0 + (x1-x0)*t)
+			y := int(y0 + (y1-y0)*t)
+			img.SetRGBA(x, y, foreground)
+		}
+	}
+	for d := 0; d < width*height/80; d++ {
+		img.SetRGBA(rng.Intn(width), rng.Intn(height), foreground)
+	}
+	return img
+}
+
+// serveImageCaptcha generates a new image CAPTCHA and sends it as a PNG, with the challenge ID stored in a cookie
+// so that it is submitted with the post
+func serveImageCaptcha(writer http.ResponseWriter, request *http.Request) {
+	captchaCfg := config.GetSiteConfig().Captcha
+	errEv := gcutil.LogError(nil).
+		Str("IP", gcutil.GetRealIP(request))
+	defer errEv.Discard()
+
+	answer, err := newImageCaptchaAnswer(captchaCfg.ImageLength)
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to generate CAPTCHA answer")
+		server.ServeError(writer, "Unable to generate CAPTCHA", serverutil.IsRequestingJSON(request), nil)
+		return
+	}
+	expireDuration := time.Duration(captchaCfg.ImageExpireMinutes) * time.Minute
+	id, err := imageCaptchas.add(answer, time.Now().Add(expireDuration))
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to store CAPTCHA")
+		server.ServeError(writer, "Unable to generate CAPTCHA", serverutil.IsRequestingJSON(request), nil)
+		return
+	}
+	http.SetCookie(writer, &http.Cookie{
+		Name:     imageCaptchaCookie,
+		Value:    id,
+		Path:     config.GetSystemCriticalConfig().WebRoot,
+		MaxAge:   int(expireDuration.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	writer.Header().Set("Content-Type", "image/png")
+	writer.Header().Set("Cache-Control", "no-store")
+	if err = png.Encode(writer, renderImageCaptcha(answer, captchaCfg.ImageWidth, captchaCfg.ImageHeight)); err != nil {
+		errEv.Err(err).Caller().Msg("Unable to encode CAPTCHA image")
+	}
+}
+
+// checkImageCaptcha returns true if the request has the correct answer to the image CAPTCHA in its captchaid cookie
+func checkImageCaptcha(request *http.Request) (bool, error) {
+	answer := request.PostFormValue("captchaanswer")
+	cookie, err := request.Cookie(imageCaptchaCookie)
+	if err != nil || answer == "" {
+		return false, ErrNoCaptchaToken
+	}
+	return imageCaptchas.solve(cookie.Value, answer), nil
+}
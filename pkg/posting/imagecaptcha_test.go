@@ -0,0 +1,119 @@
+package posting
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageCaptchaStore(t *testing.T) {
+	store := imageCaptchaStore{challenges: make(map[string]imageCaptchaChallenge)}
+	id, err := store.add("ABC234", time.Now().Add(time.Minute))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Len(t, id, 32)
+	assert.True(t, store.solve(id, " abc 234"), "answers should ignore case and whitespace")
+	assert.False(t, store.solve(id, "ABC234"), "challenges should only be solvable once")
+
+	id, err = store.add("ABC234", time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.False(t, store.solve(id, "ABC235"))
+	assert.False(t, store.solve(id, "ABC234"), "a failed attempt should use up the challenge")
+
+	id, err = store.add("ABC234", time.Now().Add(-time.Second))
+	assert.NoError(t, err)
+	assert.False(t, store.solve(id, "ABC234"), "expired challenges should be rejected")
+	assert.False(t, store.solve("nonexistent", ""))
+
+	store.add("EXPIRED", time.Now().Add(-time.Second))
+	store.prune(time.Now())
+	assert.Empty(t, store.challenges)
+}
+
+func TestImageCaptchaStoreLimit(t *testing.T) {
+	store := imageCaptchaStore{challenges: make(map[string]imageCaptchaChallenge)}
+	expires := time.Now().Add(time.Hour)
+	firstID, err := store.add("FIRST", expires)
+	if !assert.NoError(t, err) {
+		return
+	}
+	solvedID, _ := store.add("SOLVED", expires)
+	assert.True(t, store.solve(solvedID, "SOLVED"))
+	for i := 0; i < maxImageCaptchas; i++ {
+		if _, err = store.add("ABC234", expires); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Len(t, store.challenges, maxImageCaptchas)
+	assert.NotContains(t, store.challenges, firstID, "the oldest challenge should be removed first")
+	assert.Len(t, store.order, maxImageCaptchas)
+}
+
+func TestNewImageCaptchaAnswer(t *testing.T) {
+	answer, err := newImageCaptchaAnswer(6)
+	assert.NoError(t, err)
+	assert.Len(t, answer, 6)
+	for _, c := range answer {
+		assert.True(t, strings.ContainsRune(imageCaptchaChars, c))
+	}
+}
+
+func TestRenderImageCaptcha(t *testing.T) {
+	img := renderImageCaptcha("ABC234", 240, 80)
+	assert.Equal(t, 240, img.Bounds().Dx())
+	assert.Equal(t, 80, img.Bounds().Dy())
+	background := img.RGBAAt(0, 0)
+	var textPixels int
+	for y := 0; y < 80; y++ {
+		for x := 0; x < 240; x++ {
+			if img.RGBAAt(x, y) != background {
+				textPixels++
+			}
+		}
+	}
+	assert.Greater(t, textPixels, 240*80/50, "the image should have more than just the background")
+}
+
+func TestServeImageCaptcha(t *testing.T) {
+	config.SetVersion("3.10.1")
+	siteCfg := config.GetSiteConfig()
+	oldCaptchaCfg := siteCfg.Captcha
+	siteCfg.Captcha.Type = "image"
+	defer func() {
+		siteCfg.Captcha = oldCaptchaCfg
+	}()
+	captchaCfg := siteCfg.Captcha
+
+	writer := httptest.NewRecorder()
+	serveImageCaptcha(writer, httptest.NewRequest("GET", "/captcha?image", nil))
+	assert.Equal(t, "image/png", writer.Header().Get("Content-Type"))
+	img, err := png.Decode(bytes.NewReader(writer.Body.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, captchaCfg.ImageWidth, img.Bounds().Dx())
+	cookies := writer.Result().Cookies()
+	if !assert.Len(t, cookies, 1) {
+		return
+	}
+	assert.Equal(t, imageCaptchaCookie, cookies[0].Name)
+
+	imageCaptchas.mutex.Lock()
+	answer := imageCaptchas.challenges[cookies[0].Value].answer
+	imageCaptchas.mutex.Unlock()
+	request := httptest.NewRequest("POST", "/post", strings.NewReader(url.Values{"captchaanswer": {answer}}.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.AddCookie(&http.Cookie{Name: imageCaptchaCookie, Value: cookies[0].Value})
+	solved, err := submitCaptchaResponse(request)
+	assert.NoError(t, err)
+	assert.True(t, solved)
+}
@@ -0,0 +1,111 @@
+package posting
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	// mdInlineRE matches inline code spans and links, which have their contents handled separately from the
+	// rest of the line
+	mdInlineRE = regexp.MustCompile("`([^`]+)`|\\[([^\\]]+)\\]\\((https?://[^\\s)]+)\\)")
+	// **text** is used for spoilers instead of bold, like other imageboards' markup
+	mdSpoilerRE = regexp.MustCompile(`\*\*([^\s*](?:[^*]*[^\s*])?)\*\*`)
+	mdBoldRE    = regexp.MustCompile(`__([^\s_](?:[^_]*[^\s_])?)__`)
+	mdItalicRE  = regexp.MustCompile(`\*([^\s*](?:[^*]*[^\s*])?)\*`)
+	mdStrikeRE  = regexp.MustCompile(`~~([^\s~](?:[^~]*[^\s~])?)~~`)
+)
+
+// splitMessageLines normalizes the message's line endings and splits it into lines
+func splitMessageLines(msg string) []string {
+	return strings.Split(strings.ReplaceAll(msg, "\r\n", "\n"), "\n")
+}
+
+// linkURLs formats the text, turning any http(s) URLs into links if autoLink is true. The format function
+// is given the text between URLs and must return it HTML escaped
+func linkURLs(text string, autoLink bool, format func(string) string) string {
+	if !autoLink {
+		return format(text)
+	}
+	var builder strings.Builder
+	last := 0
+	for _, match := range urlRE.FindAllStringIndex(text, -1) {
+		linkURL := html.EscapeString(text[match[0]:match[1]])
+		builder.WriteString(format(text[last:match[0]]))
+		builder.WriteString(`<a href="` + linkURL + `">` + linkURL + `</a>`)
+		last = match[1]
+	}
+	builder.WriteString(format(text[last:]))
+	return builder.String()
+}
+
+// compilePlain escapes the message without applying any markup
+func compilePlain(msg string, autoLink bool) string {
+	lines := splitMessageLines(msg)
+	for l, line := range lines {
+		lines[l] = linkURLs(line, autoLink, html.EscapeString)
+	}
+	return strings.Join(lines, "<br>")
+}
+
+// markdownEmphasis escapes the text and applies spoiler, bold, italic, and strikethrough formatting
+func markdownEmphasis(text string) string {
+	text = html.EscapeString(text)
+	text = mdSpoilerRE.ReplaceAllString(text, `<span class="spoiler">$1</span>`)
+	text = mdBoldRE.ReplaceAllString(text, "<b>$1</b>")
+	text = mdItalicRE.ReplaceAllString(text, "<i>$1</i>")
+	return mdStrikeRE.ReplaceAllString(text, "<s>$1</s>")
+}
+
+func markdownLine(line string, autoLink bool) string {
+	var builder strings.Builder
+	last := 0
+	for _, match := range mdInlineRE.FindAllStringSubmatchIndex(line, -1) {
+		builder.WriteString(linkURLs(line[last:match[0]], autoLink, markdownEmphasis))
+		if match[2] >= 0 {
+			// inline code
+			builder.WriteString("<code>" + html.EscapeString(line[match[2]:match[3]]) + "</code>")
+		} else {
+			// [text](url)
+			builder.WriteString(`<a href="` + html.EscapeString(line[match[6]:match[7]]) + `">` +
+				markdownEmphasis(line[match[4]:match[5]]) + `</a>`)
+		}
+		last = match[1]
+	}
+	builder.WriteString(linkURLs(line[last:], autoLink, markdownEmphasis))
+	return builder.String()
+}
+
+// compileMarkdown renders a limited subset of Markdown (spoilers, bold, italics, strikethrough, inline code, fenced
+// code blocks, and links). The message is escaped before any formatting is applied, so raw HTML is never passed
+// through, and only http(s) links are allowed. Lines starting with > are left alone so that greentext and post links
+// work the same way they do with bbcode
+func compileMarkdown(msg string, autoLink bool) string {
+	var lines []string
+	var codeLines []string
+	var codeLang string
+	inCodeBlock := false
+	for _, line := range splitMessageLines(msg) {
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") {
+			if inCodeBlock {
+				lines = append(lines, codeBlockHTML(strings.Join(codeLines, "\n"), codeLang))
+				codeLines = nil
+			} else {
+				codeLang = trimmed[3:]
+			}
+			inCodeBlock = !inCodeBlock
+			continue
+		}
+		if inCodeBlock {
+			codeLines = append(codeLines, line)
+			continue
+		}
+		lines = append(lines, markdownLine(line, autoLink))
+	}
+	if inCodeBlock {
+		// unterminated code block, treat the rest of the message as code
+		lines = append(lines, codeBlockHTML(strings.Join(codeLines, "\n"), codeLang))
+	}
+	return strings.Join(lines, "<br>")
+}
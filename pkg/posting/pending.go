@@ -0,0 +1,67 @@
+package posting
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/gochan-org/gochan/pkg/gctemplates"
+	"github.com/gochan-org/gochan/pkg/server"
+	"github.com/gochan-org/gochan/pkg/server/serverutil"
+)
+
+const pendingNotice = "Your post has been received and is awaiting approval by a moderator"
+
+// linkRE matches anything in a message that would be (or looks like it is meant to be) a link
+var linkRE = regexp.MustCompile(`(?i)\b(?:[a-z][a-z0-9+.-]*://|www\.|mailto:)|\[url[=\]]`)
+
+// premoderationReason returns the reason the post should be held for approval according to the board's
+// premoderation settings, or an empty string if it shouldn't be held
+func premoderationReason(post *gcsql.Post, postBoard *gcsql.Board, postCfg *config.PostConfig, request *http.Request) (string, error) {
+	if !postCfg.PremoderateNewThreads && !postCfg.PremoderateNewIPs && !postCfg.PremoderateLinks {
+		return "", nil
+	}
+	if staff, _ := gcsql.GetStaffFromRequest(request); staff.Rank > 0 {
+		return "", nil
+	}
+	if postCfg.PremoderateNewThreads && post.ThreadID == 0 {
+		return "new thread", nil
+	}
+	if postCfg.PremoderateLinks && linkRE.MatchString(post.MessageRaw) {
+		return "post contains a link", nil
+	}
+	if postCfg.PremoderateNewIPs {
+		hasPosts, err := gcsql.IPHasApprovedPosts(post.IP, postBoard.ID)
+		if err != nil {
+			return "", err
+		}
+		if !hasPosts {
+			return "first post from IP", nil
+		}
+	}
+	return "", nil
+}
+
+// servePendingNotice tells the poster that their post is being held for approval instead of redirecting them
+// to it
+func servePendingNotice(writer http.ResponseWriter, post *gcsql.Post, postBoard *gcsql.Board, wantsJSON bool) {
+	if wantsJSON {
+		server.ServeJSON(writer, map[string]any{
+			"time":    post.CreatedOn,
+			"id":      post.ID,
+			"pending": true,
+			"message": pendingNotice,
+		})
+		return
+	}
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	serverutil.MinifyTemplate(gctemplates.ErrorPage, map[string]any{
+		"systemCritical": config.GetSystemCriticalConfig(),
+		"siteConfig":     config.GetSiteConfig(),
+		"boardConfig":    config.GetBoardConfig(postBoard.Dir),
+		"errorTitle":     "Post awaiting approval",
+		"errorHeader":    "Post awaiting approval",
+		"errorText":      pendingNotice,
+	}, writer, "text/html")
+}
@@ -0,0 +1,45 @@
+package posting
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinkRE(t *testing.T) {
+	assert.True(t, linkRE.MatchString("check out https://example.com"))
+	assert.True(t, linkRE.MatchString("www.example.com"))
+	assert.True(t, linkRE.MatchString("[url=http://example.com]a link[/url]"))
+	assert.True(t, linkRE.MatchString("[url]example.com[/url]"))
+	assert.True(t, linkRE.MatchString("FTP://example.com"))
+	assert.False(t, linkRE.MatchString("no links here, just a sentence.end"))
+	assert.False(t, linkRE.MatchString(">>123"))
+}
+
+func TestPremoderationReason(t *testing.T) {
+	request := httptest.NewRequest("POST", "/post", nil)
+	board := &gcsql.Board{ID: 1, Dir: "test"}
+	op := &gcsql.Post{IP: "192.168.56.1", MessageRaw: "a new thread"}
+	reply := &gcsql.Post{ThreadID: 1, IP: "192.168.56.1", MessageRaw: "see http://example.com"}
+
+	var postCfg config.PostConfig
+	reason, err := premoderationReason(op, board, &postCfg, request)
+	assert.NoError(t, err)
+	assert.Empty(t, reason, "posts shouldn't be held if premoderation is disabled")
+
+	postCfg.PremoderateNewThreads = true
+	reason, err = premoderationReason(op, board, &postCfg, request)
+	assert.NoError(t, err)
+	assert.Equal(t, "new thread", reason)
+	reason, err = premoderationReason(reply, board, &postCfg, request)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+
+	postCfg.PremoderateLinks = true
+	reason, err = premoderationReason(reply, board, &postCfg, request)
+	assert.NoError(t, err)
+	assert.Equal(t, "post contains a link", reason)
+}
@@ -28,6 +28,12 @@ import (
 const (
 	yearInSeconds = 31536000
 	maxFormBytes  = 50000000
+
+	// error codes included in the JSON response when a post is rejected because of a board setting
+	errCodeBoardLocked     = "board_locked"
+	errCodeMessageTooLong  = "message_too_long"
+	errCodeMessageTooShort = "message_too_short"
+	errCodeFileRequired    = "file_required"
 )
 
 var (
@@ -80,6 +86,17 @@ func attachFlag(request *http.Request, post *gcsql.Post, board string, errEv *ze
 	return nil
 }
 
+// requestUploadCount returns the number of files uploaded with the post request, counting an embed URL as one
+func requestUploadCount(request *http.Request) int {
+	if request.PostFormValue("embed") != "" {
+		return 1
+	}
+	if request.MultipartForm == nil {
+		return 0
+	}
+	return len(request.MultipartForm.File["imagefile"])
+}
+
 func handleRecover(writer http.ResponseWriter, wantsJSON bool, infoEv *zerolog.Event, errEv *zerolog.Event) {
 	if a := recover(); a != nil {
 		if writer != nil {
@@ -169,9 +186,31 @@ func MakePost(writer http.ResponseWriter, request *http.Request) {
 	}
 	boardConfig := config.GetBoardConfig(postBoard.Dir)
 
+	if postBoard.Locked {
+		// only logged in staff can post on locked boards
+		if staff, _ := gcsql.GetStaffFromRequest(request); staff.Rank < 1 {
+			errEv.Caller().
+				Str("boardDir", postBoard.Dir).
+				Msg("Post rejected (board is locked)")
+			server.ServeError(writer, "This board is locked, new posts are not allowed", wantsJSON, map[string]any{
+				"errorCode": errCodeBoardLocked,
+				"boardid":   boardID,
+			})
+			return
+		}
+	}
+
 	var emailCommand string
 	formName = request.FormValue("postname")
-	post.Name, post.Tripcode = gcutil.ParseName(formName)
+	if !postBoard.ForceAnonymous {
+		// names and tripcodes are removed on ForceAnonymous boards, so there's no reason to reject reserved ones
+		if post.Name, post.Tripcode, err = parseName(formName, &boardConfig.PostConfig, request); err != nil {
+			errEv.Err(err).Caller().
+				Msg("Post rejected (reserved tripcode)")
+			server.ServeError(writer, err.Error(), wantsJSON, nil)
+			return
+		}
+	}
 
 	formEmail = request.FormValue("postemail")
 
@@ -192,6 +231,30 @@ func MakePost(writer http.ResponseWriter, request *http.Request) {
 		post.Email = ""
 	}
 
+	if postBoard.ForceAnonymous {
+		// names, tripcodes and emails are not allowed, but email commands (noko, sage) still work
+		post.Email = ""
+	}
+
+	if capcodeStr := request.PostFormValue("capcode"); capcodeStr != "" {
+		// staff posting with their role signature. The capcode is stored as the tripcode, IsRoleSignature is what
+		// keeps it from being spoofed with a regular tripcode
+		staff, _ := gcsql.GetStaffFromRequest(request)
+		capcodeRank, err := strconv.Atoi(capcodeStr)
+		if err != nil || capcodeRank < 1 || capcodeRank > staff.Rank {
+			errEv.Caller().
+				Str("capcode", capcodeStr).
+				Int("staffRank", staff.Rank).
+				Msg("Post rejected (invalid capcode)")
+			server.ServeError(writer, "Invalid capcode", wantsJSON, map[string]any{
+				"capcode": capcodeStr,
+			})
+			return
+		}
+		post.IsRoleSignature = true
+		post.Tripcode = gcsql.RankCapcode(capcodeRank)
+	}
+
 	post.Subject = request.FormValue("postsubject")
 	post.MessageRaw = strings.TrimSpace(request.FormValue("postmsg"))
 	if len(post.MessageRaw) > postBoard.MaxMessageLength {
@@ -199,13 +262,29 @@ func MakePost(writer http.ResponseWriter, request *http.Request) {
 			Int("messageLength", len(post.MessageRaw)).
 			Int("maxMessageLength", postBoard.MaxMessageLength).Send()
 		server.ServeError(writer, "Message is too long", wantsJSON, map[string]any{
+			"errorCode":     errCodeMessageTooLong,
 			"messageLength": len(post.MessageRaw),
 			"boardid":       boardID,
 		})
 		return
 	}
+	numFiles := requestUploadCount(request)
+	noFile := numFiles == 0
+	if len(post.MessageRaw) < postBoard.MinMessageLength && noFile {
+		errEv.
+			Int("messageLength", len(post.MessageRaw)).
+			Int("minMessageLength", postBoard.MinMessageLength).Send()
+		server.ServeError(writer, "Message is too short", wantsJSON, map[string]any{
+			"errorCode":        errCodeMessageTooShort,
+			"messageLength":    len(post.MessageRaw),
+			"minMessageLength": postBoard.MinMessageLength,
+			"boardid":          boardID,
+		})
+		return
+	}
 
-	if post.MessageRaw, err = ApplyWordFilters(post.MessageRaw, postBoard.Dir); err != nil {
+	var actionFilter *gcsql.Wordfilter
+	if post.MessageRaw, actionFilter, err = CheckWordFilters(post.MessageRaw, postBoard.Dir); err != nil {
 		errEv.Err(err).Caller().Msg("Error formatting post")
 		server.ServeError(writer, "Error formatting post: "+err.Error(), wantsJSON, map[string]any{
 			"boardDir": postBoard.Dir,
@@ -227,7 +306,8 @@ func MakePost(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	post.Message = FormatMessage(post.MessageRaw, postBoard.Dir)
+	var commandResults []gcsql.PostCommandResult
+	post.Message, commandResults = FormatNewMessage(post.MessageRaw, postBoard.Dir)
 	password := request.FormValue("postpassword")
 	if password == "" {
 		password = gcutil.RandomString(8)
@@ -284,6 +364,9 @@ func MakePost(writer http.ResponseWriter, request *http.Request) {
 		server.ServeError(writer, "Please wait before making a new post", wantsJSON, nil)
 		return
 	}
+	if !server.CheckRateLimit(writer, request, "/"+postBoard.Dir+"/", boardConfig.PostRateLimit) {
+		return
+	}
 
 	if checkIpBan(post, postBoard, writer, request) {
 		return
@@ -292,11 +375,39 @@ func MakePost(writer http.ResponseWriter, request *http.Request) {
 		return
 	}
 
-	captchaSuccess, err := submitCaptchaResponse(request)
+	var holdReason string
+	blocklistAction, blocklist, err := posterBlocklistAction(post, boardConfig, request)
 	if err != nil {
-		errEv.Err(err).Caller().Send()
-		server.ServeError(writer, "Error submitting captcha response:"+err.Error(), wantsJSON, nil)
+		// don't block posts if a DNSBL can't be reached
+		gcutil.LogWarning().Err(err).Caller().
+			Str("IP", post.IP).
+			Msg("Unable to check blocklists")
+	}
+	switch blocklistAction {
+	case blocklistActionReject:
+		errEv.Str("blocklist", blocklist).Msg("Rejected post from blocklisted IP")
+		server.ServeError(writer, "Your IP address is on a blocklist used by this board", wantsJSON, nil)
 		return
+	case blocklistActionHold:
+		if holdReason == "" {
+			holdReason = "IP is on blocklist " + blocklist
+		}
+	}
+
+	needCaptcha, err := captchaRequired(post.IP, post.ThreadID == 0, postBoard, boardConfig)
+	if err != nil {
+		errEv.Err(err).Caller().Str("boardDir", postBoard.Dir).Msg("Unable to check CAPTCHA policy")
+		server.ServeError(writer, "Error checking CAPTCHA policy", wantsJSON, nil)
+		return
+	}
+	needCaptcha = needCaptcha || blocklistAction == blocklistActionCaptcha
+	captchaSuccess := true
+	if needCaptcha {
+		if captchaSuccess, err = submitCaptchaResponse(request); err != nil && !errors.Is(err, ErrNoCaptchaToken) {
+			errEv.Err(err).Caller().Send()
+			server.ServeError(writer, "Error submitting captcha response:"+err.Error(), wantsJSON, nil)
+			return
+		}
 	}
 
 	if boardConfig.EnableGeoIP || len(boardConfig.CustomFlags) > 0 {
@@ -307,15 +418,71 @@ func MakePost(writer http.ResponseWriter, request *http.Request) {
 	}
 
 	if !captchaSuccess {
-		server.ServeError(writer, "Missing or invalid captcha response", wantsJSON, nil)
+		errMsg := "Missing or invalid captcha response"
+		if blocklistAction == blocklistActionCaptcha {
+			errMsg += " (your IP is on a blocklist, so you have to solve the CAPTCHA to post on this board)"
+		}
+		server.ServeError(writer, errMsg, wantsJSON, nil)
 		errEv.Msg("Missing or invalid captcha response")
 		return
 	}
-	_, _, err = request.FormFile("imagefile")
-	noFile := err == http.ErrMissingFile
+
+	// wordfilter actions and R9K checks are handled after the spam and CAPTCHA checks so that a bot or a
+	// poster who can't post anyway can't use them to ban or mute an IP
+	if actionFilter != nil {
+		errEv.Int("wordfilterID", actionFilter.ID).Str("wordfilterAction", actionFilter.Action)
+		switch actionFilter.Action {
+		case gcsql.WordfilterReject:
+			errEv.Msg("Post rejected by wordfilter")
+			rejectMsg := actionFilter.ChangeTo
+			if rejectMsg == "" {
+				rejectMsg = "Your post was rejected by a wordfilter"
+			}
+			server.ServeError(writer, rejectMsg, wantsJSON, nil)
+			return
+		case gcsql.WordfilterBan:
+			if err = actionFilter.ApplyIPBan(post.IP, postBoard.ID, post.MessageRaw); err != nil {
+				errEv.Err(err).Caller().Msg("Unable to ban IP for matching wordfilter")
+				server.ServeError(writer, "Unable to process post", wantsJSON, nil)
+				return
+			}
+			errEv.Msg("IP banned for post matching wordfilter")
+			if !checkIpBan(post, postBoard, writer, request) {
+				// the ban was created but it doesn't apply here for some reason, reject the post anyway
+				server.ServeError(writer, "Your post was rejected by a wordfilter", wantsJSON, nil)
+			}
+			return
+		case gcsql.WordfilterHold:
+			// takes precedence over the blocklist hold reason
+			holdReason = "matched wordfilter #" + strconv.Itoa(actionFilter.ID)
+		}
+	}
+
+	if boardConfig.R9KMode {
+		if checkR9KMute(post, postBoard, writer, wantsJSON, errEv) {
+			return
+		}
+		// check the message before any uploads are processed
+		if checkR9K(r9kHashes(post.MessageRaw, nil), post, postBoard, boardConfig, writer, wantsJSON, errEv) {
+			return
+		}
+	}
+
 	if noFile && post.ThreadID == 0 && boardConfig.NewThreadsRequireUpload {
 		errEv.Caller().Msg("New thread rejected (NewThreadsRequireUpload set in config)")
-		server.ServeError(writer, "Upload required for new threads", wantsJSON, nil)
+		server.ServeError(writer, "Upload required for new threads", wantsJSON, map[string]any{
+			"errorCode": errCodeFileRequired,
+		})
+		return
+	}
+	if noFile && post.ThreadID == 0 && postBoard.RequireFile {
+		errEv.Caller().
+			Str("boardDir", postBoard.Dir).
+			Msg("New thread rejected (board requires a file in new threads)")
+		server.ServeError(writer, "Upload required for new threads", wantsJSON, map[string]any{
+			"errorCode": errCodeFileRequired,
+			"boardid":   boardID,
+		})
 		return
 	}
 	if post.MessageRaw == "" && noFile {
@@ -323,67 +490,140 @@ func MakePost(writer http.ResponseWriter, request *http.Request) {
 		server.ServeError(writer, "Your post must have an upload or a comment", wantsJSON, nil)
 		return
 	}
-
-	upload, err := uploads.AttachUploadFromRequest(request, writer, post, postBoard)
-	documentRoot := config.GetSystemCriticalConfig().DocumentRoot
-	var filePath, thumbPath, catalogThumbPath string
-	if upload != nil {
-		filePath = path.Join(documentRoot, postBoard.Dir, "src", upload.Filename)
-		thumbPath, catalogThumbPath := uploads.GetThumbnailFilenames(
-			path.Join(documentRoot, postBoard.Dir, "thumb", upload.Filename))
-		if recovered {
-			os.Remove(filePath)
-			os.Remove(thumbPath)
-			os.Remove(catalogThumbPath)
-			writer.WriteHeader(http.StatusInternalServerError)
-			server.ServeError(writer, "Recovered from a panic in an event handler (incoming-upload)", wantsJSON, nil)
+	if !noFile && post.ThreadID > 0 && postBoard.NoImagesAfter > 0 {
+		thread, err := gcsql.GetThread(post.ThreadID)
+		if err != nil {
+			errEv.Err(err).Caller().
+				Int("threadID", post.ThreadID).
+				Msg("Unable to get thread info")
+			server.ServeError(writer, "Unable to get thread info", wantsJSON, map[string]any{
+				"threadid": opID,
+			})
 			return
 		}
+		imageCount, err := thread.GetReplyFileCount()
 		if err != nil {
 			errEv.Err(err).Caller().
-				Str("event", "incoming-upload").
-				Send()
-			server.ServeError(writer, "Unable to attach upload to post: "+err.Error(), wantsJSON, nil)
+				Int("threadID", post.ThreadID).
+				Msg("Unable to get thread upload count")
+			server.ServeError(writer, "Unable to get thread upload count", wantsJSON, map[string]any{
+				"threadid": opID,
+			})
+			return
+		}
+		// every file in the post counts towards the limit
+		if imageCount+numFiles > postBoard.NoImagesAfter {
+			errEv.Caller().
+				Int("imageCount", imageCount).
+				Int("numFiles", numFiles).
+				Int("imageLimit", postBoard.NoImagesAfter).
+				Msg("Upload rejected (thread image limit reached)")
+			server.ServeError(writer, "This thread has reached its image limit, replies can not have uploads", wantsJSON, map[string]any{
+				"threadid":   opID,
+				"imageLimit": postBoard.NoImagesAfter,
+			})
 			return
 		}
-	} else if err != nil {
+	}
+
+	postUploads, err := uploads.AttachUploadsFromRequest(request, writer, post, postBoard)
+	if err != nil {
 		errEv.Err(err).Caller().Send()
-		// got an error receiving the upload or the upload was rejected
+		// got an error receiving the upload(s) or an upload was rejected
+		var dupErr *uploads.DuplicateUploadError
+		var tooManyErr *uploads.TooManyFilesError
+		if errors.As(err, &dupErr) {
+			server.ServeError(writer, err.Error(), wantsJSON, map[string]any{
+				"postID":   dupErr.PostID,
+				"postLink": dupErr.PostPath,
+			})
+			return
+		} else if errors.As(err, &tooManyErr) {
+			server.ServeError(writer, err.Error(), wantsJSON, map[string]any{
+				"maxFiles": tooManyErr.MaxFiles,
+			})
+			return
+		}
 		server.ServeError(writer, err.Error(), wantsJSON, nil)
 		return
 	}
 
-	if err = post.Insert(emailCommand != "sage", postBoard.ID, false, false, false, false); err != nil {
+	var r9kPostHashes []string
+	if boardConfig.R9KMode {
+		r9kPostHashes = r9kHashes(post.MessageRaw, postUploads)
+		if checkR9K(r9kPostHashes, post, postBoard, boardConfig, writer, wantsJSON, errEv) {
+			uploads.RemoveUploadFiles(postBoard.Dir, postUploads...)
+			return
+		}
+	}
+
+	if holdReason == "" {
+		if holdReason, err = premoderationReason(post, postBoard, &boardConfig.PostConfig, request); err != nil {
+			errEv.Err(err).Caller().Msg("Unable to check if post should be held for approval")
+			uploads.RemoveUploadFiles(postBoard.Dir, postUploads...)
+			server.ServeError(writer, "Unable to insert post", wantsJSON, nil)
+			return
+		}
+	}
+
+	bumpThread := emailCommand != "sage"
+	if holdReason != "" {
+		err = post.InsertPending(holdReason, bumpThread, postBoard.ID, false, false, false, false)
+	} else {
+		err = post.Insert(bumpThread, postBoard.ID, false, false, false, false)
+	}
+	if err != nil {
 		errEv.Err(err).Caller().
 			Str("sql", "postInsertion").
 			Msg("Unable to insert post")
-		if upload != nil {
-			os.Remove(filePath)
-			os.Remove(thumbPath)
-			os.Remove(catalogThumbPath)
-		}
+		uploads.RemoveUploadFiles(postBoard.Dir, postUploads...)
 		server.ServeError(writer, "Unable to insert post", wantsJSON, nil)
 		return
 	}
-
-	if err = post.AttachFile(upload); err != nil {
+	if err = post.SetCommandResults(commandResults); err != nil {
 		errEv.Err(err).Caller().
 			Str("sql", "postInsertion").
-			Msg("Unable to attach upload to post")
-		os.Remove(filePath)
-		os.Remove(thumbPath)
-		os.Remove(catalogThumbPath)
+			Msg("Unable to store post command results")
+		uploads.RemoveUploadFiles(postBoard.Dir, postUploads...)
 		post.Delete()
-		server.ServeError(writer, "Unable to attach upload", wantsJSON, map[string]any{
-			"filename": upload.OriginalFilename,
-		})
+		server.ServeError(writer, "Unable to insert post", wantsJSON, nil)
 		return
 	}
-	if upload != nil {
-		if err = config.TakeOwnership(filePath); err != nil {
+
+	for _, upload := range postUploads {
+		if err = post.AttachFile(upload); err != nil {
 			errEv.Err(err).Caller().
-				Str("file", filePath).Send()
+				Str("sql", "postInsertion").
+				Msg("Unable to attach upload to post")
+			uploads.RemoveUploadFiles(postBoard.Dir, postUploads...)
+			post.Delete()
+			server.ServeError(writer, "Unable to attach upload", wantsJSON, map[string]any{
+				"filename": upload.OriginalFilename,
+			})
+			return
 		}
+	}
+	if holdReason == "" {
+		// held posts have their hashes stored when they are approved, so that rejected posts can be made again
+		if err = gcsql.AddR9KHashes(postBoard.ID, r9kPostHashes...); err != nil {
+			// the post has already been made, so it isn't worth rejecting it here
+			errEv.Err(err).Caller().
+				Str("boardDir", postBoard.Dir).
+				Msg("Unable to store R9K hashes")
+		}
+	}
+	documentRoot := config.GetSystemCriticalConfig().DocumentRoot
+	for _, upload := range postUploads {
+		// embeds only have thumbnails stored locally
+		if !uploads.IsEmbed(upload.Filename) {
+			filePath := path.Join(documentRoot, postBoard.Dir, "src", upload.Filename)
+			if err = config.TakeOwnership(filePath); err != nil {
+				errEv.Err(err).Caller().
+					Str("file", filePath).Send()
+			}
+		}
+		thumbPath, catalogThumbPath := uploads.GetThumbnailFilenames(
+			path.Join(documentRoot, postBoard.Dir, "thumb", upload.Filename))
 		if err = config.TakeOwnership(thumbPath); err != nil {
 			errEv.Err(err).Caller().
 				Str("thumbnail", thumbPath).Send()
@@ -394,6 +634,27 @@ func MakePost(writer http.ResponseWriter, request *http.Request) {
 		}
 	}
 
+	if holdReason != "" {
+		gcutil.LogInfo().
+			Str("IP", post.IP).
+			Int("postID", post.ID).
+			Str("boardDir", postBoard.Dir).
+			Str("holdReason", holdReason).
+			Msg("Post held for approval")
+		servePendingNotice(writer, post, postBoard, wantsJSON)
+		return
+	}
+
+	if !post.IsTopPost {
+		// cyclical threads have their oldest replies pruned once they pass the board's reply limit
+		thread, err := gcsql.GetThread(post.ThreadID)
+		if err != nil {
+			errEv.Err(err).Caller().Msg("Unable to get post thread")
+		} else if err = building.TrimCyclicalThread(postBoard, thread); err != nil {
+			errEv.Err(err).Caller().Msg("Unable to trim cyclical thread")
+		}
+	}
+
 	// rebuild the board page
 	if err = building.BuildBoards(false, postBoard.ID); err != nil {
 		server.ServeError(writer, "Unable to build boards", wantsJSON, nil)
@@ -0,0 +1,43 @@
+package posting
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPostRequest(t *testing.T, fields map[string]string, filenames ...string) *http.Request {
+	var body bytes.Buffer
+	mpWriter := multipart.NewWriter(&body)
+	for field, value := range fields {
+		if err := mpWriter.WriteField(field, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, filename := range filenames {
+		fileWriter, err := mpWriter.CreateFormFile("imagefile", filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileWriter.Write([]byte("file contents"))
+	}
+	if err := mpWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/post", &body)
+	request.Header.Set("Content-Type", mpWriter.FormDataContentType())
+	return request
+}
+
+func TestRequestUploadCount(t *testing.T) {
+	assert.Zero(t, requestUploadCount(newPostRequest(t, map[string]string{"postmsg": "hello"})))
+	assert.Equal(t, 1, requestUploadCount(newPostRequest(t, nil, "image.png")))
+	assert.Equal(t, 3, requestUploadCount(newPostRequest(t, nil, "1.png", "2.png", "3.webm")),
+		"every file in the post should be counted")
+	assert.Equal(t, 1, requestUploadCount(newPostRequest(t, map[string]string{"embed": "https://youtu.be/abc"})),
+		"embeds should count as uploads")
+}
@@ -0,0 +1,255 @@
+package posting
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/gochan-org/gochan/pkg/gcutil"
+	"github.com/gochan-org/gochan/pkg/server"
+)
+
+const (
+	// powChallengeLifetime is how long the poster has to solve a proof-of-work challenge and submit their post
+	powChallengeLifetime = 10 * time.Minute
+	// powRateWindow is the number of seconds since the poster's last post after which no extra difficulty is added.
+	// Every time the time since their last post is halved, the difficulty goes up by one bit
+	powRateWindow         = 600
+	maxPowExtraDifficulty = 8
+	maxPowDifficulty      = 32
+	maxPowSolutionLength  = 20
+)
+
+var (
+	ErrInvalidPowChallenge = errors.New("invalid proof-of-work challenge")
+
+	usedPowChallenges = usedPowChallengeSet{
+		nonces: make(map[string]time.Time),
+	}
+)
+
+// powChallenge is a proof-of-work puzzle given to a poster. The poster must find a solution where the SHA-256
+// hash of the challenge string, a colon, and the solution starts with at least Difficulty zero bits
+type powChallenge struct {
+	BoardID    int
+	Difficulty int
+	Expires    time.Time
+	Nonce      string
+}
+
+// String returns the challenge in the form sent to the poster, signed so that it can't be changed or used by
+// another IP
+func (pc *powChallenge) String(ip string) string {
+	payload := fmt.Sprintf("%d.%d.%d.%s", pc.BoardID, pc.Difficulty, pc.Expires.Unix(), pc.Nonce)
+	return payload + "." + powSignature(ip, payload)
+}
+
+// solved returns true if the solution is valid for the challenge string
+func (pc *powChallenge) solved(challengeStr string, solution string) bool {
+	if solution == "" || len(solution) > maxPowSolutionLength {
+		return false
+	}
+	sum := sha256.Sum256([]byte(challengeStr + ":" + solution))
+	return leadingZeroBits(sum[:]) >= pc.Difficulty
+}
+
+func powSignature(ip string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(config.GetSystemCriticalConfig().RandomSeed))
+	mac.Write([]byte("pow:" + ip + ":" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newPowChallenge creates a new random challenge for a post on the board
+func newPowChallenge(boardID int, difficulty int) (*powChallenge, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &powChallenge{
+		BoardID:    boardID,
+		Difficulty: difficulty,
+		Expires:    time.Now().Add(powChallengeLifetime),
+		Nonce:      hex.EncodeToString(nonce),
+	}, nil
+}
+
+// parsePowChallenge parses a challenge string sent by the poster, returning ErrInvalidPowChallenge if it wasn't
+// issued to their IP or it has expired
+func parsePowChallenge(ip string, challengeStr string) (*powChallenge, error) {
+	lastDot := strings.LastIndexByte(challengeStr, '.')
+	if lastDot < 0 {
+		return nil, ErrInvalidPowChallenge
+	}
+	payload := challengeStr[:lastDot]
+	if !hmac.Equal([]byte(challengeStr[lastDot+1:]), []byte(powSignature(ip, payload))) {
+		return nil, ErrInvalidPowChallenge
+	}
+	fields := strings.Split(payload, ".")
+	if len(fields) != 4 {
+		return nil, ErrInvalidPowChallenge
+	}
+	var challenge powChallenge
+	var err error
+	var expires int64
+	if challenge.BoardID, err = strconv.Atoi(fields[0]); err != nil {
+		return nil, ErrInvalidPowChallenge
+	}
+	if challenge.Difficulty, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, ErrInvalidPowChallenge
+	}
+	if expires, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return nil, ErrInvalidPowChallenge
+	}
+	challenge.Expires = time.Unix(expires, 0)
+	challenge.Nonce = fields[3]
+	if time.Now().After(challenge.Expires) {
+		return nil, ErrInvalidPowChallenge
+	}
+	return &challenge, nil
+}
+
+func leadingZeroBits(sum []byte) int {
+	var zeroes int
+	for _, b := range sum {
+		if b != 0 {
+			return zeroes + bits.LeadingZeros8(b)
+		}
+		zeroes += 8
+	}
+	return zeroes
+}
+
+// powRateDifficulty returns the number of bits of difficulty added for a poster that last posted the given number
+// of seconds ago, so that flooders have to do more work for each post
+func powRateDifficulty(secondsSinceLastPost int) int {
+	if secondsSinceLastPost >= powRateWindow {
+		return 0
+	}
+	if secondsSinceLastPost < 1 {
+		secondsSinceLastPost = 1
+	}
+	extra := int(math.Log2(float64(powRateWindow) / float64(secondsSinceLastPost)))
+	if extra > maxPowExtraDifficulty {
+		return maxPowExtraDifficulty
+	}
+	return extra
+}
+
+// powDifficulty returns the number of leading zero bits a proof-of-work solution must have for the IP to post on
+// the board, using the board's PowDifficulty and how recently the IP last posted
+func powDifficulty(boardID int, ip string) (int, error) {
+	boardDir, err := gcsql.GetBoardDir(boardID)
+	if err != nil {
+		return 0, err
+	}
+	difficulty := config.GetBoardConfig(boardDir).PowDifficulty
+	sinceLastPost, err := gcsql.SinceLastPost(ip)
+	if err != nil {
+		return 0, err
+	}
+	difficulty += powRateDifficulty(sinceLastPost)
+	if difficulty > maxPowDifficulty {
+		difficulty = maxPowDifficulty
+	}
+	return difficulty, nil
+}
+
+// usedPowChallengeSet keeps track of the proof-of-work challenges that have been used so that a solution can't be
+// used for more than one post
+type usedPowChallengeSet struct {
+	mutex     sync.Mutex
+	nonces    map[string]time.Time
+	lastPrune time.Time
+}
+
+// use marks the challenge as used, returning false if it had already been used
+func (upcs *usedPowChallengeSet) use(challenge *powChallenge) bool {
+	upcs.mutex.Lock()
+	defer upcs.mutex.Unlock()
+	now := time.Now()
+	if now.Sub(upcs.lastPrune) > time.Minute {
+		upcs.lastPrune = now
+		for nonce, expires := range upcs.nonces {
+			if now.After(expires) {
+				delete(upcs.nonces, nonce)
+			}
+		}
+	}
+	if _, used := upcs.nonces[challenge.Nonce]; used {
+		return false
+	}
+	upcs.nonces[challenge.Nonce] = challenge.Expires
+	return true
+}
+
+// servePowChallenge sends a new proof-of-work challenge for the board in the request as JSON
+func servePowChallenge(writer http.ResponseWriter, request *http.Request) {
+	ip := gcutil.GetRealIP(request)
+	errEv := gcutil.LogError(nil).
+		Str("IP", ip)
+	defer errEv.Discard()
+
+	boardID, err := strconv.Atoi(request.FormValue("boardid"))
+	if err != nil {
+		errEv.Err(err).Caller().Str("boardid", request.FormValue("boardid")).Send()
+		server.ServeError(writer, "Invalid board ID", true, nil)
+		return
+	}
+	difficulty, err := powDifficulty(boardID, ip)
+	if err != nil {
+		errEv.Err(err).Caller().Int("boardID", boardID).Msg("Unable to get proof-of-work difficulty")
+		server.ServeError(writer, "Unable to generate proof-of-work challenge", true, nil)
+		return
+	}
+	challenge, err := newPowChallenge(boardID, difficulty)
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to generate proof-of-work challenge")
+		server.ServeError(writer, "Unable to generate proof-of-work challenge", true, nil)
+		return
+	}
+	writer.Header().Set("Cache-Control", "no-store")
+	server.ServeJSON(writer, map[string]any{
+		"challenge":  challenge.String(ip),
+		"difficulty": difficulty,
+	})
+}
+
+// checkPowCaptcha returns true if the request has a valid solution to a proof-of-work challenge issued to the
+// poster for the board they are posting on, with at least the difficulty currently required of them
+func checkPowCaptcha(request *http.Request) (bool, error) {
+	challengeStr := request.PostFormValue("powchallenge")
+	solution := request.PostFormValue("powsolution")
+	if challengeStr == "" || solution == "" {
+		return false, ErrNoCaptchaToken
+	}
+	ip := gcutil.GetRealIP(request)
+	challenge, err := parsePowChallenge(ip, challengeStr)
+	if err != nil {
+		return false, nil
+	}
+	boardID, _ := strconv.Atoi(request.PostFormValue("boardid"))
+	if boardID != challenge.BoardID || !challenge.solved(challengeStr, solution) {
+		return false, nil
+	}
+	required, err := powDifficulty(boardID, ip)
+	if err != nil {
+		return false, err
+	}
+	if challenge.Difficulty < required {
+		return false, nil
+	}
+	return usedPowChallenges.use(challenge), nil
+}
@@ -0,0 +1,68 @@
+package posting
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPowRateDifficulty(t *testing.T) {
+	assert.Equal(t, 0, powRateDifficulty(powRateWindow))
+	assert.Equal(t, 0, powRateDifficulty(1000000))
+	assert.Equal(t, 1, powRateDifficulty(powRateWindow/2))
+	assert.Equal(t, 3, powRateDifficulty(powRateWindow/8))
+	assert.Equal(t, maxPowExtraDifficulty, powRateDifficulty(1))
+	assert.Equal(t, maxPowExtraDifficulty, powRateDifficulty(-1))
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	assert.Equal(t, 0, leadingZeroBits([]byte{0x80, 0}))
+	assert.Equal(t, 7, leadingZeroBits([]byte{0x01, 0xff}))
+	assert.Equal(t, 12, leadingZeroBits([]byte{0, 0x08}))
+	assert.Equal(t, 16, leadingZeroBits([]byte{0, 0}))
+}
+
+func TestPowChallenge(t *testing.T) {
+	config.SetVersion("3.10.1")
+	config.SetRandomSeed("test")
+	challenge, err := newPowChallenge(2, 8)
+	if !assert.NoError(t, err) {
+		return
+	}
+	challengeStr := challenge.String("192.168.56.1")
+	parsed, err := parsePowChallenge("192.168.56.1", challengeStr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 2, parsed.BoardID)
+	assert.Equal(t, 8, parsed.Difficulty)
+	assert.Equal(t, challenge.Nonce, parsed.Nonce)
+
+	_, err = parsePowChallenge("192.168.56.2", challengeStr)
+	assert.ErrorIs(t, err, ErrInvalidPowChallenge, "challenges should only be valid for the IP they were issued to")
+	_, err = parsePowChallenge("192.168.56.1", "2.0"+challengeStr[3:])
+	assert.ErrorIs(t, err, ErrInvalidPowChallenge, "modified challenges should be rejected")
+	_, err = parsePowChallenge("192.168.56.1", "garbage")
+	assert.ErrorIs(t, err, ErrInvalidPowChallenge)
+
+	expired := *challenge
+	expired.Expires = time.Now().Add(-time.Second)
+	_, err = parsePowChallenge("192.168.56.1", expired.String("192.168.56.1"))
+	assert.ErrorIs(t, err, ErrInvalidPowChallenge, "expired challenges should be rejected")
+
+	var solution string
+	for i := 0; ; i++ {
+		solution = strconv.Itoa(i)
+		if parsed.solved(challengeStr, solution) {
+			break
+		}
+	}
+	assert.False(t, parsed.solved(challengeStr, ""))
+
+	used := usedPowChallengeSet{nonces: make(map[string]time.Time)}
+	assert.True(t, used.use(parsed))
+	assert.False(t, used.use(parsed), "challenges should only be usable once")
+}
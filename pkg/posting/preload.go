@@ -0,0 +1,128 @@
+package posting
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	lua "github.com/yuin/gopher-lua"
+	luar "layeh.com/gopher-luar"
+)
+
+// luaPostCommand returns a PostCommandHandler that calls the Lua function, which is expected to return the
+// result string and an error string (empty or nil if there was no error)
+func luaPostCommand(l *lua.LState, fn *lua.LFunction) PostCommandHandler {
+	return func(args string) (string, error) {
+		err := l.CallByParam(lua.P{
+			Fn:      fn,
+			NRet:    2,
+			Protect: true,
+		}, lua.LString(args))
+		if err != nil {
+			return "", err
+		}
+		result := lua.LVAsString(l.Get(-2))
+		errStr := lua.LVAsString(l.Get(-1))
+		l.Pop(2)
+		if errStr != "" {
+			return "", errors.New(errStr)
+		}
+		return result, nil
+	}
+}
+
+// luaCaptchaProvider is a CaptchaProvider registered by a Lua plugin with a table of functions. init and widget are
+// optional
+type luaCaptchaProvider struct {
+	lState     *lua.LState
+	initFunc   lua.LValue
+	widgetFunc lua.LValue
+	verifyFunc lua.LValue
+}
+
+func (lcp *luaCaptchaProvider) Init(captchaCfg *config.CaptchaConfig) error {
+	if lcp.initFunc == lua.LNil {
+		return nil
+	}
+	err := lcp.lState.CallByParam(lua.P{
+		Fn:      lcp.initFunc,
+		NRet:    1,
+		Protect: true,
+	}, luar.New(lcp.lState, captchaCfg))
+	if err != nil {
+		return err
+	}
+	errStr := lua.LVAsString(lcp.lState.Get(-1))
+	lcp.lState.Pop(1)
+	if errStr != "" {
+		return errors.New(errStr)
+	}
+	return nil
+}
+
+func (lcp *luaCaptchaProvider) WidgetHTML(captchaCfg *config.CaptchaConfig) template.HTML {
+	if lcp.widgetFunc == lua.LNil {
+		return ""
+	}
+	err := lcp.lState.CallByParam(lua.P{
+		Fn:      lcp.widgetFunc,
+		NRet:    1,
+		Protect: true,
+	}, luar.New(lcp.lState, captchaCfg))
+	if err != nil {
+		return ""
+	}
+	widget := lua.LVAsString(lcp.lState.Get(-1))
+	lcp.lState.Pop(1)
+	return template.HTML(widget) // skipcq: GSC-G203
+}
+
+func (lcp *luaCaptchaProvider) Verify(request *http.Request, captchaCfg *config.CaptchaConfig) (bool, error) {
+	err := lcp.lState.CallByParam(lua.P{
+		Fn:      lcp.verifyFunc,
+		NRet:    2,
+		Protect: true,
+	}, luar.New(lcp.lState, request), luar.New(lcp.lState, captchaCfg))
+	if err != nil {
+		return false, err
+	}
+	success := lua.LVAsBool(lcp.lState.Get(-2))
+	errStr := lua.LVAsString(lcp.lState.Get(-1))
+	lcp.lState.Pop(2)
+	if errStr != "" {
+		return false, errors.New(errStr)
+	}
+	return success, nil
+}
+
+func PreloadModule(l *lua.LState) int {
+	t := l.NewTable()
+	l.SetFuncs(t, map[string]lua.LGFunction{
+		"register_command": func(l *lua.LState) int {
+			name := l.CheckString(1)
+			fn := l.CheckFunction(2)
+			l.Push(luar.New(l, RegisterPostCommand(name, luaPostCommand(l, fn))))
+			return 1
+		},
+		"register_captcha_provider": func(l *lua.LState) int {
+			id := l.CheckString(1)
+			providerTable := l.CheckTable(2)
+			verifyFunc, ok := providerTable.RawGetString("verify").(*lua.LFunction)
+			if !ok {
+				l.ArgError(2, "captcha provider table must have a verify function")
+				return 0
+			}
+			provider := &luaCaptchaProvider{
+				lState:     l,
+				initFunc:   providerTable.RawGetString("init"),
+				widgetFunc: providerTable.RawGetString("widget"),
+				verifyFunc: verifyFunc,
+			}
+			l.Push(luar.New(l, RegisterCaptchaProvider(id, provider)))
+			return 1
+		},
+	})
+	l.Push(t)
+	return 1
+}
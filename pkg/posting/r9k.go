@@ -0,0 +1,158 @@
+package posting
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/gochan-org/gochan/pkg/server"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// r9kMaxMute is the longest an IP can be muted for posting unoriginal content, no matter how many times
+	// they have been muted before
+	r9kMaxMute     = 30 * 24 * time.Hour
+	r9kMuteMessage = "Your post was not original (its text or one of its files has been posted on this board before)"
+)
+
+var (
+	// r9kIgnoredRE matches anything that isn't a letter or a number, so that punctuation, formatting, and
+	// whitespace can't be used to make a post look original
+	r9kIgnoredRE = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+)
+
+// r9kHashes returns the hashes of the post's normalized message text and the checksums of its uploads. If the
+// message has no letters or numbers, only the uploads are hashed
+func r9kHashes(messageRaw string, postUploads []*gcsql.Upload) []string {
+	var hashes []string
+	normalized := strings.TrimSpace(r9kIgnoredRE.ReplaceAllString(strings.ToLower(messageRaw), " "))
+	if normalized != "" {
+		hashes = append(hashes, r9kHash("text", normalized))
+	}
+	for _, upload := range postUploads {
+		if upload.Checksum != "" {
+			hashes = append(hashes, r9kHash("file", upload.Checksum))
+		}
+	}
+	return hashes
+}
+
+// AddApprovedR9KHashes stores the R9K hashes of a post that was held for approval, since they aren't stored
+// until it is approved
+func AddApprovedR9KHashes(post *gcsql.PendingPost) error {
+	if !config.GetBoardConfig(post.BoardDir).R9KMode {
+		return nil
+	}
+	postUploads, err := post.GetUploads()
+	if err != nil {
+		return err
+	}
+	uploadPtrs := make([]*gcsql.Upload, len(postUploads))
+	for u := range postUploads {
+		uploadPtrs[u] = &postUploads[u]
+	}
+	return gcsql.AddR9KHashes(post.BoardID, r9kHashes(post.MessageRaw, uploadPtrs)...)
+}
+
+func r9kHash(kind string, value string) string {
+	sum := sha256.Sum256([]byte(kind + ":" + value))
+	return hex.EncodeToString(sum[:])
+}
+
+// r9kMuteDuration returns how long the poster should be muted for, doubling from the board's R9KMuteSeconds with
+// every mute up to r9kMaxMute
+func r9kMuteDuration(baseSeconds int, muteCount int) time.Duration {
+	duration := time.Duration(baseSeconds) * time.Second
+	for m := 1; m < muteCount && duration < r9kMaxMute; m++ {
+		duration *= 2
+	}
+	if duration > r9kMaxMute {
+		duration = r9kMaxMute
+	}
+	return duration
+}
+
+// showMutePage serves the ban page with the IP's R9K mute status
+func showMutePage(mute *gcsql.R9KMute, post *gcsql.Post, postBoard *gcsql.Board, writer http.ResponseWriter) {
+	ban := &gcsql.IPBan{
+		BoardID:    &postBoard.ID,
+		RangeStart: post.IP,
+		RangeEnd:   post.IP,
+		IssuedAt:   time.Now(),
+		IPBanBase: gcsql.IPBanBase{
+			IsActive:  true,
+			ExpiresAt: mute.ExpiresAt,
+			Message:   r9kMuteMessage,
+		},
+	}
+	serveBanPage(ban, post, postBoard, true, writer)
+}
+
+// checkR9KMute checks if the IP is muted on a board in R9K mode. It returns true if the mute page or an error page
+// was served (causing MakePost() to return)
+func checkR9KMute(post *gcsql.Post, postBoard *gcsql.Board, writer http.ResponseWriter, wantsJSON bool, errEv *zerolog.Event) bool {
+	mute, err := gcsql.GetR9KMute(postBoard.ID, post.IP)
+	if err != nil {
+		errEv.Err(err).Caller().
+			Str("boardDir", postBoard.Dir).
+			Msg("Unable to get R9K mute status")
+		server.ServeError(writer, "Unable to get R9K mute status", wantsJSON, nil)
+		return true
+	}
+	if !mute.IsActive() {
+		return false
+	}
+	errEv.Time("expiresAt", mute.ExpiresAt).
+		Str("boardDir", postBoard.Dir).
+		Msg("Rejected post from IP muted by R9K mode")
+	showMutePage(mute, post, postBoard, writer)
+	return true
+}
+
+// checkR9K rejects the post and mutes the poster if any of the hashes have been posted on the board before. It
+// returns true if the mute page or an error page was served (causing MakePost() to return)
+func checkR9K(hashes []string, post *gcsql.Post, postBoard *gcsql.Board, boardConfig *config.BoardConfig, writer http.ResponseWriter, wantsJSON bool, errEv *zerolog.Event) bool {
+	unoriginal, err := gcsql.CheckR9KHashes(postBoard.ID, hashes...)
+	if err != nil {
+		errEv.Err(err).Caller().
+			Str("boardDir", postBoard.Dir).
+			Msg("Unable to check post originality")
+		server.ServeError(writer, "Unable to check post originality", wantsJSON, nil)
+		return true
+	}
+	if !unoriginal {
+		return false
+	}
+	mute, err := gcsql.GetR9KMute(postBoard.ID, post.IP)
+	if err != nil {
+		errEv.Err(err).Caller().
+			Str("boardDir", postBoard.Dir).
+			Msg("Unable to get R9K mute status")
+		server.ServeError(writer, "Unable to get R9K mute status", wantsJSON, nil)
+		return true
+	}
+	if mute == nil {
+		mute = &gcsql.R9KMute{BoardID: postBoard.ID, IP: post.IP}
+	}
+	mute.MuteCount++
+	mute.ExpiresAt = time.Now().Add(r9kMuteDuration(boardConfig.R9KMuteSeconds, mute.MuteCount))
+	if err = mute.Save(); err != nil {
+		errEv.Err(err).Caller().
+			Str("boardDir", postBoard.Dir).
+			Msg("Unable to update R9K mute")
+		server.ServeError(writer, "Unable to update R9K mute", wantsJSON, nil)
+		return true
+	}
+	errEv.Int("muteCount", mute.MuteCount).
+		Time("expiresAt", mute.ExpiresAt).
+		Str("boardDir", postBoard.Dir).
+		Msg("Rejected unoriginal post in R9K mode")
+	showMutePage(mute, post, postBoard, writer)
+	return true
+}
@@ -0,0 +1,37 @@
+package posting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestR9KHashes(t *testing.T) {
+	hashes := r9kHashes("Hello, World!", nil)
+	assert.Len(t, hashes, 1)
+	assert.Equal(t, hashes, r9kHashes("  hello world  \n", nil), "case, punctuation, and whitespace should be ignored")
+	assert.NotEqual(t, hashes, r9kHashes("hello world 2", nil))
+	assert.Empty(t, r9kHashes("!!! ...", nil), "a message with no letters or numbers should not be hashed")
+
+	upload := &gcsql.Upload{Checksum: "d41d8cd98f00b204e9800998ecf8427e"}
+	fileHashes := r9kHashes("", []*gcsql.Upload{upload})
+	assert.Len(t, fileHashes, 1)
+	assert.NotEqual(t, fileHashes, r9kHashes(upload.Checksum, nil), "text and file hashes should not collide")
+}
+
+func TestR9KMuteDuration(t *testing.T) {
+	assert.Equal(t, 2*time.Second, r9kMuteDuration(2, 1))
+	assert.Equal(t, 4*time.Second, r9kMuteDuration(2, 2))
+	assert.Equal(t, 16*time.Second, r9kMuteDuration(2, 4))
+	assert.Equal(t, r9kMaxMute, r9kMuteDuration(2, 1000))
+}
+
+func TestAddApprovedR9KHashesDisabled(t *testing.T) {
+	config.SetVersion("4.0.0")
+	config.GetBoardConfig("").R9KMode = false
+	post := &gcsql.PendingPost{Post: gcsql.Post{ID: 1, MessageRaw: "hello world"}, BoardID: 1, BoardDir: "test"}
+	assert.NoError(t, AddApprovedR9KHashes(post), "nothing should be stored if R9K mode is disabled")
+}
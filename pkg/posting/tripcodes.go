@@ -0,0 +1,80 @@
+package posting
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/aquilax/tripcode"
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/gochan-org/gochan/pkg/gcutil"
+)
+
+const (
+	// maxTripcodeLength is the size of the tripcode column in the posts table
+	maxTripcodeLength = 32
+)
+
+var (
+	ErrReservedTripcode = errors.New("that tripcode is reserved")
+)
+
+// reservedTrip is an entry in ReservedTrips, in the form password##tripcode
+type reservedTrip struct {
+	password string
+	tripcode string // the tripcode as it is stored, including gcutil.SecureTripcodePrefix
+}
+
+func getReservedTrips(postCfg *config.PostConfig) []reservedTrip {
+	reserved := make([]reservedTrip, 0, len(postCfg.ReservedTrips))
+	for _, entry := range postCfg.ReservedTrips {
+		password, trip, found := strings.Cut(entry, "##")
+		if !found || trip == "" || len(gcutil.SecureTripcodePrefix+trip) > maxTripcodeLength {
+			continue
+		}
+		reserved = append(reserved, reservedTrip{
+			password: password,
+			tripcode: gcutil.SecureTripcodePrefix + trip,
+		})
+	}
+	return reserved
+}
+
+// parseName gets the name and tripcode from the name field. A secure tripcode (name##password) matching a
+// password in ReservedTrips is replaced with the reserved tripcode, and staff can use a reserved tripcode by
+// entering it as the password. Any other name that would result in a reserved tripcode is rejected
+func parseName(formName string, postCfg *config.PostConfig, request *http.Request) (string, string, error) {
+	name, password, secure := gcutil.SplitName(formName)
+	if password == "" {
+		return name, "", nil
+	}
+	reservedTrips := getReservedTrips(postCfg)
+	var trip string
+	if secure {
+		var staffRank int
+		for _, reserved := range reservedTrips {
+			if reserved.password != "" && password == reserved.password {
+				return name, reserved.tripcode, nil
+			}
+			if gcutil.SecureTripcodePrefix+password == reserved.tripcode {
+				if staffRank == 0 {
+					staff, _ := gcsql.GetStaffFromRequest(request)
+					staffRank = staff.Rank
+				}
+				if staffRank > 0 {
+					return name, reserved.tripcode, nil
+				}
+			}
+		}
+		trip = gcutil.SecureTripcode(password, config.GetSystemCriticalConfig().RandomSeed)
+	} else {
+		trip = tripcode.Tripcode(password)
+	}
+	for _, reserved := range reservedTrips {
+		if trip == reserved.tripcode {
+			return "", "", ErrReservedTripcode
+		}
+	}
+	return name, trip, nil
+}
@@ -0,0 +1,75 @@
+package posting
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseName(t *testing.T) {
+	config.SetVersion(versionStr)
+	config.SetRandomSeed("test")
+	postCfg := &config.PostConfig{
+		ReservedTrips: []string{"password##Reserved", "##StaffOnly"},
+	}
+	request := &http.Request{Header: make(http.Header)}
+
+	testCases := []struct {
+		desc         string
+		formName     string
+		expectedName string
+		expectedTrip string
+		expectedErr  error
+	}{
+		{
+			desc:         "regular tripcode",
+			formName:     "Name#Trip",
+			expectedName: "Name",
+			expectedTrip: "piec1MorXg",
+		},
+		{
+			desc:         "secure tripcode",
+			formName:     "Name##Trip",
+			expectedName: "Name",
+			expectedTrip: gcutil.SecureTripcode("Trip", "test"),
+		},
+		{
+			desc:         "reserved tripcode with password",
+			formName:     "Name##password",
+			expectedName: "Name",
+			expectedTrip: "!Reserved",
+		},
+		{
+			desc:         "staff-only tripcode without staff login",
+			formName:     "Name##StaffOnly",
+			expectedName: "Name",
+			expectedTrip: gcutil.SecureTripcode("StaffOnly", "test"),
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			name, trip, err := parseName(tC.formName, postCfg, request)
+			assert.ErrorIs(t, err, tC.expectedErr)
+			assert.Equal(t, tC.expectedName, name)
+			assert.Equal(t, tC.expectedTrip, trip)
+		})
+	}
+
+	// a secure tripcode that happens to match a reserved one is rejected
+	postCfg.ReservedTrips = append(postCfg.ReservedTrips,
+		"##"+gcutil.SecureTripcode("Trip", "test")[len(gcutil.SecureTripcodePrefix):])
+	_, _, err := parseName("Name##Trip", postCfg, request)
+	assert.ErrorIs(t, err, ErrReservedTripcode)
+
+	postCfg.ReservedTrips = []string{"long##" + strings.Repeat("A", maxTripcodeLength)}
+	name, trip, err := parseName("Name##long", postCfg, request)
+	assert.NoError(t, err)
+	assert.Equal(t, "Name", name)
+	assert.Equal(t, gcutil.SecureTripcode("long", "test"), trip,
+		"reserved tripcodes that don't fit in the database should be ignored")
+	assert.LessOrEqual(t, len(trip), maxTripcodeLength)
+}
@@ -3,16 +3,17 @@ package uploads
 import (
 	"bytes"
 	"crypto/md5"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"html"
 	"io"
-	"math/rand"
+	"math/big"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -24,7 +25,14 @@ import (
 	"github.com/rs/zerolog"
 )
 
+const (
+	// maxFilenameAttempts is the number of times a new filename is generated if the previous one is taken
+	maxFilenameAttempts = 5
+)
+
 var (
+	ErrNoUniqueFilename = errors.New("unable to generate a unique filename for the upload")
+
 	uploadHandlers  map[string]UploadHandler
 	ImageExtensions = []string{
 		".gif", ".jpg", ".jpeg", ".png", ".webp",
@@ -71,26 +79,121 @@ func init() {
 	}
 }
 
-// AttachUploadFromRequest reads an incoming HTTP request and processes any incoming files.
+// AttachUploadFromRequest reads an incoming HTTP request and processes the first incoming file (or embed).
 // It returns the upload (if there was one) and whether or not any errors were served (meaning
 // that it should stop processing the post
 func AttachUploadFromRequest(request *http.Request, writer http.ResponseWriter, post *gcsql.Post, postBoard *gcsql.Board) (*gcsql.Upload, error) {
+	_, handler, err := request.FormFile("imagefile")
+	if errors.Is(err, http.ErrMissingFile) {
+		// no file was submitted with the form, check for an embed URL instead
+		return AttachEmbedFromRequest(request, post, postBoard)
+	}
+	if err != nil {
+		gcutil.LogError(err).Caller().Send()
+		return nil, err
+	}
+	if request.PostFormValue("embed") != "" {
+		return nil, ErrEmbedAndUpload
+	}
+	return attachUpload(handler, 0, request, writer, post, postBoard)
+}
+
+// AttachUploadsFromRequest reads an incoming HTTP request and processes all of the incoming files (or the embed
+// if there are none). Each file goes through the same checks and processing as a single upload. If one of them
+// is rejected, the files that were already processed are removed
+func AttachUploadsFromRequest(request *http.Request, writer http.ResponseWriter, post *gcsql.Post, postBoard *gcsql.Board) ([]*gcsql.Upload, error) {
+	_, _, err := request.FormFile("imagefile")
+	if errors.Is(err, http.ErrMissingFile) {
+		// no files were submitted with the form, check for an embed URL instead
+		upload, err := AttachEmbedFromRequest(request, post, postBoard)
+		if upload == nil {
+			return nil, err
+		}
+		return []*gcsql.Upload{upload}, err
+	}
+	if err != nil {
+		gcutil.LogError(err).Caller().Send()
+		return nil, err
+	}
+	handlers := request.MultipartForm.File["imagefile"]
+	if request.PostFormValue("embed") != "" {
+		return nil, ErrEmbedAndUpload
+	}
+	maxFiles := config.GetBoardConfig(postBoard.Dir).MaxFilesPerPost
+	if maxFiles < 1 {
+		maxFiles = 1
+	}
+	if len(handlers) > maxFiles {
+		gcutil.LogWarning().
+			Str("IP", post.IP).
+			Int("numFiles", len(handlers)).
+			Int("maxFiles", maxFiles).
+			Msg("Post rejected for having too many files")
+		return nil, &TooManyFilesError{MaxFiles: maxFiles}
+	}
+	var attached []*gcsql.Upload
+	for f, handler := range handlers {
+		upload, err := attachUpload(handler, f, request, writer, post, postBoard)
+		if err != nil {
+			RemoveUploadFiles(postBoard.Dir, attached...)
+			return nil, err
+		}
+		attached = append(attached, upload)
+	}
+	return attached, nil
+}
+
+// RemoveUploadFiles deletes the files and thumbnails of uploads that were processed but couldn't be
+// attached to a post
+func RemoveUploadFiles(boardDir string, uploads ...*gcsql.Upload) {
+	documentRoot := config.GetSystemCriticalConfig().DocumentRoot
+	for _, upload := range uploads {
+		if !IsEmbed(upload.Filename) {
+			os.Remove(path.Join(documentRoot, boardDir, "src", upload.Filename))
+		}
+		thumbPath, catalogThumbPath := GetThumbnailFilenames(path.Join(documentRoot, boardDir, "thumb", upload.Filename))
+		os.Remove(thumbPath)
+		os.Remove(catalogThumbPath)
+	}
+}
+
+// TooManyFilesError is returned by AttachUploadsFromRequest if more files were submitted than the board's
+// MaxFilesPerPost allows
+type TooManyFilesError struct {
+	MaxFiles int
+}
+
+func (tmf *TooManyFilesError) Error() string {
+	if tmf.MaxFiles == 1 {
+		return "posts on this board can only have one file"
+	}
+	return fmt.Sprintf("posts on this board can have at most %d files", tmf.MaxFiles)
+}
+
+// isOPUpload returns true if the upload is the first file in a new thread, which gets the larger OP thumbnail and
+// the catalog thumbnail
+func isOPUpload(upload *gcsql.Upload, post *gcsql.Post) bool {
+	return post.ThreadID == 0 && upload.FileOrder == 0
+}
+
+// attachUpload processes an individual file from the request, running it through the filename, checksum,
+// fingerprint and duplicate checks before writing it and creating its thumbnail(s). fileIndex is the file's
+// position in the post
+func attachUpload(handler *multipart.FileHeader, fileIndex int, request *http.Request, writer http.ResponseWriter, post *gcsql.Post, postBoard *gcsql.Board) (*gcsql.Upload, error) {
 	infoEv, errEv := gcutil.LogRequest(request)
 	defer func() {
 		gcutil.LogDiscard(infoEv, errEv)
 	}()
-	file, handler, err := request.FormFile("imagefile")
-	if errors.Is(err, http.ErrMissingFile) {
-		// no file was submitted with the form
-		return nil, nil
-	}
+	file, err := handler.Open()
 	if err != nil {
 		errEv.Err(err).Caller().Send()
 		return nil, err
 	}
+	defer file.Close()
 	upload := &gcsql.Upload{
 		OriginalFilename: html.EscapeString(handler.Filename),
 		FileSize:         int(handler.Size),
+		FileOrder:        fileIndex,
 	}
 	gcutil.LogStr("originalFilename", upload.OriginalFilename, errEv, infoEv)
 
@@ -111,7 +214,6 @@ func AttachUploadFromRequest(request *http.Request, writer http.ResponseWriter,
 		errEv.Err(err).Caller().Send()
 		return nil, errors.New("Error while trying to read file: " + err.Error())
 	}
-	defer file.Close()
 
 	// Calculate image checksum
 	upload.Checksum = fmt.Sprintf("%x", md5.Sum(data)) // skipcq: GSC-G401
@@ -122,7 +224,7 @@ func AttachUploadFromRequest(request *http.Request, writer http.ResponseWriter,
 	}
 
 	ext := strings.ToLower(filepath.Ext(upload.OriginalFilename))
-	upload.Filename = getNewFilename() + ext
+	upload.Filename = getNewFilename(fileIndex) + ext
 
 	documentRoot := config.GetSystemCriticalConfig().DocumentRoot
 	filePath := path.Join(documentRoot, postBoard.Dir, "src", upload.Filename)
@@ -132,7 +234,7 @@ func AttachUploadFromRequest(request *http.Request, writer http.ResponseWriter,
 	errEv.
 		Str("originalFilename", upload.OriginalFilename).
 		Str("filePath", filePath)
-	if post.ThreadID == 0 {
+	if isOPUpload(upload, post) {
 		errEv.Str("catalogThumbPath", catalogThumbPath)
 	}
 
@@ -142,11 +244,15 @@ func AttachUploadFromRequest(request *http.Request, writer http.ResponseWriter,
 			errEv.Err(err).Caller().Msg("unable to decode file")
 			return nil, errors.New("unable to decode image")
 		}
-		fileBan, err := checkImageFingerprintBan(img, postBoard.Dir)
-		if err != nil {
+		if upload.Fingerprint, err = getImageFingerprint(img); err != nil {
 			errEv.Err(err).Caller().Msg("unable to fingerprint image")
 			return nil, err
 		}
+		fileBan, err := checkFingerprintBan(upload.Fingerprint, postBoard.Dir)
+		if err != nil {
+			errEv.Err(err).Caller().Msg("unable to check image fingerprint ban")
+			return nil, err
+		}
 		if fileBan != nil {
 			// image is fingerprint-banned
 			if err = fileBan.ApplyIPBan(post.IP); err != nil {
@@ -156,8 +262,33 @@ func AttachUploadFromRequest(request *http.Request, writer http.ResponseWriter,
 		}
 	}
 
-	if err = os.WriteFile(filePath, data, config.GC_FILE_MODE); err != nil {
-		errEv.Err(err).Caller().Send()
+	if err = checkDuplicateUpload(upload, post, postBoard); err != nil {
+		return nil, err
+	}
+
+	srcFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, config.GC_FILE_MODE)
+	for attempt := 1; errors.Is(err, os.ErrExist) && attempt < maxFilenameAttempts; attempt++ {
+		// another upload got the same name, try a new one
+		upload.Filename = getNewFilename(fileIndex) + ext
+		filePath = path.Join(documentRoot, postBoard.Dir, "src", upload.Filename)
+		thumbPath, catalogThumbPath = GetThumbnailFilenames(
+			path.Join(documentRoot, postBoard.Dir, "thumb", upload.Filename))
+		srcFile, err = os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, config.GC_FILE_MODE)
+	}
+	if errors.Is(err, os.ErrExist) {
+		err = ErrNoUniqueFilename
+	}
+	if err == nil {
+		_, err = srcFile.Write(data)
+		if closeErr := srcFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(filePath)
+		}
+	}
+	if err != nil {
+		errEv.Err(err).Caller().Str("filePath", filePath).Send()
 		writer.WriteHeader(http.StatusInternalServerError)
 		return nil, fmt.Errorf("couldn't write file %q", upload.OriginalFilename)
 	}
@@ -191,7 +322,11 @@ func AttachUploadFromRequest(request *http.Request, writer http.ResponseWriter,
 	}
 
 	if IsVideo(filePath) && config.GetSiteConfig().FingerprintVideoThumbnails {
-		fileBan, err := checkFileFingerprintBan(thumbPath, postBoard.Dir)
+		if upload.Fingerprint, err = GetFileFingerprint(thumbPath); err != nil {
+			errEv.Err(err).Caller().Msg("unable to fingerprint video thumbnail")
+			return nil, err
+		}
+		fileBan, err := checkFingerprintBan(upload.Fingerprint, postBoard.Dir)
 		if err != nil {
 			errEv.Err(err).Caller().Msg("unable to check video thumbnail ban")
 			return nil, err
@@ -203,13 +338,29 @@ func AttachUploadFromRequest(request *http.Request, writer http.ResponseWriter,
 			}
 			return nil, ErrFileNotAllowed
 		}
+		if config.GetBoardConfig(postBoard.Dir).DuplicateImageMode == DuplicateModeFingerprint {
+			// video thumbnails can't be checked until they are created
+			if err = checkDuplicateUpload(upload, post, postBoard); err != nil {
+				os.Remove(filePath)
+				os.Remove(thumbPath)
+				os.Remove(catalogThumbPath)
+				return nil, err
+			}
+		}
 	}
 
 	accessEv.Send()
 	return upload, nil
 }
 
-func getNewFilename() string {
+// getNewFilename returns a new filename (without the extension) for an upload, made from the current time, the
+// file's position in the post, and a random number so that files uploaded at the same time don't share a name
+func getNewFilename(fileIndex int) string {
 	now := time.Now().Unix()
-	return strconv.Itoa(int(now)) + strconv.Itoa(rand.Intn(98)+1) // skipcq: GSC-G404
+	suffix, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		// crypto/rand doesn't fail on supported platforms, but fall back to the nanoseconds just in case
+		suffix = big.NewInt(int64(time.Now().Nanosecond() % 1000000))
+	}
+	return fmt.Sprintf("%d%d%06d", now, fileIndex, suffix.Int64())
 }
@@ -0,0 +1,78 @@
+package uploads
+
+import (
+	"fmt"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/gochan-org/gochan/pkg/gcutil"
+)
+
+const (
+	DuplicateModeChecksum    = "checksum"
+	DuplicateModeFingerprint = "fingerprint"
+)
+
+// DuplicateUploadError is returned by AttachUploadFromRequest if the board has RejectDuplicateImages enabled and
+// the upload matches one in a post that hasn't been deleted
+type DuplicateUploadError struct {
+	PostID   int
+	PostPath string
+}
+
+func (de *DuplicateUploadError) Error() string {
+	return fmt.Sprintf("This file has already been posted: %s", de.PostPath)
+}
+
+// checkDuplicateUpload returns a *DuplicateUploadError if RejectDuplicateImages is enabled for the board and the
+// upload's checksum (or fingerprint, depending on DuplicateImageMode) matches an existing upload on the board.
+// If the fingerprint mode is used and the upload has no fingerprint (not an image or a video thumbnail), its
+// checksum is checked instead
+func checkDuplicateUpload(upload *gcsql.Upload, post *gcsql.Post, postBoard *gcsql.Board) error {
+	boardCfg := config.GetBoardConfig(postBoard.Dir)
+	if !boardCfg.RejectDuplicateImages {
+		return nil
+	}
+	var postID int
+	var err error
+	switch boardCfg.DuplicateImageMode {
+	case DuplicateModeFingerprint:
+		if upload.Fingerprint != "" {
+			postID, err = gcsql.GetUploadPostIDByFingerprint(postBoard.ID, upload.Fingerprint)
+			break
+		}
+		fallthrough
+	case "", DuplicateModeChecksum:
+		postID, err = gcsql.GetUploadPostIDByChecksum(postBoard.ID, upload.Checksum)
+	default:
+		return fmt.Errorf("unrecognized DuplicateImageMode value %q", boardCfg.DuplicateImageMode)
+	}
+	if err != nil {
+		gcutil.LogError(err).
+			Str("IP", post.IP).
+			Str("boardDir", postBoard.Dir).
+			Str("checksum", upload.Checksum).
+			Str("fingerprint", upload.Fingerprint).
+			Msg("Error checking for duplicate upload")
+		return err
+	}
+	if postID == 0 {
+		return nil
+	}
+	existingPost, err := gcsql.GetPostFromID(postID, true)
+	if err != nil {
+		gcutil.LogError(err).
+			Int("postID", postID).
+			Msg("Unable to get post with duplicate upload")
+		return err
+	}
+	gcutil.LogWarning().
+		Str("originalFilename", upload.OriginalFilename).
+		Str("boardDir", postBoard.Dir).
+		Int("existingPostID", postID).
+		Msg("File rejected for being a duplicate")
+	return &DuplicateUploadError{
+		PostID:   postID,
+		PostPath: existingPost.WebPath(),
+	}
+}
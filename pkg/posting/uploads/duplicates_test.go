@@ -0,0 +1,46 @@
+package uploads
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDuplicateUploadFingerprintMode(t *testing.T) {
+	config.SetTestDBConfig("mysql", "localhost", "gochan", "gochan", "gochan", "")
+	boardCfg := config.GetBoardConfig("")
+	oldReject := boardCfg.RejectDuplicateImages
+	oldMode := boardCfg.DuplicateImageMode
+	boardCfg.RejectDuplicateImages = true
+	boardCfg.DuplicateImageMode = DuplicateModeFingerprint
+	defer func() {
+		boardCfg.RejectDuplicateImages = oldReject
+		boardCfg.DuplicateImageMode = oldMode
+	}()
+
+	db, mock, err := sqlmock.New()
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, gcsql.SetTestingDB("mysql", "gochan", "", db)) {
+		return
+	}
+	board := &gcsql.Board{ID: 1, Dir: "test"}
+	post := &gcsql.Post{IP: "192.168.56.1"}
+
+	mock.ExpectPrepare(`SELECT posts.id FROM files\s+JOIN posts ON post_id = posts.id\s+JOIN threads ON thread_id = threads.id\s+WHERE board_id = \? AND fingerprint = \?`).
+		ExpectQuery().WithArgs(1, "fingerprint").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	assert.NoError(t, checkDuplicateUpload(&gcsql.Upload{Checksum: "checksum", Fingerprint: "fingerprint"}, post, board))
+
+	mock.ExpectPrepare(`SELECT posts.id FROM files\s+JOIN posts ON post_id = posts.id\s+JOIN threads ON thread_id = threads.id\s+WHERE board_id = \? AND checksum = \?`).
+		ExpectQuery().WithArgs(1, "checksum").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	assert.NoError(t, checkDuplicateUpload(&gcsql.Upload{Checksum: "checksum"}, post, board),
+		"files that can't be fingerprinted should be checked by checksum")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,257 @@
+package uploads
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/gochan-org/gochan/pkg/gcutil"
+)
+
+var (
+	embedProviders = make(map[string]EmbedProvider)
+	// embedHTTPClient is used by the built-in providers to fetch thumbnails and metadata
+	embedHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+	ErrEmbedsNotAllowed   = errors.New("embeds are not enabled on this board")
+	ErrUnsupportedEmbed   = errors.New("unsupported or invalid embed URL")
+	ErrEmbedAndUpload     = errors.New("posts can have either an upload or an embed, not both")
+	ErrEmbedThumbnailFail = errors.New("unable to get embed thumbnail")
+
+	youtubeIDRe = regexp.MustCompile(`^[\w-]{11}$`)
+	vimeoIDRe   = regexp.MustCompile(`^\d+$`)
+)
+
+// EmbedProvider handles links to media hosted on an external site (YouTube, Vimeo, etc) so that they can be
+// attached to a post in place of an uploaded file
+type EmbedProvider interface {
+	// MediaID returns the provider's ID for the media pointed to by the URL, or an empty string if the URL
+	// isn't handled by the provider
+	MediaID(mediaURL *url.URL) string
+	// MediaURL returns the URL of the media's page on the external site
+	MediaURL(mediaID string) string
+	// EmbedURL returns the URL to be used as the source of the click-to-play iframe
+	EmbedURL(mediaID string) string
+	// Thumbnail returns the image to be used to create the embed's thumbnails
+	Thumbnail(mediaID string) (image.Image, error)
+}
+
+// RegisterEmbedProvider registers an embed provider. The ID is used as the extension of the embed's filename,
+// so that it can be looked up when the post is built
+func RegisterEmbedProvider(id string, provider EmbedProvider) error {
+	if _, ok := embedProviders[id]; ok {
+		return fmt.Errorf("an embed provider has already been registered to the ID %q", id)
+	}
+	embedProviders[id] = provider
+	SetThumbnailExtension("."+id, ".jpg")
+	return nil
+}
+
+// GetEmbedProvider returns the embed provider for the given embed filename if it has been registered,
+// or nil if it hasn't
+func GetEmbedProvider(filename string) EmbedProvider {
+	ext := path.Ext(filename)
+	if ext == "" {
+		return nil
+	}
+	return embedProviders[ext[1:]]
+}
+
+// IsEmbed returns true if the filename is for an embed instead of an uploaded file
+func IsEmbed(filename string) bool {
+	return GetEmbedProvider(filename) != nil
+}
+
+// GetEmbedFromURL finds a registered provider that handles the URL, and returns its ID and the media ID
+func GetEmbedFromURL(mediaURL string) (string, string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(mediaURL))
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", "", ErrUnsupportedEmbed
+	}
+	for id, provider := range embedProviders {
+		if mediaID := provider.MediaID(parsed); mediaID != "" {
+			return id, mediaID, nil
+		}
+	}
+	return "", "", ErrUnsupportedEmbed
+}
+
+// AttachEmbedFromRequest processes the "embed" form field if it is set, creating the embed's thumbnails and
+// returning an upload to be attached to the post. It returns nil and no error if no embed URL was submitted
+func AttachEmbedFromRequest(request *http.Request, post *gcsql.Post, postBoard *gcsql.Board) (*gcsql.Upload, error) {
+	embedURL := strings.TrimSpace(request.PostFormValue("embed"))
+	if embedURL == "" {
+		return nil, nil
+	}
+	infoEv, errEv := gcutil.LogRequest(request)
+	defer gcutil.LogDiscard(infoEv, errEv)
+	gcutil.LogStr("embedURL", embedURL, infoEv, errEv)
+
+	boardConfig := config.GetBoardConfig(postBoard.Dir)
+	if !boardConfig.EnableEmbeds || !postBoard.AllowEmbeds {
+		errEv.Caller().Msg("Embed rejected (embeds not enabled)")
+		return nil, ErrEmbedsNotAllowed
+	}
+	providerID, mediaID, err := GetEmbedFromURL(embedURL)
+	if err != nil {
+		errEv.Err(err).Caller().Send()
+		return nil, err
+	}
+	gcutil.LogStr("embedProvider", providerID, infoEv, errEv)
+	gcutil.LogStr("mediaID", mediaID, infoEv, errEv)
+
+	upload := &gcsql.Upload{
+		OriginalFilename: mediaID,
+		Checksum:         fmt.Sprintf("%x", md5.Sum([]byte(providerID+":"+mediaID))), // skipcq: GSC-G401
+		Width:            boardConfig.EmbedWidth,
+		Height:           boardConfig.EmbedHeight,
+	}
+	if err = checkDuplicateUpload(upload, post, postBoard); err != nil {
+		return nil, err
+	}
+
+	img, err := embedProviders[providerID].Thumbnail(mediaID)
+	if err != nil {
+		errEv.Err(err).Caller().Msg("Unable to get embed thumbnail")
+		return nil, ErrEmbedThumbnailFail
+	}
+	// embeds only have thumbnails stored locally, so the name is checked against those
+	thumbDir := path.Join(config.GetSystemCriticalConfig().DocumentRoot, postBoard.Dir, "thumb")
+	var thumbPath, catalogThumbPath string
+	for attempt := 0; attempt < maxFilenameAttempts; attempt++ {
+		upload.Filename = getNewFilename(0) + "." + providerID
+		thumbPath, catalogThumbPath = GetThumbnailFilenames(path.Join(thumbDir, upload.Filename))
+		if _, err = os.Stat(thumbPath); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		errEv.Err(err).Caller().Msg("Unable to get a unique filename for embed thumbnail")
+		return nil, ErrNoUniqueFilename
+	}
+	thumbType := ThumbnailReply
+	if isOPUpload(upload, post) {
+		thumbType = ThumbnailOP
+		if err = imaging.Save(createImageThumbnail(img, postBoard.Dir, ThumbnailCatalog), catalogThumbPath); err != nil {
+			errEv.Err(err).Caller().
+				Str("thumbPath", catalogThumbPath).
+				Msg("Couldn't generate catalog thumbnail")
+			return nil, ErrEmbedThumbnailFail
+		}
+	}
+	thumbnail := createImageThumbnail(img, postBoard.Dir, thumbType)
+	if err = imaging.Save(thumbnail, thumbPath); err != nil {
+		errEv.Err(err).Caller().
+			Str("thumbPath", thumbPath).
+			Msg("Couldn't generate thumbnail")
+		return nil, ErrEmbedThumbnailFail
+	}
+	upload.ThumbnailWidth = thumbnail.Bounds().Dx()
+	upload.ThumbnailHeight = thumbnail.Bounds().Dy()
+	infoEv.Msg("Embed attached")
+	return upload, nil
+}
+
+// fetchImage downloads and decodes the image at the given URL
+func fetchImage(imageURL string) (image.Image, error) {
+	resp, err := embedHTTPClient.Get(imageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status %q requesting %s", resp.Status, imageURL)
+	}
+	return imaging.Decode(resp.Body)
+}
+
+type youtubeProvider struct{}
+
+func (*youtubeProvider) MediaID(mediaURL *url.URL) string {
+	var mediaID string
+	switch strings.TrimPrefix(mediaURL.Hostname(), "www.") {
+	case "youtu.be":
+		mediaID = strings.TrimPrefix(mediaURL.Path, "/")
+	case "youtube.com", "m.youtube.com":
+		if mediaURL.Path == "/watch" {
+			mediaID = mediaURL.Query().Get("v")
+		} else if strings.HasPrefix(mediaURL.Path, "/shorts/") {
+			mediaID = strings.TrimPrefix(mediaURL.Path, "/shorts/")
+		}
+	}
+	if !youtubeIDRe.MatchString(mediaID) {
+		return ""
+	}
+	return mediaID
+}
+
+func (*youtubeProvider) MediaURL(mediaID string) string {
+	return "https://www.youtube.com/watch?v=" + mediaID
+}
+
+func (*youtubeProvider) EmbedURL(mediaID string) string {
+	return "https://www.youtube-nocookie.com/embed/" + mediaID + "?autoplay=1"
+}
+
+func (*youtubeProvider) Thumbnail(mediaID string) (image.Image, error) {
+	return fetchImage("https://img.youtube.com/vi/" + mediaID + "/hqdefault.jpg")
+}
+
+type vimeoProvider struct{}
+
+func (*vimeoProvider) MediaID(mediaURL *url.URL) string {
+	if strings.TrimPrefix(mediaURL.Hostname(), "www.") != "vimeo.com" {
+		return ""
+	}
+	mediaID := strings.TrimPrefix(mediaURL.Path, "/")
+	if !vimeoIDRe.MatchString(mediaID) {
+		return ""
+	}
+	return mediaID
+}
+
+func (*vimeoProvider) MediaURL(mediaID string) string {
+	return "https://vimeo.com/" + mediaID
+}
+
+func (*vimeoProvider) EmbedURL(mediaID string) string {
+	return "https://player.vimeo.com/video/" + mediaID + "?autoplay=1"
+}
+
+func (vp *vimeoProvider) Thumbnail(mediaID string) (image.Image, error) {
+	resp, err := embedHTTPClient.Get("https://vimeo.com/api/oembed.json?url=" + url.QueryEscape(vp.MediaURL(mediaID)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status %q requesting Vimeo oEmbed data", resp.Status)
+	}
+	var oembed struct {
+		ThumbnailURL string `json:"thumbnail_url"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&oembed); err != nil {
+		return nil, err
+	}
+	if oembed.ThumbnailURL == "" {
+		return nil, errors.New("Vimeo oEmbed data has no thumbnail URL")
+	}
+	return fetchImage(oembed.ThumbnailURL)
+}
+
+func init() {
+	RegisterEmbedProvider("youtube", &youtubeProvider{})
+	RegisterEmbedProvider("vimeo", &vimeoProvider{})
+}
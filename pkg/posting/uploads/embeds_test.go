@@ -0,0 +1,142 @@
+package uploads
+
+import (
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/stretchr/testify/assert"
+)
+
+type testEmbedProvider struct{}
+
+func (*testEmbedProvider) MediaID(mediaURL *url.URL) string {
+	if mediaURL.Hostname() != "media.example.com" {
+		return ""
+	}
+	return mediaURL.Query().Get("id")
+}
+
+func (*testEmbedProvider) MediaURL(mediaID string) string {
+	return "https://media.example.com/?id=" + mediaID
+}
+
+func (*testEmbedProvider) EmbedURL(mediaID string) string {
+	return "https://media.example.com/embed/" + mediaID
+}
+
+func (*testEmbedProvider) Thumbnail(_ string) (image.Image, error) {
+	return image.NewRGBA(image.Rect(0, 0, 480, 360)), nil
+}
+
+func TestGetEmbedFromURL(t *testing.T) {
+	if _, ok := embedProviders["test"]; !ok {
+		assert.NoError(t, RegisterEmbedProvider("test", &testEmbedProvider{}))
+	}
+	assert.Error(t, RegisterEmbedProvider("test", &testEmbedProvider{}))
+
+	testCases := []struct {
+		url            string
+		expectProvider string
+		expectMediaID  string
+		expectError    bool
+	}{
+		{url: "https://www.youtube.com/watch?v=dQw4w9WgXcQ", expectProvider: "youtube", expectMediaID: "dQw4w9WgXcQ"},
+		{url: "https://youtu.be/dQw4w9WgXcQ", expectProvider: "youtube", expectMediaID: "dQw4w9WgXcQ"},
+		{url: "https://youtube.com/shorts/dQw4w9WgXcQ", expectProvider: "youtube", expectMediaID: "dQw4w9WgXcQ"},
+		{url: "https://www.youtube.com/watch?v=tooshort", expectError: true},
+		{url: "https://vimeo.com/76979871", expectProvider: "vimeo", expectMediaID: "76979871"},
+		{url: "https://vimeo.com/channels/staffpicks", expectError: true},
+		{url: "https://media.example.com/?id=abc", expectProvider: "test", expectMediaID: "abc"},
+		{url: "javascript:alert(1)", expectError: true},
+		{url: "https://example.com/video.mp4", expectError: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.url, func(t *testing.T) {
+			providerID, mediaID, err := GetEmbedFromURL(tC.url)
+			if tC.expectError {
+				assert.ErrorIs(t, err, ErrUnsupportedEmbed)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tC.expectProvider, providerID)
+			assert.Equal(t, tC.expectMediaID, mediaID)
+		})
+	}
+}
+
+func TestIsEmbed(t *testing.T) {
+	assert.True(t, IsEmbed("123456789.youtube"))
+	assert.True(t, IsEmbed("123456789.vimeo"))
+	assert.False(t, IsEmbed("123456789.png"))
+	assert.False(t, IsEmbed("deleted"))
+	thumb, catalogThumb := GetThumbnailFilenames("123456789.youtube")
+	assert.Equal(t, "123456789t.jpg", thumb)
+	assert.Equal(t, "123456789c.jpg", catalogThumb)
+	assert.Equal(t, "https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ?autoplay=1",
+		GetEmbedProvider("1.youtube").EmbedURL("dQw4w9WgXcQ"))
+}
+
+func TestAttachEmbedFromRequest(t *testing.T) {
+	if _, ok := embedProviders["test"]; !ok {
+		assert.NoError(t, RegisterEmbedProvider("test", &testEmbedProvider{}))
+	}
+	documentRoot := t.TempDir()
+	config.SetTestDocumentRoot(documentRoot)
+	if !assert.NoError(t, os.MkdirAll(path.Join(documentRoot, "test", "thumb"), 0755)) {
+		return
+	}
+	boardConfig := config.GetBoardConfig("")
+	oldEnableEmbeds := boardConfig.EnableEmbeds
+	defer func() {
+		boardConfig.EnableEmbeds = oldEnableEmbeds
+	}()
+
+	testCases := []struct {
+		desc         string
+		embedURL     string
+		enableEmbeds bool
+		allowEmbeds  bool
+		expectErr    error
+	}{
+		{desc: "valid URL", embedURL: "https://media.example.com/?id=abc", enableEmbeds: true, allowEmbeds: true},
+		{desc: "unsupported host", embedURL: "https://example.com/video.mp4", enableEmbeds: true, allowEmbeds: true,
+			expectErr: ErrUnsupportedEmbed},
+		{desc: "embeds disabled in config", embedURL: "https://media.example.com/?id=abc", allowEmbeds: true,
+			expectErr: ErrEmbedsNotAllowed},
+		{desc: "embeds disabled on board", embedURL: "https://media.example.com/?id=abc", enableEmbeds: true,
+			expectErr: ErrEmbedsNotAllowed},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			boardConfig.EnableEmbeds = tC.enableEmbeds
+			request := httptest.NewRequest(http.MethodPost, "/post",
+				strings.NewReader(url.Values{"embed": {tC.embedURL}}.Encode()))
+			request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			post := &gcsql.Post{IP: "192.168.56.1"}
+			board := &gcsql.Board{ID: 1, Dir: "test", AllowEmbeds: tC.allowEmbeds}
+
+			upload, err := AttachEmbedFromRequest(request, post, board)
+			if tC.expectErr != nil {
+				assert.ErrorIs(t, err, tC.expectErr)
+				assert.Nil(t, upload)
+				return
+			}
+			if !assert.NoError(t, err) || !assert.NotNil(t, upload) {
+				return
+			}
+			assert.Equal(t, "abc", upload.OriginalFilename)
+			assert.True(t, strings.HasSuffix(upload.Filename, ".test"))
+			thumbPath, catalogThumbPath := GetThumbnailFilenames(path.Join(documentRoot, "test", "thumb", upload.Filename))
+			assert.FileExists(t, thumbPath)
+			assert.FileExists(t, catalogThumbPath, "new threads should get a catalog thumbnail")
+		})
+	}
+}
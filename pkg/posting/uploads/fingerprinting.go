@@ -36,18 +36,22 @@ func getHashLength() int {
 	return hashLength
 }
 
-func checkImageFingerprintBan(img image.Image, _ string) (*gcsql.FileBan, error) {
-	hashLength := getHashLength()
-	ba, err := imagehash.Ahash(img, hashLength)
+// getImageFingerprint returns the perceptual hash of the image used for fingerprint bans and duplicate checking
+func getImageFingerprint(img image.Image) (string, error) {
+	ba, err := imagehash.Ahash(img, getHashLength())
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return fmt.Sprintf("%x", ba), nil
+}
+
+func checkFingerprintBan(fingerprint string, _ string) (*gcsql.FileBan, error) {
 	const query = `SELECT id,board_id,staff_id,staff_note,issued_at,checksum,fingerprinter,
 	ban_ip,ban_ip_message
 	FROM DBPREFIXfile_ban WHERE fingerprinter = 'ahash' AND checksum = ? LIMIT 1`
 
 	var fileBan gcsql.FileBan
-	err = gcsql.QueryRowSQL(query, []any{fmt.Sprintf("%x", ba)}, []any{
+	err := gcsql.QueryRowSQL(query, []any{fingerprint}, []any{
 		&fileBan.ID, &fileBan.BoardID, &fileBan.StaffID, &fileBan.StaffNote,
 		&fileBan.IssuedAt, &fileBan.Checksum, &fileBan.Fingerprinter,
 		&fileBan.BanIP, &fileBan.BanIPMessage,
@@ -85,18 +89,5 @@ func GetFileFingerprint(filePath string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-
-	ba, err := imagehash.Ahash(img, getHashLength())
-	if err != nil {
-		return "", err
-	}
-	return fmt.Sprintf("%x", ba), nil
-}
-
-func checkFileFingerprintBan(filePath string, board string) (*gcsql.FileBan, error) {
-	img, err := imaging.Open(filePath)
-	if err != nil {
-		return nil, err
-	}
-	return checkImageFingerprintBan(img, board)
+	return getImageFingerprint(img)
 }
@@ -72,7 +72,7 @@ func processImage(upload *gcsql.Upload, post *gcsql.Post, board string, filePath
 	upload.Width = img.Bounds().Max.X
 	upload.Height = img.Bounds().Max.Y
 	thumbType := ThumbnailReply
-	if post.ThreadID == 0 {
+	if isOPUpload(upload, post) {
 		thumbType = ThumbnailOP
 	}
 	upload.ThumbnailWidth, upload.ThumbnailHeight = getThumbnailSize(upload.Width, upload.Height, board, thumbType)
@@ -98,8 +98,8 @@ func processImage(upload *gcsql.Upload, post *gcsql.Post, board string, filePath
 	if shouldThumb {
 		var thumbnail image.Image
 		var catalogThumbnail image.Image
-		if post.ThreadID == 0 {
-			// If this is a new thread, generate thumbnail and catalog thumbnail
+		if isOPUpload(upload, post) {
+			// If this is the first file in a new thread, generate thumbnail and catalog thumbnail
 			thumbnail = createImageThumbnail(img, board, ThumbnailOP)
 			catalogThumbnail = createImageThumbnail(img, board, ThumbnailCatalog)
 			if err = imaging.Save(catalogThumbnail, catalogThumbPath); err != nil {
@@ -127,7 +127,7 @@ func processImage(upload *gcsql.Upload, post *gcsql.Post, board string, filePath
 				Msg("Couldn't generate catalog thumbnail")
 			return err
 		}
-		if post.ThreadID == 0 {
+		if isOPUpload(upload, post) {
 			// Generate catalog thumbnail
 			catalogThumbnail := createImageThumbnail(img, board, ThumbnailCatalog)
 			if err = imaging.Save(catalogThumbnail, catalogThumbPath); err != nil {
@@ -24,7 +24,8 @@ func processOther(upload *gcsql.Upload, post *gcsql.Post, board string, filePath
 	}
 	infoEv.Str("post", "withOther")
 
-	if post.ThreadID == 0 {
+	opUpload := isOPUpload(upload, post)
+	if opUpload {
 		// OP
 		upload.ThumbnailWidth = boardConfig.ThumbWidth
 		upload.ThumbnailHeight = boardConfig.ThumbHeight
@@ -47,7 +48,7 @@ func processOther(upload *gcsql.Upload, post *gcsql.Post, board string, filePath
 			Str("filePath", filePath).Send()
 		return err
 	}
-	if post.ThreadID == 0 {
+	if opUpload {
 		if err = os.Symlink(originalThumbPath, catalogThumbPath); err != nil {
 			os.Remove(filePath)
 			errEv.Err(err).Caller().
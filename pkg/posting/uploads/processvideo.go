@@ -15,7 +15,8 @@ func processVideo(upload *gcsql.Upload, post *gcsql.Post, board string, filePath
 	boardConfig := config.GetBoardConfig(board)
 	infoEv.Str("post", "withVideo")
 	var err error
-	if post.ThreadID == 0 {
+	opUpload := isOPUpload(upload, post)
+	if opUpload {
 		if err = createVideoThumbnail(filePath, thumbPath, boardConfig.ThumbWidth); err != nil {
 			errEv.Err(err).Caller().
 				Int("thumbWidth", boardConfig.ThumbWidth).
@@ -32,12 +33,14 @@ func processVideo(upload *gcsql.Upload, post *gcsql.Post, board string, filePath
 		}
 	}
 
-	if err = createVideoThumbnail(filePath, catalogThumbPath, boardConfig.ThumbWidthCatalog); err != nil {
-		errEv.Err(err).Caller().
-			Str("thumbPath", thumbPath).
-			Int("thumbWidth", boardConfig.ThumbWidthCatalog).
-			Msg("Error creating video thumbnail for catalog")
-		return err
+	if opUpload {
+		if err = createVideoThumbnail(filePath, catalogThumbPath, boardConfig.ThumbWidthCatalog); err != nil {
+			errEv.Err(err).Caller().
+				Str("thumbPath", thumbPath).
+				Int("thumbWidth", boardConfig.ThumbWidthCatalog).
+				Msg("Error creating video thumbnail for catalog")
+			return err
+		}
 	}
 
 	outputBytes, err := exec.Command("ffprobe", "-v", "quiet", "-show_format", "-show_streams", filePath).CombinedOutput()
@@ -61,7 +64,7 @@ func processVideo(upload *gcsql.Upload, post *gcsql.Post, board string, filePath
 			}
 		}
 		thumbType := ThumbnailReply
-		if post.ThreadID == 0 {
+		if opUpload {
 			thumbType = ThumbnailOP
 		}
 		upload.ThumbnailWidth, upload.ThumbnailHeight = getThumbnailSize(
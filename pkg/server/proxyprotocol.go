@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	proxyHeaderTimeout = 5 * time.Second
+	// maxProxyV1HeaderLength is the longest a PROXY protocol v1 header can be, including the CRLF
+	maxProxyV1HeaderLength = 107
+)
+
+var (
+	ErrInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// ProxyProtocolListener accepts connections that start with a PROXY protocol (v1 or v2) header giving the
+// address of the client that connected to the proxy, which is then returned by the connection's RemoteAddr.
+// Headers are only read from connections from trusted peers, which must send one. Other connections are used
+// as they are
+type ProxyProtocolListener struct {
+	net.Listener
+	// Trusted returns true if the peer is allowed to send a PROXY protocol header
+	Trusted func(net.Addr) bool
+}
+
+// Accept waits for the next connection. The PROXY protocol header is read the first time the connection is
+// read from or its RemoteAddr is checked, so that a slow peer doesn't hold up other connections
+func (ppl *ProxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := ppl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtocolConn{
+		Conn:      conn,
+		reader:    bufio.NewReader(conn),
+		useHeader: ppl.Trusted(conn.RemoteAddr()),
+	}, nil
+}
+
+type proxyProtocolConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	useHeader  bool
+	once       sync.Once
+	remoteAddr net.Addr
+	headerErr  error
+}
+
+func (ppc *proxyProtocolConn) readHeader() {
+	ppc.once.Do(func() {
+		ppc.remoteAddr = ppc.Conn.RemoteAddr()
+		if !ppc.useHeader {
+			return
+		}
+		ppc.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		addr, err := readProxyHeader(ppc.reader)
+		ppc.Conn.SetReadDeadline(time.Time{})
+		if err != nil {
+			ppc.headerErr = err
+			return
+		}
+		if addr != nil {
+			ppc.remoteAddr = addr
+		}
+	})
+}
+
+func (ppc *proxyProtocolConn) Read(b []byte) (int, error) {
+	ppc.readHeader()
+	if ppc.headerErr != nil {
+		return 0, ppc.headerErr
+	}
+	return ppc.reader.Read(b)
+}
+
+func (ppc *proxyProtocolConn) RemoteAddr() net.Addr {
+	ppc.readHeader()
+	return ppc.remoteAddr
+}
+
+// readProxyHeader reads a PROXY protocol header and returns the client's address, or nil if the header doesn't
+// have one (if the proxy is checking the connection itself or the protocol is unknown)
+func readProxyHeader(reader *bufio.Reader) (net.Addr, error) {
+	start, err := reader.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(start, proxyV2Signature) {
+		return readProxyV2Header(reader)
+	}
+	if bytes.HasPrefix(start, []byte("PROXY ")) {
+		return readProxyV1Header(reader)
+	}
+	return nil, ErrInvalidProxyHeader
+}
+
+// readProxyV1Header reads a text header like "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+func readProxyV1Header(reader *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= maxProxyV1HeaderLength {
+			return nil, ErrInvalidProxyHeader
+		}
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidProxyHeader
+	}
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil || ip.Is4() != (fields[1] == "TCP4") {
+		return nil, ErrInvalidProxyHeader
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, ErrInvalidProxyHeader
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+}
+
+// readProxyV2Header reads a binary header, starting with the 12 byte signature
+func readProxyV2Header(reader *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, ErrInvalidProxyHeader
+	}
+	command := header[12] & 0xf
+	family := header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, err
+	}
+	switch command {
+	case 0x0:
+		// LOCAL, the proxy is connecting on its own behalf
+		return nil, nil
+	case 0x1:
+		// PROXY
+	default:
+		return nil, ErrInvalidProxyHeader
+	}
+	switch family {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, ErrInvalidProxyHeader
+		}
+		ip := netip.AddrFrom4([4]byte(payload[0:4]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(payload[8:10]))), nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, ErrInvalidProxyHeader
+		}
+		ip := netip.AddrFrom16([16]byte(payload[0:16]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, binary.BigEndian.Uint16(payload[32:34]))), nil
+	default:
+		// UDP, unix sockets, and unspecified protocols don't have a client IP that can be used
+		return nil, nil
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func proxyV2Header(command byte, family byte, payload []byte) string {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20|command, family)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+	return string(append(header, payload...))
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	ipv4Payload := []byte{192, 168, 56, 1, 10, 0, 0, 1, 0x30, 0x39, 0x01, 0xbb}
+	ipv6Payload := append(append(make([]byte, 0, 36),
+		0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1), make([]byte, 16)...)
+	ipv6Payload = append(ipv6Payload, 0x30, 0x39, 0x01, 0xbb)
+
+	testCases := []struct {
+		desc      string
+		header    string
+		expected  string
+		expectErr bool
+	}{
+		{desc: "v1 TCP4", header: "PROXY TCP4 192.168.56.1 10.0.0.1 12345 443\r\n", expected: "192.168.56.1:12345"},
+		{desc: "v1 TCP6", header: "PROXY TCP6 2001:db8::1 2001:db8::2 12345 443\r\n", expected: "[2001:db8::1]:12345"},
+		{desc: "v1 unknown", header: "PROXY UNKNOWN\r\n"},
+		{desc: "v1 mismatched family", header: "PROXY TCP4 2001:db8::1 2001:db8::2 12345 443\r\n", expectErr: true},
+		{desc: "v1 too long", header: "PROXY TCP4 " + strings.Repeat("1", 200) + "\r\n", expectErr: true},
+		{desc: "v2 TCP4", header: proxyV2Header(0x1, 0x11, ipv4Payload), expected: "192.168.56.1:12345"},
+		{desc: "v2 TCP6", header: proxyV2Header(0x1, 0x21, ipv6Payload), expected: "[2001:db8::1]:12345"},
+		{desc: "v2 LOCAL", header: proxyV2Header(0x0, 0x00, nil)},
+		{desc: "v2 short payload", header: proxyV2Header(0x1, 0x11, ipv4Payload[:4]), expectErr: true},
+		{desc: "no header", header: "GET / HTTP/1.1\r\n", expectErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tC.header + "GET /"))
+			addr, err := readProxyHeader(reader)
+			if tC.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			if tC.expected == "" {
+				assert.Nil(t, addr)
+			} else {
+				assert.Equal(t, tC.expected, addr.String())
+			}
+			rest, _ := io.ReadAll(reader)
+			assert.Equal(t, "GET /", string(rest), "the data after the header should be left for the connection")
+		})
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	trusted := true
+	listener := &ProxyProtocolListener{
+		Listener: tcpListener,
+		Trusted: func(net.Addr) bool {
+			return trusted
+		},
+	}
+	defer listener.Close()
+
+	for _, tC := range []struct {
+		trusted      bool
+		expectedAddr string
+	}{{trusted: true, expectedAddr: "192.168.56.1:12345"}, {trusted: false, expectedAddr: "127.0.0.1"}} {
+		trusted = tC.trusted
+		client, err := net.Dial("tcp", tcpListener.Addr().String())
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = client.Write([]byte("PROXY TCP4 192.168.56.1 10.0.0.1 12345 443\r\nhello"))
+		assert.NoError(t, err)
+		client.Close()
+
+		conn, err := listener.Accept()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Contains(t, conn.RemoteAddr().String(), tC.expectedAddr)
+		data, err := io.ReadAll(conn)
+		assert.NoError(t, err)
+		if tC.trusted {
+			assert.Equal(t, "hello", string(data))
+		} else {
+			assert.Equal(t, "PROXY TCP4 192.168.56.1 10.0.0.1 12345 443\r\nhello", string(data),
+				"headers from untrusted peers shouldn't be parsed")
+		}
+		conn.Close()
+	}
+}
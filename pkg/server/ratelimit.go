@@ -0,0 +1,245 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/gochan-org/gochan/pkg/gcutil"
+	"github.com/gochan-org/gochan/pkg/server/serverutil"
+	"github.com/uptrace/bunrouter"
+)
+
+const (
+	rateLimitPruneInterval = time.Minute
+	// sharedRateLimitExpiry is how long a rate limit stored in the database can go unused before it is deleted
+	sharedRateLimitExpiry = 24 * time.Hour
+	// limitedIPExpiry is how long an IP stays in the list returned by GetRateLimitedIPs after it was last limited
+	limitedIPExpiry = 24 * time.Hour
+)
+
+var (
+	rateLimitBuckets = tokenBucketStore{
+		buckets: make(map[string]*tokenBucket),
+	}
+	limitedIPs = rateLimitedIPList{
+		ips: make(map[string]*RateLimitedIP),
+	}
+	lastSharedRateLimitPrune time.Time
+	sharedRateLimitPruneLock sync.Mutex
+)
+
+// RateLimitedIP is an IP that has recently been rate limited on a route or board
+type RateLimitedIP struct {
+	IP string
+	// Route is the route ("post", "util", "manage", or "captcha") or the board (e.g. "/b/") the IP was limited on
+	Route string
+	// Count is the number of requests that have been rejected
+	Count       int
+	LastLimited time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket will have been refilled, after which it can be pruned
+	full time.Time
+}
+
+// tokenBucketStore holds the rate limit buckets in memory, if they aren't shared in the database
+type tokenBucketStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+}
+
+// take takes a token from the bucket with the given key. If it is empty, take returns false and how long it will
+// be until a token is available
+func (tbs *tokenBucketStore) take(key string, limit config.RateLimit, now time.Time) (bool, time.Duration) {
+	tbs.mutex.Lock()
+	defer tbs.mutex.Unlock()
+	if now.Sub(tbs.lastPrune) > rateLimitPruneInterval {
+		tbs.lastPrune = now
+		for bucketKey, bucket := range tbs.buckets {
+			if now.After(bucket.full) {
+				delete(tbs.buckets, bucketKey)
+			}
+		}
+	}
+
+	capacity := float64(limit.Requests)
+	refillRate := limit.RefillRate()
+	bucket, ok := tbs.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity}
+		tbs.buckets[key] = bucket
+	} else if now.After(bucket.updated) {
+		bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*refillRate)
+	}
+	bucket.updated = now
+
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	bucket.full = now.Add(time.Duration((capacity - bucket.tokens) / refillRate * float64(time.Second)))
+	if allowed {
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.tokens) / refillRate * float64(time.Second))
+}
+
+// rateLimitedIPList keeps track of IPs that have been rate limited so that they can be shown in the staff dashboard
+type rateLimitedIPList struct {
+	mutex     sync.Mutex
+	ips       map[string]*RateLimitedIP
+	lastPrune time.Time
+}
+
+// prune removes the IPs that haven't been limited recently. The mutex must be locked by the caller
+func (rll *rateLimitedIPList) prune(now time.Time) {
+	rll.lastPrune = now
+	for key, limited := range rll.ips {
+		if now.Sub(limited.LastLimited) > limitedIPExpiry {
+			delete(rll.ips, key)
+		}
+	}
+}
+
+func (rll *rateLimitedIPList) add(ip string, route string, now time.Time) {
+	rll.mutex.Lock()
+	defer rll.mutex.Unlock()
+	if now.Sub(rll.lastPrune) > rateLimitPruneInterval {
+		rll.prune(now)
+	}
+	key := route + ":" + ip
+	limited, ok := rll.ips[key]
+	if !ok {
+		limited = &RateLimitedIP{IP: ip, Route: route}
+		rll.ips[key] = limited
+	}
+	limited.Count++
+	limited.LastLimited = now
+}
+
+func (rll *rateLimitedIPList) list(now time.Time) []RateLimitedIP {
+	rll.mutex.Lock()
+	defer rll.mutex.Unlock()
+	rll.prune(now)
+	ips := make([]RateLimitedIP, 0, len(rll.ips))
+	for _, limited := range rll.ips {
+		ips = append(ips, *limited)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return ips[i].LastLimited.After(ips[j].LastLimited)
+	})
+	return ips
+}
+
+// GetRateLimitedIPs returns the IPs that have been rate limited in the last 24 hours, most recently limited first
+func GetRateLimitedIPs() []RateLimitedIP {
+	return limitedIPs.list(time.Now())
+}
+
+func pruneSharedRateLimits(now time.Time) {
+	sharedRateLimitPruneLock.Lock()
+	if now.Sub(lastSharedRateLimitPrune) < rateLimitPruneInterval {
+		sharedRateLimitPruneLock.Unlock()
+		return
+	}
+	lastSharedRateLimitPrune = now
+	sharedRateLimitPruneLock.Unlock()
+
+	if err := gcsql.DeleteStaleRateLimits(now.Add(-sharedRateLimitExpiry)); err != nil {
+		gcutil.LogError(err).Caller().Msg("Unable to delete stale rate limits")
+	}
+}
+
+// takeRateLimitToken takes a token from the bucket with the given key, from the database if the rate limits are
+// shared, or from memory otherwise. If the shared rate limit can't be checked, the error is returned along with
+// the result from memory
+func takeRateLimitToken(key string, limit config.RateLimit) (bool, time.Duration, error) {
+	now := time.Now()
+	if !config.GetSiteConfig().RateLimits.SharedInDB {
+		allowed, retryAfter := rateLimitBuckets.take(key, limit, now)
+		return allowed, retryAfter, nil
+	}
+	pruneSharedRateLimits(now)
+	allowed, retryAfter, err := gcsql.TakeRateLimitToken(key, limit.Requests, limit.RefillRate(), now)
+	if err != nil {
+		// fall back to this instance's own buckets instead of letting every request through
+		allowed, retryAfter = rateLimitBuckets.take(key, limit, now)
+	}
+	return allowed, retryAfter, err
+}
+
+// CheckRateLimit returns true if the requester's IP is within the rate limit for the given route or board. If it
+// isn't, a 429 (Too Many Requests) error is served with a Retry-After header and false is returned
+func CheckRateLimit(writer http.ResponseWriter, request *http.Request, route string, limit config.RateLimit) bool {
+	if !limit.Enabled() {
+		return true
+	}
+	ip := gcutil.GetRealIP(request)
+	allowed, retryAfter, err := takeRateLimitToken(route+":"+ip, limit)
+	if err != nil {
+		// the request is still checked against the in-memory rate limit, so it isn't blocked because of a
+		// database problem
+		gcutil.LogError(err).Caller().
+			Str("IP", ip).
+			Str("route", route).
+			Msg("Unable to check shared rate limit")
+	}
+	if allowed {
+		return true
+	}
+
+	limitedIPs.add(ip, route, time.Now())
+	retrySeconds := int(math.Ceil(retryAfter.Seconds()))
+	if retrySeconds < 1 {
+		retrySeconds = 1
+	}
+	gcutil.LogAccess(request).
+		Int("status", http.StatusTooManyRequests).
+		Str("route", route).
+		Int("retryAfter", retrySeconds).
+		Msg("Request was rate limited")
+
+	wantsJSON := serverutil.IsRequestingJSON(request)
+	if wantsJSON {
+		writer.Header().Set("Content-Type", "application/json")
+	} else {
+		writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
+	writer.Header().Set("Retry-After", strconv.Itoa(retrySeconds))
+	writer.WriteHeader(http.StatusTooManyRequests)
+	ServeError(writer, "You are sending requests too quickly, please wait "+strconv.Itoa(retrySeconds)+
+		" seconds and try again", wantsJSON, map[string]any{
+		"retryAfter": retrySeconds,
+	})
+	return false
+}
+
+// RateLimitMiddleware returns bunrouter middleware that limits requests to the route using the limit in the
+// site's RateLimits.Routes setting. Logged in staff aren't limited on the manage route
+func RateLimitMiddleware(route string) bunrouter.MiddlewareFunc {
+	return func(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+		return func(writer http.ResponseWriter, request bunrouter.Request) error {
+			limit := config.GetSiteConfig().RateLimits.Routes[route]
+			if route == "manage" && limit.Enabled() {
+				// login attempts are still limited, since they don't have a valid session yet
+				if staff, err := gcsql.GetStaffFromRequest(request.Request); err == nil && staff.Rank > 0 {
+					return next(writer, request)
+				}
+			}
+			if !CheckRateLimit(writer, request.Request, route, limit) {
+				return nil
+			}
+			return next(writer, request)
+		}
+	}
+}
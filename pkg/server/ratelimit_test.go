@@ -0,0 +1,160 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gochan-org/gochan/pkg/config"
+	"github.com/gochan-org/gochan/pkg/gcsql"
+	"github.com/gochan-org/gochan/pkg/server/serverutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/uptrace/bunrouter"
+)
+
+func TestTokenBucketStore(t *testing.T) {
+	store := tokenBucketStore{buckets: make(map[string]*tokenBucket)}
+	limit := config.RateLimit{Requests: 2, PerSeconds: 10}
+	now := time.Now()
+
+	allowed, _ := store.take("post:192.168.56.1", limit, now)
+	assert.True(t, allowed)
+	allowed, _ = store.take("post:192.168.56.1", limit, now)
+	assert.True(t, allowed, "requests should be allowed in bursts of up to the limit")
+	allowed, retryAfter := store.take("post:192.168.56.1", limit, now)
+	assert.False(t, allowed)
+	assert.InDelta(t, 5*time.Second, retryAfter, float64(time.Millisecond))
+
+	allowed, _ = store.take("post:192.168.56.2", limit, now)
+	assert.True(t, allowed, "IPs should have separate buckets")
+
+	allowed, retryAfter = store.take("post:192.168.56.1", limit, now.Add(3*time.Second))
+	assert.False(t, allowed)
+	assert.InDelta(t, 2*time.Second, retryAfter, float64(time.Millisecond))
+	allowed, _ = store.take("post:192.168.56.1", limit, now.Add(6*time.Second))
+	assert.True(t, allowed, "a token should be available after the bucket is refilled")
+
+	store.take("post:192.168.56.1", limit, now.Add(time.Hour))
+	assert.Len(t, store.buckets, 1, "full buckets should be pruned")
+}
+
+func TestRateLimitedIPList(t *testing.T) {
+	list := rateLimitedIPList{ips: make(map[string]*RateLimitedIP)}
+	now := time.Now()
+	list.add("192.168.56.1", "post", now)
+	list.add("192.168.56.1", "post", now)
+	list.add("192.168.56.2", "util", now.Add(limitedIPExpiry+time.Minute))
+	assert.Len(t, list.ips, 1, "IPs that haven't been limited recently should be pruned when a new one is added")
+	assert.Contains(t, list.ips, "util:192.168.56.2")
+
+	limited := list.list(now.Add(limitedIPExpiry + 2*time.Minute))
+	if assert.Len(t, limited, 1) {
+		assert.Equal(t, "192.168.56.2", limited[0].IP)
+		assert.Equal(t, 1, limited[0].Count)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	config.SetVersion("4.0.0")
+	serverutil.InitMinifier()
+	rateLimitCfg := &config.GetSiteConfig().RateLimits
+	oldRoutes := rateLimitCfg.Routes
+	rateLimitCfg.Routes = map[string]config.RateLimit{"util": {Requests: 1, PerSeconds: 30}}
+	defer func() {
+		rateLimitCfg.Routes = oldRoutes
+	}()
+
+	router := bunrouter.New()
+	router.WithMiddleware(RateLimitMiddleware("util")).GET("/util", func(w http.ResponseWriter, _ bunrouter.Request) error {
+		w.Write([]byte("ok"))
+		return nil
+	})
+	router.WithMiddleware(RateLimitMiddleware("post")).GET("/post", func(w http.ResponseWriter, _ bunrouter.Request) error {
+		w.Write([]byte("ok"))
+		return nil
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/util?json=1", nil)
+	request.RemoteAddr = "192.168.56.20:12345"
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "ok", recorder.Body.String())
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "30", recorder.Header().Get("Retry-After"))
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var errJSON map[string]any
+	if assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &errJSON)) {
+		assert.Contains(t, errJSON["error"], "too quickly")
+		assert.EqualValues(t, 30, errJSON["retryAfter"])
+	}
+
+	for i := 0; i < 3; i++ {
+		recorder = httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/post", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code, "routes without a limit shouldn't be limited")
+	}
+
+	var found bool
+	for _, limited := range GetRateLimitedIPs() {
+		if limited.IP == "192.168.56.20" && limited.Route == "util" {
+			found = true
+			assert.Equal(t, 1, limited.Count)
+		}
+	}
+	assert.True(t, found, "the limited IP should be listed")
+}
+
+func TestRateLimitMiddlewareStaff(t *testing.T) {
+	config.SetVersion("4.0.0")
+	serverutil.InitMinifier()
+	config.SetTestDBConfig("sqlite3", "localhost", "gochan", "gochan", "gochan", "")
+	db, mock, err := sqlmock.New()
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, gcsql.SetTestingDB("sqlite3", "gochan", "", db)) {
+		return
+	}
+	rateLimitCfg := &config.GetSiteConfig().RateLimits
+	oldRoutes := rateLimitCfg.Routes
+	rateLimitCfg.Routes = map[string]config.RateLimit{"manage": {Requests: 1, PerSeconds: 30}}
+	defer func() {
+		rateLimitCfg.Routes = oldRoutes
+	}()
+
+	router := bunrouter.New()
+	router.WithMiddleware(RateLimitMiddleware("manage")).GET("/manage", func(w http.ResponseWriter, _ bunrouter.Request) error {
+		w.Write([]byte("ok"))
+		return nil
+	})
+
+	for i := 0; i < 3; i++ {
+		mock.ExpectPrepare(`SELECT\s+staff.id,.+FROM staff as staff\s+JOIN sessions as sessions`).ExpectQuery().
+			WithArgs("staffsession").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password_checksum", "global_rank", "added_on", "last_login"}).
+				AddRow(1, "admin", "", 3, time.Now(), time.Now()))
+		request := httptest.NewRequest(http.MethodGet, "/manage", nil)
+		request.RemoteAddr = "192.168.56.21:12345"
+		request.AddCookie(&http.Cookie{Name: "sessiondata", Value: "staffsession"})
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusOK, recorder.Code, "logged in staff shouldn't be limited on /manage")
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/manage", nil)
+	request.RemoteAddr = "192.168.56.21:12345"
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code, "requests without a session should still be limited")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -72,7 +72,7 @@ CREATE TABLE DBPREFIXposts(
 	ip VARCHAR(45) NOT NULL,
 	created_on TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 	name VARCHAR(50) NOT NULL DEFAULT '',
-	tripcode VARCHAR(10) NOT NULL DEFAULT '',
+	tripcode VARCHAR(32) NOT NULL DEFAULT '',
 	is_role_signature BOOL NOT NULL DEFAULT FALSE,
 	email VARCHAR(50) NOT NULL DEFAULT '',
 	subject VARCHAR(100) NOT NULL DEFAULT '',
@@ -103,11 +103,32 @@ CREATE TABLE DBPREFIXfiles(
 	thumbnail_height INT NOT NULL,
 	width INT NOT NULL,
 	height INT NOT NULL,
+	fingerprint VARCHAR(64) NOT NULL DEFAULT '',
 	CONSTRAINT files_post_id_fk
 		FOREIGN KEY(post_id) REFERENCES DBPREFIXposts(id) ON DELETE CASCADE,
 	CONSTRAINT files_post_id_file_order_unique UNIQUE(post_id, file_order)
 );
 
+CREATE TABLE DBPREFIXpost_commands(
+	post_id BIGINT NOT NULL,
+	command_order INT NOT NULL,
+	command VARCHAR(32) NOT NULL,
+	args VARCHAR(100) NOT NULL DEFAULT '',
+	result VARCHAR(255) NOT NULL,
+	CONSTRAINT post_commands_post_id_fk
+		FOREIGN KEY(post_id) REFERENCES DBPREFIXposts(id) ON DELETE CASCADE,
+	CONSTRAINT post_commands_pk PRIMARY KEY (post_id,command_order)
+);
+
+CREATE TABLE DBPREFIXpending_posts(
+	post_id BIGINT NOT NULL,
+	reason VARCHAR(255) NOT NULL,
+	bump_thread BOOL NOT NULL,
+	CONSTRAINT pending_posts_post_id_fk
+		FOREIGN KEY(post_id) REFERENCES DBPREFIXposts(id) ON DELETE CASCADE,
+	CONSTRAINT pending_posts_pk PRIMARY KEY (post_id)
+);
+
 CREATE TABLE DBPREFIXstaff(
 	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
 	username VARCHAR(45) NOT NULL,
@@ -297,10 +318,39 @@ CREATE TABLE DBPREFIXwordfilters(
 	search VARCHAR(75) NOT NULL,
 	is_regex BOOL NOT NULL,
 	change_to VARCHAR(75) NOT NULL,
+	action VARCHAR(10) NOT NULL DEFAULT 'replace',
+	ban_duration VARCHAR(32) NOT NULL DEFAULT '',
+	hits INT NOT NULL DEFAULT 0,
+	last_hit_at TIMESTAMP NULL,
 	CONSTRAINT wordfilters_staff_id_fk
 		FOREIGN KEY(staff_id) REFERENCES DBPREFIXstaff(id),
 	CONSTRAINT wordfilters_search_check CHECK (search <> '')
 );
 
+CREATE TABLE DBPREFIXr9k_hashes(
+	board_id BIGINT NOT NULL,
+	hash CHAR(64) NOT NULL,
+	CONSTRAINT r9k_hashes_board_id_fk
+		FOREIGN KEY(board_id) REFERENCES DBPREFIXboards(id) ON DELETE CASCADE,
+	CONSTRAINT r9k_hashes_pk PRIMARY KEY (board_id,hash)
+);
+
+CREATE TABLE DBPREFIXr9k_mutes(
+	board_id BIGINT NOT NULL,
+	ip VARCHAR(45) NOT NULL,
+	mute_count INT NOT NULL DEFAULT 0,
+	expires_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CONSTRAINT r9k_mutes_board_id_fk
+		FOREIGN KEY(board_id) REFERENCES DBPREFIXboards(id) ON DELETE CASCADE,
+	CONSTRAINT r9k_mutes_pk PRIMARY KEY (board_id,ip)
+);
+
+CREATE TABLE DBPREFIXrate_limits(
+	bucket_key VARCHAR(128) NOT NULL,
+	tokens BIGINT NOT NULL,
+	updated_ms BIGINT NOT NULL,
+	CONSTRAINT rate_limits_pk PRIMARY KEY (bucket_key)
+);
+
 INSERT INTO DBPREFIXdatabase_version(component, version)
-	VALUES('gochan', 3);
+	VALUES('gochan', 4);